@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/buildstate"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// loadConfig loads the config named by the first argument, or the target of it picked by --target, failing
+// instead of prompting when it is missing
+func loadConfig(args []string, usage string) (*types.Config, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil, withExitCode(exitConfig, fmt.Errorf("usage: %s", usage))
+	}
+	if err := fetchConfig(args); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(args[0]); os.IsNotExist(err) {
+		return nil, withExitCode(exitConfig, fmt.Errorf("config file %s not found (create one with `generate-config --output %s`)", args[0], args[0]))
+	}
+	var cfg *types.Config
+	var err error
+	if target := targetFlag(args[1:]); target != "" {
+		cfg, err = config.LoadTarget(args[0], target)
+	} else {
+		cfg, err = config.Load(args[0])
+	}
+	if err != nil {
+		return nil, withExitCode(exitConfig, fmt.Errorf("failed to load config: %w", err))
+	}
+	if cfg.ConfigVersion < config.CurrentVersion {
+		slog.Warn("Config predates the current config version, upgrade it with `config migrate`", "path", args[0], "config_version", max(cfg.ConfigVersion, 1), "current", config.CurrentVersion)
+	}
+	return cfg, nil
+}
+
+// fetchConfig replaces a config URL in the first argument with the path of a fetched copy, so the command
+// and any builders it starts read that from then on
+func fetchConfig(args []string) error {
+	if !config.IsRemote(args[0]) {
+		return nil
+	}
+	local, err := config.Fetch(args[0])
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	args[0] = local
+	return nil
+}
+
+// scriptsFor returns the provisioning scripts a config runs: its provisioners, or the defaults
+func scriptsFor(cfg *types.Config) []string {
+	if cfg.Provisioners != nil {
+		return builder.Scripts(cfg.Provisioners)
+	}
+	return builder.Scripts(provisioningScripts)
+}
+
+func runBuild(args []string) error {
+	cfg, err := loadConfig(args, "build <config> [--target <name> | --all] [--image-version <version>] [--region <region>] [--scripts <a.sh,b.sh>] [--timeout <duration>] [--max-parallel <n>] [--ssh-cidr <cidr>|auto] [--wait-for-lock <duration>] [--keep-vm] [--resume-vm <id> [--resume-from provision|snapshot]] [--recover resume|cleanup]")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	fs.String("target", "", "build this target of the config (read by loadConfig)")
+	all := fs.Bool("all", false, "build every target of the config, each in a process of its own")
+	imageVersion := fs.String("image-version", "", "override image_version from the config (\"auto\" for the next version)")
+	region := fs.String("region", "", "build only in this region, with the overrides of its replicas entry")
+	scriptsFlag := fs.String("scripts", "", "comma-separated provisioning scripts to run instead of the defaults")
+	keepVM := fs.Bool("keep-vm", false, "leave the build VM running if the build fails (keep_vm_on_failure)")
+	skipSnapshot := fs.Bool("skip-snapshot", false, "stop after provisioning, without creating a snapshot or image (skip_snapshot)")
+	resumeVM := fs.Int("resume-vm", 0, "continue the build on this already running VM instead of creating one")
+	resumeFrom := fs.String("resume-from", builder.ResumeFromProvision, "phase to resume from with --resume-vm: provision or snapshot")
+	recoverMode := fs.String("recover", "", "how to deal with an interrupted build of the image: resume or cleanup")
+	waitForLock := fs.Duration("wait-for-lock", 0, "when another build of the image name and region is running, wait up to this long for it instead of failing")
+	fs.StringVar(&cfg.SSHCIDR, "ssh-cidr", cfg.SSHCIDR, "CIDR allowed to SSH to build VMs, or auto for this host's public IP (ssh_cidr)")
+	fs.IntVar(&cfg.MaxParallel, "max-parallel", cfg.MaxParallel, "build VMs to run at once on this host, queuing the rest (max_parallel)")
+	// The timeout flags override the config's timeouts in place
+	if cfg.Timeouts == nil {
+		cfg.Timeouts = &types.TimeoutsConfig{}
+	}
+	fs.StringVar(&cfg.Timeouts.Build, "timeout", cfg.Timeouts.Build, "deadline for the whole build, e.g. 2h (timeouts.build)")
+	fs.StringVar(&cfg.Timeouts.VMReady, "vm-ready-timeout", cfg.Timeouts.VMReady, "how long to wait for the VM to become ready (timeouts.vm_ready)")
+	fs.StringVar(&cfg.Timeouts.SSH, "ssh-timeout", cfg.Timeouts.SSH, "how long to keep retrying the SSH connection (timeouts.ssh)")
+	fs.StringVar(&cfg.Timeouts.Snapshot, "snapshot-timeout", cfg.Timeouts.Snapshot, "how long to wait for the snapshot (timeouts.snapshot)")
+	fs.StringVar(&cfg.Timeouts.Image, "image-timeout", cfg.Timeouts.Image, "how long to wait for the image (timeouts.image)")
+	fs.Parse(args[1:])
+
+	if *region != "" {
+		cfg = regionConfig(cfg, *region)
+	}
+	if *keepVM {
+		cfg.KeepVMOnFailure = true
+	}
+	if *skipSnapshot {
+		cfg.SkipSnapshot = true
+	}
+	if *imageVersion != "" {
+		cfg.ImageVersion = *imageVersion
+	}
+	scripts := scriptsFor(cfg)
+	if *scriptsFlag != "" {
+		scripts = strings.Split(*scriptsFlag, ",")
+	}
+
+	// The first interrupt or SIGTERM cancels the build, which then tears down what it created; a second one
+	// kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	if len(cfg.Targets) > 0 {
+		if !*all {
+			return withExitCode(exitConfig, fmt.Errorf("%w, or build them all with --all", targetsError(cfg)))
+		}
+		if err := buildTargets(ctx, cfg, args[0], withoutFlag(args[1:], "all", false)); err != nil {
+			fatal("Target builds failed", err)
+		}
+		return nil
+	}
+	if *all {
+		return withExitCode(exitConfig, fmt.Errorf("--all builds every target, but the config defines none"))
+	}
+	if _, err := validateConfig(cfg); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+
+	hyperstackClient, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	imageNames := []string{cfg.ImageName}
+	for _, stage := range cfg.Stages {
+		imageNames = append(imageNames, stage.ImageName)
+	}
+	interrupted, err := findInterrupted(imageNames...)
+	if err != nil {
+		return err
+	}
+	if len(interrupted) > 0 {
+		switch *recoverMode {
+		case recoverCleanup:
+			for _, s := range interrupted {
+				if err := cleanupInterrupted(ctx, hyperstackClient, s); err != nil {
+					return err
+				}
+			}
+		case recoverResume:
+			if len(interrupted) > 1 || len(cfg.Stages) > 0 || *resumeVM != 0 {
+				return fmt.Errorf("--recover resume needs a single interrupted build of a single-image config without --resume-vm")
+			}
+			point, err := resumePointFor(ctx, hyperstackClient, interrupted[0])
+			if err != nil {
+				return err
+			}
+			*resumeVM, *resumeFrom = point.VMID, point.From
+			if err := buildstate.Delete(buildstate.DefaultDir(), interrupted[0].BuildID); err != nil {
+				return err
+			}
+		case "":
+			return interruptedError(interrupted)
+		default:
+			return fmt.Errorf("unknown --recover mode %q, expected %s or %s", *recoverMode, recoverResume, recoverCleanup)
+		}
+	}
+
+	// A matrix entry picks its region in its own build, and regions name theirs
+	if cfg.Region == "" && cfg.Matrix == nil && len(cfg.Regions) == 0 {
+		if *resumeVM != 0 {
+			return withExitCode(exitConfig, fmt.Errorf("--resume-vm needs the region of the VM, pass --region"))
+		}
+		selected, err := builder.SelectRegion(ctx, hyperstackClient, cfg)
+		if err != nil {
+			return err
+		}
+		cfg.Region = selected
+		cfg.EnvironmentName = fmt.Sprintf("default-%s", selected)
+	}
+
+	if err := resolvePrivateKey(cfg); err != nil {
+		return err
+	}
+	defer removePrivateKeys()
+
+	b := builder.New(builder.Options{
+		API:       hyperstackClient,
+		ScriptDir: scriptDir,
+		FilesDir:  filesDir,
+		Files:     builder.Deployments(fileDeployments),
+	})
+
+	if cfg.Matrix != nil {
+		if *resumeVM != 0 {
+			return fmt.Errorf("--resume-vm cannot be used with a matrix, build the entry's image on its own instead")
+		}
+		// The children read the matrix entries' own configs, which have no targets
+		if err := buildMatrix(ctx, hyperstackClient, cfg, withoutFlag(args[1:], "target", true)); err != nil {
+			fatal("Matrix build failed", err)
+		}
+		return nil
+	}
+
+	if len(cfg.Stages) > 0 {
+		if *resumeVM != 0 {
+			return fmt.Errorf("--resume-vm cannot be used with a multi-stage pipeline")
+		}
+		if err := runPipeline(ctx, b, cfg); err != nil {
+			fatal("Pipeline failed", err)
+		}
+		return nil
+	}
+
+	// Wait out a running build before resolving an "auto" version, which that build may be about to publish
+	if *waitForLock > 0 && *resumeVM == 0 {
+		if err := waitForBuilds(ctx, hyperstackClient, cfg, *waitForLock); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveVersion(ctx, hyperstackClient, cfg); err != nil {
+		return err
+	}
+
+	if len(cfg.Regions) > 0 {
+		if *resumeVM != 0 {
+			return fmt.Errorf("--resume-vm builds a single region, pass --region too")
+		}
+		regional, err := buildRegions(ctx, cfg, args[0], args[1:])
+		if err != nil {
+			fatal("Regional builds failed", err)
+		}
+		writeOutputs(cfg, regional)
+		return nil
+	}
+
+	var res *builder.Result
+	if *resumeVM != 0 {
+		res, err = b.Resume(ctx, cfg, scripts, builder.ResumePoint{VMID: *resumeVM, From: *resumeFrom})
+	} else {
+		res, err = b.Build(ctx, cfg, scripts)
+	}
+	if err != nil {
+		fatal("Build failed", err)
+	}
+	if res.Image == nil {
+		// skip_snapshot: nothing to replicate or write outputs for
+		if res.CleanupErr != nil {
+			return withExitCode(exitCleanup, fmt.Errorf("the build VM was not deleted: %w", res.CleanupErr))
+		}
+		return nil
+	}
+
+	regional := singleRegion(cfg, res.Image)
+	if len(cfg.Replicas) > 0 {
+		regional, err = replicate(ctx, b, cfg, res.Image, scripts)
+		if err != nil {
+			fatal("Replication failed", err)
+		}
+	}
+	writeOutputs(cfg, regional)
+	pruneAfterBuild(ctx, hyperstackClient, cfg)
+	if res.CleanupErr != nil {
+		return withExitCode(exitCleanup, fmt.Errorf("image %s was built but its build VM was not deleted: %w", res.Image.Name, res.CleanupErr))
+	}
+	return nil
+}
+
+func runValidate(args []string) error {
+	cfg, err := loadConfig(args, "validate <config> [--target <name>] [--preflight]")
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.String("target", "", "validate this target of the config (read by loadConfig)")
+	preflight := fs.Bool("preflight", false, "also look up the base image, flavor, keypair and environment with the API")
+	fs.Parse(args[1:])
+
+	validate := validateConfig
+	if len(cfg.Targets) > 0 {
+		validate = func(cfg *types.Config) (string, error) { return validateTargets(cfg, args[0]) }
+	}
+	summary, err := validate(cfg)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+
+	if *preflight {
+		ctx := context.Background()
+		hyperstackClient, err := newClient(cfg)
+		if err != nil {
+			return err
+		}
+		configs := []*types.Config{cfg}
+		if len(cfg.Targets) > 0 {
+			configs = nil
+			for _, name := range config.TargetNames(cfg) {
+				targetCfg, err := config.LoadTarget(args[0], name)
+				if err != nil {
+					return withExitCode(exitConfig, fmt.Errorf("target %s: %w", name, err))
+				}
+				configs = append(configs, targetCfg)
+			}
+		}
+		for _, c := range configs {
+			if err := preflightConfig(ctx, hyperstackClient, c); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("%s is valid%s\n", args[0], summary)
+	return nil
+}
+
+// preflightConfig runs the preflight checks of a build for every image and region a valid config builds. Of
+// a pipeline only the first stage is checked, as later ones boot from images it builds.
+func preflightConfig(ctx context.Context, api builder.API, cfg *types.Config) error {
+	images := []*types.Config{cfg}
+	switch {
+	case cfg.Matrix != nil:
+		builds, err := config.ExpandMatrix(cfg)
+		if err != nil {
+			return err
+		}
+		images = nil
+		for _, build := range builds {
+			images = append(images, build.Config)
+		}
+	case len(cfg.Stages) > 0:
+		stages, err := orderStages(cfg.Stages)
+		if err != nil {
+			return err
+		}
+		images = []*types.Config{stageConfig(cfg, stages[0], map[string]*types.Image{})}
+	}
+
+	for _, image := range images {
+		regions := []*types.Config{image}
+		if len(image.Regions) > 0 {
+			regions = nil
+			for _, region := range image.Regions {
+				regions = append(regions, regionConfig(image, region))
+			}
+		}
+		for _, c := range regions {
+			// A missing resource exits as a config error and a flavor out of stock as an API one
+			if err := builder.Preflight(ctx, api, c); err != nil {
+				return fmt.Errorf("%s in %s: %w", c.ImageName, c.Region, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateConfig checks a config without calling the API, returning a summary of what it builds
+func validateConfig(cfg *types.Config) (string, error) {
+	if len(cfg.Targets) > 0 {
+		return "", targetsError(cfg)
+	}
+	if err := checkRegions(cfg); err != nil {
+		return "", err
+	}
+	if err := checkMatrix(cfg); err != nil {
+		return "", err
+	}
+	if cfg.SkipSnapshot && (len(cfg.Stages) > 0 || cfg.Matrix != nil || len(cfg.Regions) > 0) {
+		return "", fmt.Errorf("skip_snapshot cannot be combined with stages, a matrix or regions, build a single region with --region instead")
+	}
+	if cfg.Matrix != nil {
+		builds, err := config.ExpandMatrix(cfg)
+		if err != nil {
+			return "", err
+		}
+		for _, build := range builds {
+			if err := validateImage(build.Config); err != nil {
+				return "", fmt.Errorf("matrix %s: %w", build.Config.ImageName, err)
+			}
+		}
+		return fmt.Sprintf(" (%d matrix builds)", len(builds)), nil
+	}
+
+	if len(cfg.Stages) == 0 {
+		if err := validateImage(cfg); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+
+	if err := config.CheckStages(cfg); err != nil {
+		return "", err
+	}
+	stages, err := orderStages(cfg.Stages)
+	if err != nil {
+		return "", err
+	}
+	// Stand in for the images earlier stages would produce
+	built := make(map[string]*types.Image, len(stages))
+	for _, stage := range stages {
+		stageCfg := stageConfig(cfg, stage, built)
+		if err := builder.Validate(stageCfg); err != nil {
+			return "", fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+		built[stage.Name] = &types.Image{Name: fmt.Sprintf("%s_%s", stageCfg.ImageName, stageCfg.ImageVersion)}
+	}
+	return fmt.Sprintf(" (%d stages)", len(stages)), nil
+}
+
+// validateImage validates a single-image config, in every region if it lists several
+func validateImage(cfg *types.Config) error {
+	if len(cfg.Regions) == 0 {
+		return builder.Validate(cfg)
+	}
+	for _, region := range cfg.Regions {
+		if err := builder.Validate(regionConfig(cfg, region)); err != nil {
+			return fmt.Errorf("region %s: %w", region, err)
+		}
+	}
+	return nil
+}
+
+func runGenerateConfig(args []string) error {
+	fs := flag.NewFlagSet("generate-config", flag.ExitOnError)
+	output := fs.String("output", "", "path to write the config to (default config.json, or config.yaml with --format yaml)")
+	format := fs.String("format", "", "format to write the config in: json or yaml (default from the --output extension)")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	nonInteractive := fs.Bool("non-interactive", false, "write the config from the flags and defaults without prompting")
+	var values types.Config
+	fs.StringVar(&values.Region, "region", "", "region to build in (default CANADA-1)")
+	fs.StringVar(&values.ImageName, "image-name", "", "name of the output image (default kubernetes_gpu_cuda)")
+	fs.StringVar(&values.ImageVersion, "image-version", "", "version of the output image (default today's date)")
+	fs.StringVar(&values.BaseImageName, "base-image", "", "image the build VM boots from (default "+config.DefaultBaseImageName+")")
+	fs.StringVar(&values.VMName, "vm-name", "", "name of the temporary build VM (default thunder-build-vm)")
+	fs.StringVar(&values.FlavorName, "flavor", "", "VM flavor to build on (default "+config.DefaultFlavorName+")")
+	fs.StringVar(&values.KeypairName, "keypair", "", "SSH keypair the build VM is created with (required without prompts)")
+	fs.StringVar(&values.PrivateKeyPath, "private-key", "", "private key of the keypair (default ~/.ssh/id_rsa)")
+	fs.StringVar(&values.EnvironmentName, "environment", "", "environment the build VM is created in (default default-<region>)")
+	tags := fs.String("tags", "", "comma-separated labels added besides k8s")
+	fs.Parse(args)
+
+	// Setting any field skips the prompts, so CI can generate a config with flags alone
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "output", "format", "force":
+		default:
+			*nonInteractive = true
+		}
+	})
+	if !*nonInteractive && !stdinIsTerminal() {
+		return withExitCode(exitConfig, fmt.Errorf("stdin is not a terminal, pass the config fields as flags (e.g. --region CANADA-1 --keypair my-key) or --non-interactive to use the defaults"))
+	}
+	if *nonInteractive && values.KeypairName == "" {
+		return withExitCode(exitConfig, fmt.Errorf("--keypair is required without prompts"))
+	}
+	if *tags != "" {
+		values.Tags = strings.Split(*tags, ",")
+	}
+
+	switch {
+	case *format == "" && *output == "":
+		*format, *output = config.FormatJSON, "config.json"
+	case *format == "":
+		*format = config.FormatOf(*output)
+	case *output == "":
+		*output = "config." + *format
+	}
+	if err := config.CheckFormat(*format); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("%s already exists (pass --force to overwrite it)", *output)
+	}
+
+	// Offer choices from the API when a key is available
+	var cfg *types.Config
+	var err error
+	if *nonInteractive {
+		cfg = config.GenerateFrom(&values)
+	} else if key, _ := apiKey(nil); key != "" {
+		hyperstackClient, clientErr := newClientFromEnv()
+		if clientErr != nil {
+			return clientErr
+		}
+		cfg, err = config.GenerateWithAPI(context.Background(), hyperstackClient)
+	} else {
+		fmt.Println("HYPERSTACK_API_KEY not set, using defaults...")
+		cfg, err = config.Generate()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate config: %w", err)
+	}
+	cfg.ConfigVersion = config.CurrentVersion
+	// Listing the defaults lets the config reorder, add or disable steps
+	cfg.Provisioners = provisioningScripts
+	cfg.Files = fileDeployments
+
+	if err := config.SaveAs(cfg, *output, *format); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("Config saved to %s\n", *output)
+	return nil
+}
+
+func runListImages(args []string) error {
+	fs := flag.NewFlagSet("list-images", flag.ExitOnError)
+	name := fs.String("name", "", "only list images of this image name")
+	channel := fs.String("channel", "", "only list images in this channel: "+strings.Join(labels.Channels, ", "))
+	region := fs.String("region", "", "only list images in this region")
+	var withLabels labelsFlag
+	fs.Var(&withLabels, "label", "only list images with this label (repeatable, all must match)")
+	all := fs.Bool("all", false, "also list images not built by the builder, such as base images")
+	asJSON := fs.Bool("json", false, "print the images as JSON")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	images, err := hyperstackClient.ListImagesInRegion(ctx, *region)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+
+	var listed []types.Image
+	for _, image := range images {
+		if !*all && !builtByBuilder(&image) {
+			continue
+		}
+		if *name != "" && !inFamily(&image, *name) {
+			continue
+		}
+		if *channel != "" && imageChannel(&image) != *channel {
+			continue
+		}
+		if *region != "" && image.RegionName != *region {
+			continue
+		}
+		if !hasAllLabels(imageLabels(&image), withLabels) {
+			continue
+		}
+		listed = append(listed, image)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+
+	if *asJSON {
+		return printJSON(listed)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tREGION\tCHANNEL\tBUILT")
+	for _, image := range listed {
+		built := "-"
+		if builtAt, ok := imageCreatedAt(&image); ok {
+			built = builtAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", image.ID, image.Name, image.RegionName, orDash(imageChannel(&image)), built)
+	}
+	return w.Flush()
+}
+
+// waitForBuilds waits up to timeout for other builds of the image name to finish, in the config's region or
+// in every region of a regional build
+func waitForBuilds(ctx context.Context, hyperstackClient builder.API, cfg *types.Config, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	targets := []*types.Config{cfg}
+	if len(cfg.Regions) > 0 {
+		targets = nil
+		for _, region := range cfg.Regions {
+			targets = append(targets, regionConfig(cfg, region))
+		}
+	}
+	for _, target := range targets {
+		if err := builder.WaitForLock(ctx, hyperstackClient, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
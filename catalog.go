@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metadata"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// CatalogEntry describes one builder-produced image in the catalog
+type CatalogEntry struct {
+	ID                int        `json:"id"`
+	Name              string     `json:"name"`
+	ImageName         string     `json:"image_name"`
+	Version           string     `json:"version"`
+	Region            string     `json:"region"`
+	Channel           string     `json:"channel,omitempty"`
+	DriverVersion     string     `json:"driver_version,omitempty"`
+	CUDAVersion       string     `json:"cuda_version,omitempty"`
+	KubernetesVersion string     `json:"kubernetes_version,omitempty"`
+	BuildID           string     `json:"build_id,omitempty"`
+	BuiltAt           *time.Time `json:"built_at,omitempty"`
+}
+
+// builtByBuilder reports whether an image was produced by this builder
+func builtByBuilder(image *types.Image) bool {
+	for _, l := range image.Labels {
+		if l.Label == labels.Builder || strings.HasPrefix(l.Label, labels.BuildIDPrefix) || strings.HasPrefix(l.Label, metadata.LabelPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogEntry describes an image from its labels, filling versions missing from older images out of build history
+func catalogEntry(image *types.Image, store *history.Store) CatalogEntry {
+	entry := CatalogEntry{
+		ID:        image.ID,
+		Name:      image.Name,
+		ImageName: imageFamily(image),
+		Region:    image.RegionName,
+		Channel:   imageChannel(image),
+	}
+	entry.Version = strings.TrimPrefix(image.Name, entry.ImageName+"_")
+	if builtAt, ok := imageCreatedAt(image); ok {
+		builtAt = builtAt.UTC()
+		entry.BuiltAt = &builtAt
+	}
+
+	if meta, err := metadata.FromImage(image); err == nil {
+		entry.DriverVersion = meta.DriverVersion
+		entry.CUDAVersion = meta.CUDAVersion
+		entry.KubernetesVersion = meta.KubernetesVersion
+		entry.BuildID = meta.BuildID
+		return entry
+	}
+
+	rec, err := store.FindByImageID(image.ID)
+	if err != nil {
+		return entry
+	}
+	entry.BuildID = rec.ID
+	if m, err := manifest.Read(filepath.Join(rec.Artifacts, "manifest.json")); err == nil && m.Software != nil {
+		entry.DriverVersion = m.Software.NvidiaDriver
+		entry.CUDAVersion = m.Software.CUDA
+		entry.KubernetesVersion = m.Software.Kubernetes
+	}
+	return entry
+}
+
+// writeCatalogMarkdown renders the catalog as a markdown table for wikis and portals
+func writeCatalogMarkdown(w io.Writer, entries []CatalogEntry, now time.Time) {
+	fmt.Fprintf(w, "# Image Catalog\n\nGenerated %s.\n\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintln(w, "| Image | Version | ID | Region | Channel | Driver | CUDA | Kubernetes | Age |")
+	fmt.Fprintln(w, "|-------|---------|----|--------|---------|--------|------|------------|-----|")
+	for _, e := range entries {
+		age := "-"
+		if e.BuiltAt != nil {
+			age = fmt.Sprintf("%dd", int(now.Sub(*e.BuiltAt).Hours()/24))
+		}
+		fmt.Fprintf(w, "| %s | %s | %d | %s | %s | %s | %s | %s | %s |\n",
+			e.ImageName, e.Version, e.ID, e.Region, orDash(e.Channel),
+			orDash(e.DriverVersion), orDash(e.CUDAVersion), orDash(e.KubernetesVersion), age)
+	}
+}
+
+func runCatalog(args []string) error {
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the catalog as JSON instead of markdown")
+	name := fs.String("name", "", "only include images with this image name")
+	channel := fs.String("channel", "", "only include images in this channel")
+	output := fs.String("output", "", "write the catalog to a file instead of stdout")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+
+	store := history.Default()
+	var entries []CatalogEntry
+	for _, image := range images {
+		if !builtByBuilder(&image) {
+			continue
+		}
+		if *name != "" && !inFamily(&image, *name) {
+			continue
+		}
+		if *channel != "" && imageChannel(&image) != *channel {
+			continue
+		}
+		entries = append(entries, catalogEntry(&image, store))
+	}
+
+	// Group by image name, newest first
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ImageName != entries[j].ImageName {
+			return entries[i].ImageName < entries[j].ImageName
+		}
+		return entries[i].ID > entries[j].ID
+	})
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	writeCatalogMarkdown(w, entries, time.Now())
+	return nil
+}
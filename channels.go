@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/versioning"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// validChannel reports whether channel is one of the known release channels
+func validChannel(channel string) bool {
+	for _, c := range labels.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// imageChannel returns the channel an image is in, or "" if none
+func imageChannel(image *types.Image) string {
+	for _, l := range image.Labels {
+		if strings.HasPrefix(l.Label, labels.ChannelPrefix) {
+			return strings.TrimPrefix(l.Label, labels.ChannelPrefix)
+		}
+	}
+	return ""
+}
+
+// inFamily reports whether an image was built under the given image name. The family label decides when
+// the image has one, so kubernetes_gpu doesn't match kubernetes_gpu_cuda images.
+func inFamily(image *types.Image, name string) bool {
+	for _, l := range image.Labels {
+		if family, ok := strings.CutPrefix(l.Label, labels.ImageFamilyPrefix); ok {
+			return family == name
+		}
+	}
+	// Images built before the family label existed are matched by their <name>_<version> naming
+	version, ok := strings.CutPrefix(image.Name, name+"_")
+	return ok && versioning.Valid(version)
+}
+
+// imageFamily returns the image name an image was built under
+func imageFamily(image *types.Image) string {
+	for _, l := range image.Labels {
+		if strings.HasPrefix(l.Label, labels.ImageFamilyPrefix) {
+			return strings.TrimPrefix(l.Label, labels.ImageFamilyPrefix)
+		}
+	}
+	if i := strings.LastIndex(image.Name, "_"); i > 0 {
+		return image.Name[:i]
+	}
+	return image.Name
+}
+
+// channelImages returns the images of a family currently in a channel in a region, or in every region
+// if region is empty
+func channelImages(images []types.Image, name, region, channel string) []types.Image {
+	var result []types.Image
+	for _, image := range images {
+		if inFamily(&image, name) && imageChannel(&image) == channel && (region == "" || image.RegionName == region) {
+			result = append(result, image)
+		}
+	}
+	return result
+}
+
+// resolveChannel returns the current image of a family in a channel in a region; the newest wins if several
+// carry the label. Without a region the channel must be in a single region, as images are regional.
+func resolveChannel(ctx context.Context, hyperstackClient builder.API, name, region, channel string) (*types.Image, error) {
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *types.Image
+	var regions []string
+	for _, image := range channelImages(images, name, region, channel) {
+		if !slices.Contains(regions, image.RegionName) {
+			regions = append(regions, image.RegionName)
+		}
+		if current == nil || image.ID > current.ID {
+			img := image
+			current = &img
+		}
+	}
+	switch {
+	case current == nil && region != "":
+		return nil, fmt.Errorf("no %s image in channel %s in %s", name, channel, region)
+	case current == nil:
+		return nil, fmt.Errorf("no %s image in channel %s", name, channel)
+	case len(regions) > 1:
+		sort.Strings(regions)
+		return nil, fmt.Errorf("%s images in channel %s are in several regions (%s), pick one with --region", name, channel, strings.Join(regions, ", "))
+	}
+	return current, nil
+}
+
+// demoteOthers removes the channel label from other images of the family in the channel in the promoted
+// image's region, so that a promotion moves the channel there rather than adding a second image to it
+func demoteOthers(ctx context.Context, hyperstackClient builder.API, promoted *types.Image, channel string) error {
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+
+	family := imageFamily(promoted)
+	for _, image := range channelImages(images, family, promoted.RegionName, channel) {
+		if image.ID == promoted.ID {
+			continue
+		}
+		labels := withoutLabel(imageLabels(&image), labels.ChannelPrefix)
+		slog.Info("Removing image from channel", "image_name", image.Name, "image_id", image.ID, "channel", channel)
+		if _, err := hyperstackClient.UpdateImage(ctx, image.ID, "", labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutLabel returns labels without any label having the given key prefix
+func withoutLabel(labels []string, prefix string) []string {
+	result := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !strings.HasPrefix(l, prefix) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func runImagesResolve(args []string) error {
+	fs := flag.NewFlagSet("images resolve", flag.ExitOnError)
+	name := fs.String("name", "", "image name (without version), e.g. kubernetes_gpu_cuda")
+	channel := fs.String("channel", "stable", "channel to resolve: "+strings.Join(labels.Channels, ", "))
+	region := fs.String("region", "", "region the image must be in, required when the channel is in several")
+	asJSON := fs.Bool("json", false, "print the full image as JSON instead of only its ID")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("--name is required")
+	}
+	if !validChannel(*channel) {
+		return fmt.Errorf("unknown channel %q, expected one of: %s", *channel, strings.Join(labels.Channels, ", "))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	image, err := resolveChannel(ctx, hyperstackClient, *name, *region, *channel)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(image, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Println(image.ID)
+	return nil
+}
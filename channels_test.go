@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder/buildertest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// familyImage returns an image of the kube-node family in a region and channel
+func familyImage(id int, version, region, channel string) types.Image {
+	return types.Image{
+		ID:         id,
+		Name:       "kube-node_" + version,
+		RegionName: region,
+		Labels: []types.ImageLabel{
+			{Label: labels.Builder},
+			{Label: labels.ImageFamilyPrefix + "kube-node"},
+			{Label: labels.Channel(channel)},
+		},
+	}
+}
+
+func TestChannelsAreScopedToRegions(t *testing.T) {
+	ctx := context.Background()
+	api := buildertest.NewAPI(&types.Config{Region: "CANADA-1"})
+	api.AddImage(familyImage(1, "v1.0.0", "CANADA-1", "stable"))
+	api.AddImage(familyImage(2, "v1.0.0", "NORWAY-1", "stable"))
+	api.AddImage(familyImage(3, "v1.1.0", "CANADA-1", "dev"))
+	api.AddImage(familyImage(4, "v1.2.0", "NORWAY-1", "staging"))
+
+	if err := promoteImage(ctx, api, 3, "stable", ""); err != nil {
+		t.Fatalf("promoteImage() error = %v", err)
+	}
+	if !api.Called("UpdateImage 1") {
+		t.Errorf("image 1 was not removed from stable in its region, calls: %v", api.Calls())
+	}
+	if api.Called("UpdateImage 2") {
+		t.Errorf("image 2 was removed from stable in another region, calls: %v", api.Calls())
+	}
+
+	for region, want := range map[string]int{"CANADA-1": 3, "NORWAY-1": 2} {
+		image, err := resolveChannel(ctx, api, "kube-node", region, "stable")
+		if err != nil {
+			t.Fatalf("resolveChannel(%s) error = %v", region, err)
+		}
+		if image.ID != want {
+			t.Errorf("resolveChannel(%s) = image %d, want %d", region, image.ID, want)
+		}
+	}
+	if image, err := resolveChannel(ctx, api, "kube-node", "", "stable"); err == nil {
+		t.Errorf("resolveChannel() without a region = image %d, want an error naming both regions", image.ID)
+	}
+	// A channel in a single region resolves without one
+	if image, err := resolveChannel(ctx, api, "kube-node", "", "staging"); err != nil || image.ID != 4 {
+		t.Errorf("resolveChannel() of staging = %v, %v, want image 4", image, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []command{
+	{"build", "build <config> [flags]", "Build an image, or every stage of a pipeline", runBuild},
+	{"validate", "validate <config> [--preflight]", "Check a config, and with --preflight that the resources it names exist", runValidate},
+	{"provision", "provision [config] --host <ip> --key <path>", "Run the provisioning scripts on an existing host", runProvision},
+	{"config", "config <show|migrate> <config> [flags]", "Print a config, or upgrade it to the current config_version", runConfig},
+	{"generate-config", "generate-config [flags]", "Write a new config interactively", runGenerateConfig},
+	{"list-images", "list-images [flags]", "List images produced by the builder, or all images with --all", runListImages},
+	{"list-flavors", "list-flavors [--region <r>] [--gpu-only]", "List VM flavors", runListFlavors},
+	{"list-regions", "list-regions", "List regions", runListRegions},
+	{"list-environments", "list-environments [--region <r>]", "List environments", runListEnvironments},
+	{"list-keypairs", "list-keypairs [--region <r>]", "List SSH keypairs", runListKeypairs},
+	{"import-keypair", "import-keypair <name> --environment <env> [--public-key <path>]", "Import an SSH public key as a keypair", runImportKeypair},
+	{"cleanup", "cleanup [--dry-run] [--expired] [--older-than <age>]", "Release leaked floating IPs and reap expired or orphaned build resources", runGC},
+	{"gc", "gc [--dry-run] [--expired] [--older-than <age>]", "Alias of cleanup", runGC},
+	{"serve", "serve [--addr :8080] [--concurrency 1]", "Run builds submitted to a REST API", runServe},
+	{"status", "status [build-id]", "Show builds in progress on this host", runStatus},
+	{"history", "history <list|show|timings> [args]", "Show past builds", runHistory},
+	{"images", "images <promote|resolve|diff|push|prune> [args]", "Manage built images", runImages},
+	{"delete-image", "delete-image <id>... [--force]", "Delete images, after confirmation", runDeleteImage},
+	{"delete-snapshot", "delete-snapshot <id>... [--force]", "Delete snapshots, after confirmation", runDeleteSnapshot},
+	{"delete-keypair", "delete-keypair <id>... [--force]", "Delete keypairs, after confirmation", runDeleteKeypair},
+	{"vm", "vm <start|stop|hard-reboot|shelve|unshelve> <id>...", "Run a power action on VMs", runVM},
+	{"prune-images", "prune-images [config] [--keep <n>]", "Delete all but the newest versions of each image name", runPruneImages},
+	{"catalog", "catalog [args]", "Write a catalog of built images", runCatalog},
+	{"inspect", "inspect <image-id>", "Show the builder metadata of an image", runInspect},
+	{"verify", "verify <artifacts-dir> [args]", "Verify the signatures of a build's artifacts", runVerify},
+}
+
+// findCommand returns the named subcommand, or nil
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage lists the subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: hyperstack-builder <command> [args]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run `hyperstack-builder <command> -h` for the flags of a command. Any command takes --debug-http to")
+	fmt.Fprintln(w, "log its API calls, or --debug-http=bodies to include their bodies.")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+const (
+	configShowUsage    = "config show <config> [--resolved] [--target <name>] [--format json|yaml]"
+	configMigrateUsage = "config migrate <config> [--dry-run]"
+)
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("usage: config <show|migrate> [args]"))
+	}
+
+	switch args[0] {
+	case "show":
+		return runConfigShow(args[1:])
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	default:
+		return withExitCode(exitConfig, fmt.Errorf("unknown config subcommand %q", args[0]))
+	}
+}
+
+// runConfigShow prints a config file, or with --resolved the config a build would use: the profiles it
+// extends merged in, the target picked, templates rendered and defaults applied
+func runConfigShow(args []string) error {
+	if len(args) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("usage: %s", configShowUsage))
+	}
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	resolved := fs.Bool("resolved", false, "print the effective config instead of the file")
+	fs.String("target", "", "resolve this target of the config (read by loadConfig)")
+	format := fs.String("format", "", "format to print the resolved config in: json or yaml (default that of the file)")
+	fs.Parse(args[1:])
+
+	if !*resolved {
+		if err := fetchConfig(args); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return withExitCode(exitConfig, err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	cfg, err := loadConfig(args, configShowUsage)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = config.FormatOf(args[0])
+	}
+	data, err := config.Encode(cfg, *format)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if *format == config.FormatJSON {
+		data = append(data, '\n')
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// runConfigMigrate upgrades a config file to the current config_version, keeping the original beside it
+// as <config>.bak
+func runConfigMigrate(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return withExitCode(exitConfig, fmt.Errorf("usage: %s", configMigrateUsage))
+	}
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the changes and the upgraded config without writing them")
+	fs.Parse(args[1:])
+	path := args[0]
+	if config.IsRemote(path) {
+		return withExitCode(exitConfig, fmt.Errorf("config migrate only upgrades local files, migrate the source of %s", path))
+	}
+
+	m, err := config.Migrate(path, &types.Config{Provisioners: provisioningScripts, Files: fileDeployments})
+	if err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("failed to migrate %s: %w", path, err))
+	}
+	if m.From == m.To {
+		fmt.Printf("%s is already at config_version %d\n", path, m.To)
+		return nil
+	}
+
+	fmt.Printf("Migrating %s from config_version %d to %d:\n", path, m.From, m.To)
+	for _, change := range m.Changes {
+		fmt.Printf("  - %s\n", change)
+	}
+	if *dryRun {
+		fmt.Println()
+		_, err := os.Stdout.Write(m.Data)
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".bak", original, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, m.Data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("Saved %s, the original is in %s.bak\n", path, path)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+)
+
+// parseIDs parses the resource IDs among args, which may come before or after the flags
+func parseIDs(fs *flag.FlagSet, args []string) ([]int, error) {
+	var ids []int
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return ids, nil
+		}
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", fs.Arg(0))
+		}
+		ids = append(ids, id)
+		args = fs.Args()[1:]
+	}
+}
+
+// stdinIsTerminal reports whether the builder can prompt, rather than reading input meant for something else
+// or waiting for input that never comes in CI
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirm asks whether to go ahead, refusing to prompt when stdin is not a terminal so scripts have to pass --force
+func confirm(prompt string) (bool, error) {
+	if !stdinIsTerminal() {
+		return false, withExitCode(exitConfig, fmt.Errorf("not asking for confirmation without a terminal, pass --force"))
+	}
+	answer := strings.ToLower(config.PromptUser(prompt+" [y/N]", ""))
+	return answer == "y" || answer == "yes", nil
+}
+
+func runDeleteImage(args []string) error {
+	fs := flag.NewFlagSet("delete-image", flag.ExitOnError)
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	ids, err := parseIDs(fs, args)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if len(ids) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("usage: delete-image <id>... [--force]"))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tREGION\tCHANNEL")
+	for _, id := range ids {
+		image, err := hyperstackClient.GetImage(ctx, id)
+		if err != nil {
+			return apiFailure(err)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", image.ID, image.Name, image.RegionName, orDash(imageChannel(image)))
+	}
+	w.Flush()
+
+	if !*force {
+		ok, err := confirm(fmt.Sprintf("Delete %d image(s)?", len(ids)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			slog.Info("Nothing was deleted")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := hyperstackClient.DeleteImage(ctx, id); err != nil {
+			slog.Error("Failed to delete image", "image_id", id, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Deleted image", "image_id", id)
+	}
+	if failed > 0 {
+		return withExitCode(exitAPI, fmt.Errorf("%d of %d images could not be deleted", failed, len(ids)))
+	}
+	return nil
+}
+
+func runDeleteSnapshot(args []string) error {
+	fs := flag.NewFlagSet("delete-snapshot", flag.ExitOnError)
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	ids, err := parseIDs(fs, args)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if len(ids) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("usage: delete-snapshot <id>... [--force]"))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tVM\tCREATED")
+	for _, id := range ids {
+		snapshot, err := hyperstackClient.GetSnapshot(ctx, id)
+		if err != nil {
+			return apiFailure(err)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", snapshot.ID, snapshot.Name, snapshot.Status, snapshot.VMID, orDash(snapshot.CreatedAt))
+	}
+	w.Flush()
+
+	if !*force {
+		ok, err := confirm(fmt.Sprintf("Delete %d snapshot(s)?", len(ids)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			slog.Info("Nothing was deleted")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := hyperstackClient.DeleteSnapshot(ctx, id); err != nil {
+			slog.Error("Failed to delete snapshot", "snapshot_id", id, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Deleted snapshot", "snapshot_id", id)
+	}
+	if failed > 0 {
+		return withExitCode(exitAPI, fmt.Errorf("%d of %d snapshots could not be deleted", failed, len(ids)))
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// printJSON prints v as indented JSON
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// environmentRegion returns the region of an environment, falling back to the region its name contains
+// when the API leaves it out
+func environmentRegion(env types.Environment, regions []types.Region) string {
+	if env.Region != "" {
+		return env.Region
+	}
+	for _, region := range regions {
+		if strings.Contains(env.Name, region.Name) {
+			return region.Name
+		}
+	}
+	return ""
+}
+
+func runListFlavors(args []string) error {
+	fs := flag.NewFlagSet("list-flavors", flag.ExitOnError)
+	region := fs.String("region", "", "only list flavors in this region")
+	gpuOnly := fs.Bool("gpu-only", false, "only list flavors with GPUs")
+	asJSON := fs.Bool("json", false, "print the flavors as JSON")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	flavors, err := hyperstackClient.ListFlavorsInRegion(ctx, *region)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+
+	var listed []types.Flavor
+	for _, flavor := range flavors {
+		if *region != "" && flavor.RegionName != *region {
+			continue
+		}
+		if *gpuOnly && flavor.GPUCount == 0 {
+			continue
+		}
+		listed = append(listed, flavor)
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		if listed[i].RegionName != listed[j].RegionName {
+			return listed[i].RegionName < listed[j].RegionName
+		}
+		return listed[i].Name < listed[j].Name
+	})
+
+	if *asJSON {
+		return printJSON(listed)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREGION\tGPU\tGPUS\tCPUS\tRAM (GB)\tDISK (GB)")
+	for _, flavor := range listed {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%g\t%d\n", flavor.Name, flavor.RegionName, orDash(flavor.GPU), flavor.GPUCount, flavor.CPU, flavor.RAM, flavor.Disk)
+	}
+	return w.Flush()
+}
+
+func runListRegions(args []string) error {
+	fs := flag.NewFlagSet("list-regions", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the regions as JSON")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	regions, err := hyperstackClient.ListRegions(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Name < regions[j].Name })
+
+	if *asJSON {
+		return printJSON(regions)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, region := range regions {
+		fmt.Fprintf(w, "%d\t%s\n", region.ID, region.Name)
+	}
+	return w.Flush()
+}
+
+func runListEnvironments(args []string) error {
+	fs := flag.NewFlagSet("list-environments", flag.ExitOnError)
+	region := fs.String("region", "", "only list environments in this region")
+	asJSON := fs.Bool("json", false, "print the environments as JSON")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	environments, err := hyperstackClient.ListEnvironments(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	regions, err := hyperstackClient.ListRegions(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+
+	var listed []types.Environment
+	for _, env := range environments {
+		env.Region = environmentRegion(env, regions)
+		if *region != "" && env.Region != *region {
+			continue
+		}
+		listed = append(listed, env)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+
+	if *asJSON {
+		return printJSON(listed)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tREGION")
+	for _, env := range listed {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", env.ID, env.Name, orDash(env.Region))
+	}
+	return w.Flush()
+}
+
+func runListKeypairs(args []string) error {
+	fs := flag.NewFlagSet("list-keypairs", flag.ExitOnError)
+	region := fs.String("region", "", "only list keypairs of environments in this region")
+	asJSON := fs.Bool("json", false, "print the keypairs as JSON")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	keypairs, err := hyperstackClient.ListKeypairs(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	environments, err := hyperstackClient.ListEnvironments(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	regions, err := hyperstackClient.ListRegions(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	// Keypairs only name their environment, so look its region up
+	envRegions := make(map[string]string, len(environments))
+	for _, env := range environments {
+		envRegions[env.Name] = environmentRegion(env, regions)
+	}
+
+	var listed []types.Keypair
+	for _, kp := range keypairs {
+		if kp.Environment.Region == "" {
+			kp.Environment.Region = envRegions[kp.Environment.Name]
+		}
+		if *region != "" && kp.Environment.Region != *region {
+			continue
+		}
+		listed = append(listed, kp)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+
+	if *asJSON {
+		return printJSON(listed)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT\tREGION\tFINGERPRINT")
+	for _, kp := range listed {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", kp.ID, kp.Name, kp.Environment.Name, orDash(kp.Environment.Region), kp.Fingerprint)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+)
+
+// Exit codes, documented in the README so CI can tell failures worth retrying from ones that are not
+const (
+	exitFailure      = 1  // Anything not covered below
+	exitConfig       = 2  // Bad arguments, an invalid config or one naming resources that don't exist
+	exitAPI          = 3  // The Hyperstack API failed or refused a request, or the flavor is out of stock or over quota
+	exitVMTimeout    = 4  // The build VM did not become ready or reachable over SSH in time
+	exitProvisioning = 5  // A provisioning script, file deployment or compliance scan failed
+	exitSnapshot     = 6  // The snapshot could not be created or did not become ready
+	exitImage        = 7  // The image could not be created or did not become ready
+	exitCleanup      = 8  // Resources could not be deleted; any image that was built is usable
+	exitTest         = 9  // The launch or join test failed on the new image
+	exitBusy         = 10 // Another build of the same image name and region is in progress
+	exitBudget       = 11 // The build ran past max_build_minutes or max_build_cost and was aborted
+)
+
+// phaseExitCodes maps the phase a build failed in to its exit code
+var phaseExitCodes = map[string]int{
+	"create-vm":   exitAPI,
+	"wait-vm":     exitVMTimeout,
+	"provision":   exitProvisioning,
+	"compliance":  exitProvisioning,
+	"snapshot":    exitSnapshot,
+	"image":       exitImage,
+	"cleanup":     exitCleanup,
+	"launch-test": exitTest,
+	"join-test":   exitTest,
+}
+
+// exitError is a command error with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode makes the process exit with code if err ends the command
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for an error that ended a command
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if errors.Is(err, builder.ErrBudgetExceeded) {
+		return exitBudget
+	}
+	if errors.Is(err, builder.ErrPreflight) {
+		return exitConfig
+	}
+	if errors.Is(err, client.ErrFlavorOutOfStock) || errors.Is(err, client.ErrQuotaExceeded) {
+		return exitAPI
+	}
+	if errors.Is(err, builder.ErrBuildInProgress) {
+		return exitBusy
+	}
+	if errors.Is(err, builder.ErrVMUnreachable) {
+		return exitVMTimeout
+	}
+	var phaseErr *builder.PhaseError
+	if errors.As(err, &phaseErr) {
+		if code, ok := phaseExitCodes[phaseErr.Phase]; ok {
+			return code
+		}
+	}
+	if errors.Is(err, client.ErrNotFound) {
+		return exitConfig
+	}
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return exitAPI
+	}
+	return exitFailure
+}
+
+// apiFailure gives an error from an API call its exit code: exitConfig when it names a resource that
+// doesn't exist, exitAPI otherwise
+func apiFailure(err error) error {
+	if errors.Is(err, client.ErrNotFound) {
+		return withExitCode(exitConfig, err)
+	}
+	return withExitCode(exitAPI, err)
+}
+
+// childExitCode returns the exit code of a failed child build, or exitFailure if it did not run
+func childExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return exitFailure
+}
+
+// commonExitCode returns the exit code shared by all the failed child builds, or exitFailure if they differ
+func commonExitCode(codes []int) int {
+	if len(codes) == 0 {
+		return exitFailure
+	}
+	for _, code := range codes[1:] {
+		if code != codes[0] {
+			return exitFailure
+		}
+	}
+	return codes[0]
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/audit"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// snapshotLabels returns snapshot labels as strings; the API returns either strings or label objects
+func snapshotLabels(snapshot types.Snapshot) []string {
+	labels := make([]string, 0, len(snapshot.Labels))
+	for _, l := range snapshot.Labels {
+		switch v := l.(type) {
+		case string:
+			labels = append(labels, v)
+		case map[string]any:
+			if label, ok := v["label"].(string); ok {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// hasLabel reports whether a VM carries the given label
+func hasLabel(vm types.VMInstance, label string) bool {
+	for _, l := range vm.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// newClientFromEnv creates an API client with the API key of the environment
+func newClientFromEnv() (*client.HyperstackClient, error) {
+	return newClient(nil)
+}
+
+// newClient returns an API client authenticated with the API key of the environment or, failing that, of
+// cfg, which may be nil
+func newClient(cfg *types.Config) (*client.HyperstackClient, error) {
+	key, err := apiKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, withExitCode(exitConfig, fmt.Errorf("HYPERSTACK_API_KEY environment variable is required, or an API key file, command or Vault secret"))
+	}
+	hyperstackClient := client.New(key)
+	if err := hyperstackClient.Configure(apiSettings(cfg)); err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+
+	if path := os.Getenv("HYPERSTACK_BUILDER_AUDIT_LOG"); path != "" {
+		auditLog, err := audit.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		hyperstackClient.Audit = auditLog
+	}
+	return hyperstackClient, nil
+}
+
+// apiSettings is how to reach the API: the api section of cfg, which may be nil, with HYPERSTACK_API_URL,
+// HYPERSTACK_API_TIMEOUT, HYPERSTACK_API_PROXY and HYPERSTACK_API_CA_BUNDLE overriding its fields
+func apiSettings(cfg *types.Config) types.APIConfig {
+	var settings types.APIConfig
+	if cfg != nil && cfg.API != nil {
+		settings = *cfg.API
+	}
+	overrides := []struct {
+		env   string
+		field *string
+	}{
+		{"HYPERSTACK_API_URL", &settings.BaseURL},
+		{"HYPERSTACK_API_TIMEOUT", &settings.Timeout},
+		{"HYPERSTACK_API_PROXY", &settings.Proxy},
+		{"HYPERSTACK_API_CA_BUNDLE", &settings.CABundle},
+	}
+	for _, o := range overrides {
+		if value := os.Getenv(o.env); value != "" {
+			*o.field = value
+		}
+	}
+	return settings
+}
+
+// leakedFloatingIP reports whether a builder VM holds a floating IP it is no longer using
+func leakedFloatingIP(vm types.VMInstance) bool {
+	if vm.FloatingIP == "" {
+		return false
+	}
+	if vm.FloatingIPStatus != "ATTACHED" {
+		return true
+	}
+	switch vm.Status {
+	case "SHUTOFF", "ERROR", "DELETING":
+		return true
+	}
+	return false
+}
+
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be cleaned up")
+	expiredMode := fs.Bool("expired", false, "also delete VMs and snapshots whose hsb.expires_at label has passed")
+	olderThan := fs.String("older-than", "", "also delete build VMs and snapshots created longer ago than this, e.g. 12h or 2d")
+	namePrefix := fs.String("name-prefix", defaultVMName, "with --older-than, also treat unlabeled VMs and snapshots named <prefix>-... as build resources")
+	fs.Parse(args)
+
+	var rules []reapRule
+	if *expiredMode {
+		rules = append(rules, expiredRule(time.Now()))
+	}
+	if *olderThan != "" {
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			return withExitCode(exitConfig, err)
+		}
+		rules = append(rules, orphanRule(time.Now().Add(-age), *olderThan, *namePrefix))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	vms, err := hyperstackClient.ListVMs(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	if len(rules) > 0 {
+		failed, err = reap(ctx, hyperstackClient, vms, *dryRun, rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	released := 0
+	for _, vm := range vms {
+		if !hasLabel(vm, labels.Builder) || !leakedFloatingIP(vm) {
+			continue
+		}
+
+		slog.Info("Leaked floating IP", "floating_ip", vm.FloatingIP, "vm_name", vm.Name, "vm_id", vm.ID,
+			"status", vm.Status, "floating_ip_status", vm.FloatingIPStatus)
+		if *dryRun {
+			continue
+		}
+		if err := hyperstackClient.DetachFloatingIP(ctx, vm.ID); err != nil {
+			slog.Warn("Failed to release floating IP", "vm_id", vm.ID, "floating_ip", vm.FloatingIP, "error", err)
+			failed++
+			continue
+		}
+		released++
+	}
+
+	if *dryRun {
+		slog.Info("Dry run, nothing was released")
+	} else {
+		slog.Info("Released floating IPs", "count", released)
+	}
+	if failed > 0 {
+		return withExitCode(exitCleanup, fmt.Errorf("%d resources could not be cleaned up", failed))
+	}
+	return nil
+}
+
+// defaultVMName is the vm_name suggested by generate-config, which build VMs and snapshots are named after
+const defaultVMName = "thunder-build-vm"
+
+// reapRule returns why a VM or snapshot should be deleted, or "" to leave it alone
+type reapRule func(name string, resourceLabels []string, createdAt string) string
+
+// expiredRule matches resources whose TTL label has passed
+func expiredRule(now time.Time) reapRule {
+	return func(name string, resourceLabels []string, createdAt string) string {
+		if labels.Expired(resourceLabels, now) {
+			return "expired"
+		}
+		return ""
+	}
+}
+
+// orphanRule matches build resources created before cutoff. Resources are recognized by the builder label, or
+// for ones created before it was added, by a name starting with namePrefix.
+func orphanRule(cutoff time.Time, age, namePrefix string) reapRule {
+	return func(name string, resourceLabels []string, createdAt string) string {
+		if !slices.Contains(resourceLabels, labels.Builder) && (namePrefix == "" || !strings.HasPrefix(name, namePrefix+"-")) {
+			return ""
+		}
+		created, ok := parseTimestamp(createdAt)
+		if !ok || created.After(cutoff) {
+			return ""
+		}
+		return "older than " + age
+	}
+}
+
+// matchRules returns the reason of the first rule matching a resource, or ""
+func matchRules(rules []reapRule, name string, resourceLabels []string, createdAt string) string {
+	for _, rule := range rules {
+		if reason := rule(name, resourceLabels, createdAt); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// reap deletes the VMs and snapshots matched by any of the rules, returning how many could not be deleted
+func reap(ctx context.Context, hyperstackClient builder.API, vms []types.VMInstance, dryRun bool, rules []reapRule) (int, error) {
+	failed := 0
+
+	for _, vm := range vms {
+		reason := matchRules(rules, vm.Name, vm.Labels, vm.CreatedAt)
+		if reason == "" {
+			continue
+		}
+		slog.Info("Reaping VM", "vm_name", vm.Name, "vm_id", vm.ID, "status", vm.Status, "created_at", vm.CreatedAt, "reason", reason)
+		if !dryRun && builder.TeardownVM(ctx, hyperstackClient, vm.ID) != nil {
+			failed++
+		}
+	}
+
+	snapshots, err := hyperstackClient.ListSnapshots(ctx)
+	if err != nil {
+		return failed, err
+	}
+	for _, snapshot := range snapshots {
+		reason := matchRules(rules, snapshot.Name, snapshotLabels(snapshot), snapshot.CreatedAt)
+		if reason == "" {
+			continue
+		}
+		slog.Info("Reaping snapshot", "snapshot_name", snapshot.Name, "snapshot_id", snapshot.ID, "status", snapshot.Status, "created_at", snapshot.CreatedAt, "reason", reason)
+		if dryRun {
+			continue
+		}
+		if err := hyperstackClient.DeleteSnapshot(ctx, snapshot.ID); err != nil {
+			slog.Warn("Failed to delete snapshot", "snapshot_id", snapshot.ID, "error", err)
+			failed++
+		}
+	}
+
+	return failed, nil
+}
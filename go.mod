@@ -2,6 +2,10 @@ module github.com/thundernetes/packer/kube-image/providers/hyperstack
 
 go 1.21
 
-require golang.org/x/crypto v0.28.0
+require (
+	golang.org/x/crypto v0.28.0
+	golang.org/x/term v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require golang.org/x/sys v0.26.0 // indirect
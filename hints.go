@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/hints"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+)
+
+// fatal logs a failure and exits with the code for it, explaining recognized failures with a suggested fix
+func fatal(msg string, err error) {
+	removePrivateKeys()
+	hint := hints.Classify(err)
+	if hint == nil {
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg, "error", err, "error_class", hint.Class)
+		fmt.Fprintf(os.Stderr, "\n%s\nHint: %s\n", hint.Message, hint.Remedy)
+	}
+
+	// os.Exit skips main, which would end the command's span and export the trace of the failure
+	tracing.EndAll(err)
+	tracing.Flush()
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+)
+
+func runHistory(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: history <list|show|timings> [args]")
+	}
+
+	store := history.Default()
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("history list", flag.ExitOnError)
+		imageName := fs.String("image", "", "only show builds of this image name")
+		status := fs.String("status", "", "only show builds with this status (succeeded, failed)")
+		user := fs.String("user", "", "only show builds run by this user")
+		imageID := fs.Int("image-id", 0, "only show the builds that produced this image ID")
+		since := fs.String("since", "", "only show builds started since this date (2006-01-02) or this long ago (e.g. 30d)")
+		asJSON := fs.Bool("json", false, "print the full records as JSON")
+		fs.Parse(args[1:])
+
+		var after time.Time
+		if *since != "" {
+			var err error
+			if after, err = parseSince(*since); err != nil {
+				return withExitCode(exitConfig, err)
+			}
+		}
+
+		records, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		var listed []history.Record
+		for _, rec := range records {
+			if *imageName != "" && rec.Config.ImageName != *imageName {
+				continue
+			}
+			if *status != "" && rec.Status != *status {
+				continue
+			}
+			if *user != "" && rec.User != *user {
+				continue
+			}
+			if *imageID != 0 && rec.ImageID != *imageID {
+				continue
+			}
+			if rec.StartedAt.Before(after) {
+				continue
+			}
+			listed = append(listed, rec)
+		}
+
+		if *asJSON {
+			if listed == nil {
+				listed = []history.Record{}
+			}
+			return printJSON(listed)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tSTATUS\tIMAGE\tIMAGE ID\tUSER\tCOST")
+		for _, rec := range listed {
+			name := rec.ImageName
+			if name == "" {
+				name = fmt.Sprintf("%s_%s", rec.Config.ImageName, rec.Config.ImageVersion)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%.2f\n",
+				rec.ID, rec.StartedAt.Local().Format(time.DateTime), rec.Duration.Round(time.Second),
+				rec.Status, name, rec.ImageID, orDash(rec.User), rec.Cost)
+		}
+		return w.Flush()
+
+	case "show":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: history show <id>")
+		}
+		rec, err := store.Get(strings.TrimSpace(args[1]))
+		if err != nil {
+			return err
+		}
+		return printJSON(rec)
+
+	case "timings":
+		return runHistoryTimings(store, args[1:])
+
+	default:
+		return fmt.Errorf("unknown history command: %s", args[0])
+	}
+}
+
+// parseSince reads a --since value: a date, an RFC 3339 time, or an age such as 168h or 30d
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected a date (2006-01-02), an RFC 3339 time or an age (30d)", s)
+	}
+	return time.Now().Add(-age), nil
+}
+
+// phaseOrder is the order build phases run in, used for the timings columns
+var phaseOrder = []string{"create-vm", "wait-vm", "provision", "compliance", "snapshot", "image", "cleanup", "launch-test", "join-test", "finalize"}
+
+// runHistoryTimings prints the phase or provisioning script durations of past builds, one row per build, so
+// slowdowns can be traced to a base image
+func runHistoryTimings(store *history.Store, args []string) error {
+	fs := flag.NewFlagSet("history timings", flag.ExitOnError)
+	imageName := fs.String("image", "", "only show builds of this image name")
+	baseImage := fs.String("base-image", "", "only show builds from this base image")
+	steps := fs.Bool("steps", false, "show provisioning script durations instead of phases")
+	limit := fs.Int("limit", 20, "show at most this many of the most recent builds")
+	fs.Parse(args)
+
+	records, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	var rows []history.Record
+	for _, rec := range records {
+		if *imageName != "" && rec.Config.ImageName != *imageName {
+			continue
+		}
+		if *baseImage != "" && rec.Config.BaseImageName != *baseImage {
+			continue
+		}
+		rows = append(rows, rec)
+	}
+	if *limit > 0 && len(rows) > *limit {
+		rows = rows[len(rows)-*limit:]
+	}
+
+	durations := func(rec history.Record) map[string]time.Duration {
+		if *steps {
+			return rec.Steps
+		}
+		return rec.Phases
+	}
+
+	// Phases keep their run order; scripts keep the order of the most recent build that ran them
+	var columns []string
+	seen := map[string]bool{}
+	if !*steps {
+		for _, phase := range phaseOrder {
+			for _, rec := range rows {
+				if _, ok := rec.Phases[phase]; ok {
+					columns = append(columns, phase)
+					break
+				}
+			}
+		}
+	} else {
+		for i := len(rows) - 1; i >= 0; i-- {
+			for _, script := range rows[i].Scripts {
+				if _, ok := rows[i].Steps[script]; ok && !seen[script] {
+					seen[script] = true
+					columns = append(columns, script)
+				}
+			}
+		}
+	}
+
+	header := strings.Join(columns, "\t")
+	if !*steps {
+		header = strings.ToUpper(header)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tSTARTED\tBASE IMAGE\tSTATUS\t%s\n", header)
+	for _, rec := range rows {
+		d := durations(rec)
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = "-"
+			if v, ok := d[column]; ok {
+				cells[i] = v.Round(time.Second).String()
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", rec.ID, rec.StartedAt.Local().Format(time.DateTime),
+			orDash(rec.Config.BaseImageName), rec.Status, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/imagediff"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// imageLabels returns the plain label strings of an image
+func imageLabels(image *types.Image) []string {
+	labels := make([]string, 0, len(image.Labels))
+	for _, l := range image.Labels {
+		labels = append(labels, l.Label)
+	}
+	return labels
+}
+
+// withLabel returns labels with any label sharing the key prefix replaced by label
+func withLabel(labels []string, prefix, label string) []string {
+	return append(withoutLabel(labels, prefix), label)
+}
+
+func runImages(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: images <promote|resolve|diff|push|prune> [args]")
+	}
+
+	switch args[0] {
+	case "promote":
+		return runImagesPromote(args[1:])
+	case "resolve":
+		return runImagesResolve(args[1:])
+	case "diff":
+		return runImagesDiff(args[1:])
+	case "push":
+		return runImagesPush(args[1:])
+	case "prune":
+		return runImagesPrune(args[1:])
+	default:
+		return fmt.Errorf("unknown images command: %s", args[0])
+	}
+}
+
+func runImagesPromote(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: images promote <id> --channel <channel> [--name <new-name>]")
+	}
+
+	imageID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid image ID %q: %w", args[0], err)
+	}
+
+	fs := flag.NewFlagSet("images promote", flag.ExitOnError)
+	channel := fs.String("channel", "", "channel to promote the image to: "+strings.Join(labels.Channels, ", "))
+	newName := fs.String("name", "", "optionally rename the image")
+	fs.Parse(args[1:])
+
+	if !validChannel(*channel) {
+		return fmt.Errorf("unknown channel %q, expected one of: %s", *channel, strings.Join(labels.Channels, ", "))
+	}
+
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	return promoteImage(context.Background(), hyperstackClient, imageID, *channel, *newName)
+}
+
+// promoteImage moves a channel to an image, renaming it unless newName is empty
+func promoteImage(ctx context.Context, hyperstackClient builder.API, imageID int, channel, newName string) error {
+	image, err := hyperstackClient.GetImage(ctx, imageID)
+	if err != nil {
+		return err
+	}
+
+	labels := withLabel(imageLabels(image), labels.ChannelPrefix, labels.Channel(channel))
+
+	slog.Info("Promoting image", "image_name", image.Name, "image_id", image.ID, "channel", channel)
+	updated, err := hyperstackClient.UpdateImage(ctx, image.ID, newName, labels)
+	if err != nil {
+		return err
+	}
+
+	if err := demoteOthers(ctx, hyperstackClient, image, channel); err != nil {
+		return fmt.Errorf("promoted image but failed to remove previous %s images: %w", channel, err)
+	}
+
+	slog.Info("Promoted image", "image_name", updated.Name, "image_id", updated.ID)
+	return nil
+}
+
+// resolveInventory loads the inventory for an image ID (via build history) or an artifacts directory / package list path
+func resolveInventory(ref string) (*imagediff.Inventory, error) {
+	imageID, err := strconv.Atoi(ref)
+	if err != nil {
+		return imagediff.Load(ref)
+	}
+
+	rec, err := history.Default().FindByImageID(imageID)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := imagediff.Load(rec.Artifacts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load artifacts of image %d: %w", imageID, err)
+	}
+	inv.Source = rec.ImageName
+	return inv, nil
+}
+
+func runImagesDiff(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: images diff <image-id|artifacts-dir|packages.txt> <image-id|artifacts-dir|packages.txt> [--json]")
+	}
+
+	fs := flag.NewFlagSet("images diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the diff as JSON instead of markdown")
+	fs.Parse(args[2:])
+
+	from, err := resolveInventory(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := resolveInventory(args[1])
+	if err != nil {
+		return err
+	}
+
+	result := imagediff.Diff(from, to)
+	if *asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	result.WriteMarkdown(os.Stdout)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metadata"
+)
+
+func runInspect(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: inspect <image-id>")
+	}
+
+	imageID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid image ID %q: %w", args[0], err)
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	image, err := hyperstackClient.GetImage(ctx, imageID)
+	if err != nil {
+		return err
+	}
+
+	meta, err := metadata.FromImage(image)
+	if err != nil {
+		return fmt.Errorf("image %s (ID: %d) has no builder metadata: %w", image.Name, image.ID, err)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
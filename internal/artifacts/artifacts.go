@@ -0,0 +1,168 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRoot is the directory under which per-build artifact directories are created
+const DefaultRoot = "artifacts"
+
+// Dir is the artifact directory of a single build
+type Dir struct {
+	Path  string
+	steps int
+}
+
+// PathFor returns the artifact directory of a build of imageName at imageVersion
+func PathFor(root, imageName, imageVersion string) string {
+	if root == "" {
+		root = DefaultRoot
+	}
+	return filepath.Join(root, fmt.Sprintf("%s-%s", imageName, imageVersion))
+}
+
+// New creates the artifact directory artifacts/<image>-<version>. The directory of an earlier build of the
+// same version is moved aside to <dir>.<time it was last written>, so the logs and collected files of
+// different attempts don't mix.
+func New(root, imageName, imageVersion string) (*Dir, error) {
+	path := PathFor(root, imageName, imageVersion)
+	if err := moveAside(path); err != nil {
+		return nil, err
+	}
+	return Reuse(root, imageName, imageVersion)
+}
+
+// Reuse creates the artifact directory, or keeps the one of an earlier build of the same version, e.g. for a
+// build resumed after provisioning that still needs the files it collected
+func Reuse(root, imageName, imageVersion string) (*Dir, error) {
+	path := PathFor(root, imageName, imageVersion)
+	for _, sub := range []string{"logs", "collected"} {
+		if err := os.MkdirAll(filepath.Join(path, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create artifacts directory: %w", err)
+		}
+	}
+	return &Dir{Path: path}, nil
+}
+
+// moveAside renames an existing directory at path to path.<modification time>
+func moveAside(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check artifacts directory: %w", err)
+	}
+	stamp := path + "." + info.ModTime().UTC().Format("20060102-150405")
+	previous := stamp
+	for i := 2; ; i++ {
+		if _, err := os.Stat(previous); os.IsNotExist(err) {
+			break
+		}
+		previous = fmt.Sprintf("%s-%d", stamp, i)
+	}
+	if err := os.Rename(path, previous); err != nil {
+		return fmt.Errorf("failed to move aside the artifacts of an earlier build: %w", err)
+	}
+	return nil
+}
+
+// File returns the path of a file at the top level of the artifact directory
+func (d *Dir) File(name string) string {
+	return filepath.Join(d.Path, name)
+}
+
+// StepLog creates the log file for the next provisioning step, numbered in execution order
+func (d *Dir) StepLog(step string) (*os.File, error) {
+	d.steps++
+	name := fmt.Sprintf("%02d-%s.log", d.steps, sanitize(step))
+	f, err := os.Create(filepath.Join(d.Path, "logs", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create step log: %w", err)
+	}
+	return f, nil
+}
+
+// CollectedDir returns the directory holding files collected from the build VM
+func CollectedDir(dir string) string {
+	return filepath.Join(dir, "collected")
+}
+
+// CollectedPath returns the path of a file collected from the build VM in the artifact directory at dir
+func CollectedPath(dir, name string) string {
+	return filepath.Join(CollectedDir(dir), sanitize(name))
+}
+
+// WriteCollected stores a file collected from the build VM
+func (d *Dir) WriteCollected(name string, data []byte) error {
+	return os.WriteFile(CollectedPath(d.Path, name), data, 0644)
+}
+
+// Archive writes <dir>.tar.gz next to the artifact directory and returns its path
+func (d *Dir) Archive() (string, error) {
+	archivePath := d.Path + ".tar.gz"
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	base := filepath.Dir(d.Path)
+	err = filepath.Walk(d.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to archive artifacts: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// sanitize makes a step or file name safe to use as a file name
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry records one Hyperstack API call
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Endpoint   string    `json:"endpoint"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	// ResourceIDs are the IDs in the endpoint path plus, for mutating calls, the IDs in the response
+	ResourceIDs []int `json:"resource_ids,omitempty"`
+}
+
+// Log is an append-only JSON lines file of API calls, safe for concurrent use
+type Log struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens or creates the audit log at path for appending
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{f: f}, nil
+}
+
+// Record appends an entry, one line per call so a crash never leaves a partial record behind
+func (l *Log) Record(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// ResponseIDs collects the values of "id" fields anywhere in a JSON response body
+func ResponseIDs(body []byte) []int {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+	seen := make(map[int]bool)
+	collectIDs(v, seen)
+
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func collectIDs(v any, seen map[int]bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if id, ok := value.(float64); ok && key == "id" {
+				seen[int(id)] = true
+				continue
+			}
+			collectIDs(value, seen)
+		}
+	case []any:
+		for _, value := range v {
+			collectIDs(value, seen)
+		}
+	}
+}
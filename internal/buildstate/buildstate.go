@@ -0,0 +1,164 @@
+package buildstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// State is the progress of an in-flight build, rewritten as the build advances
+type State struct {
+	BuildID        string    `json:"build_id"`
+	ImageName      string    `json:"image_name"`
+	ImageVersion   string    `json:"image_version"`
+	PID            int       `json:"pid"`
+	Hostname       string    `json:"hostname"`
+	StartedAt      time.Time `json:"started_at"`
+	Phase          string    `json:"phase,omitempty"`
+	PhaseStartedAt time.Time `json:"phase_started_at,omitempty"`
+	VMID           int       `json:"vm_id,omitempty"`
+	VMIP           string    `json:"vm_ip,omitempty"`
+	SnapshotID     int       `json:"snapshot_id,omitempty"`
+	ImageID        int       `json:"image_id,omitempty"`
+	ArtifactsDir   string    `json:"artifacts_dir,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// File is the state file of a build run by this process
+type File struct {
+	Path string
+
+	mu    sync.Mutex
+	state State
+}
+
+// DefaultDir returns the directory holding state files, overridable with HYPERSTACK_BUILDER_STATE_DIR
+func DefaultDir() string {
+	if dir := os.Getenv("HYPERSTACK_BUILDER_STATE_DIR"); dir != "" {
+		return dir
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".hyperstack-builder", "builds")
+	}
+	return filepath.Join(homeDir, ".hyperstack-builder", "builds")
+}
+
+// Create writes the initial state of a build, filling in the process and host
+func Create(dir string, state State) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	state.PID = os.Getpid()
+	state.Hostname, _ = os.Hostname()
+
+	f := &File{Path: filepath.Join(dir, state.BuildID+".json"), state: state}
+	if err := f.write(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update applies fn to the state and rewrites the file
+func (f *File) Update(fn func(*State)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(&f.state)
+	return f.write()
+}
+
+// write replaces the file atomically so readers never see a partial state
+func (f *File) write() error {
+	f.state.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(f.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build state: %w", err)
+	}
+	if err := os.Rename(tmp, f.Path); err != nil {
+		return fmt.Errorf("failed to write build state: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the state file once the build has finished
+func (f *File) Remove() error {
+	if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove build state: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the state file of a build that is no longer running
+func Delete(dir, buildID string) error {
+	if err := os.Remove(filepath.Join(dir, buildID+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove build state: %w", err)
+	}
+	return nil
+}
+
+// List returns the states in dir, oldest build first
+func List(dir string) ([]State, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var states []State
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var state State
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].StartedAt.Before(states[j].StartedAt) })
+	return states, nil
+}
+
+// Alive reports whether the build's process is still running. Builds on other hosts are assumed alive.
+func (s *State) Alive() bool {
+	hostname, _ := os.Hostname()
+	if s.Hostname != hostname {
+		return true
+	}
+	process, err := os.FindProcess(s.PID)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// Interrupted returns the builds of an image whose process died before they finished, oldest first
+func Interrupted(dir, imageName string) ([]State, error) {
+	states, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var interrupted []State
+	for _, s := range states {
+		if s.ImageName == imageName && !s.Alive() {
+			interrupted = append(interrupted, s)
+		}
+	}
+	return interrupted, nil
+}
@@ -0,0 +1,117 @@
+package capi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// APIVersion is the Cluster API Provider OpenStack version the templates are written for
+const APIVersion = "infrastructure.cluster.x-k8s.io/v1beta1"
+
+// Label and annotation keys stamped on every template
+const (
+	RegionLabel         = "hyperstack.cloud/region"
+	ImageVersionLabel   = "hyperstack.cloud/image-version"
+	ImageIDAnnotation   = "hyperstack.cloud/image-id"
+	ImageNameAnnotation = "hyperstack.cloud/image-name"
+)
+
+// Template is one OpenStackMachineTemplate, pointing machines in a region at a built image
+type Template struct {
+	Name       string
+	Namespace  string
+	Region     string
+	Flavor     string
+	SSHKeyName string
+	ImageID    int
+	ImageName  string
+	Labels     map[string]string
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Name returns a DNS-1123 template name for an image version. Machine templates are immutable, so every
+// version gets its own template and rolling nodes is a matter of pointing the MachineDeployment at it.
+func Name(prefix, version, region string) string {
+	parts := []string{prefix, version}
+	if region != "" {
+		parts = append(parts, region)
+	}
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-")
+	}
+	return name
+}
+
+// Render writes the templates as a multi-document YAML stream
+func Render(templates []Template) []byte {
+	var b strings.Builder
+	for i, t := range templates {
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		fmt.Fprintf(&b, "apiVersion: %s\n", APIVersion)
+		b.WriteString("kind: OpenStackMachineTemplate\n")
+		b.WriteString("metadata:\n")
+		fmt.Fprintf(&b, "  name: %s\n", quote(t.Name))
+		if t.Namespace != "" {
+			fmt.Fprintf(&b, "  namespace: %s\n", quote(t.Namespace))
+		}
+		writeMap(&b, "  ", "labels", t.Labels)
+		writeMap(&b, "  ", "annotations", map[string]string{
+			ImageIDAnnotation:   strconv.Itoa(t.ImageID),
+			ImageNameAnnotation: t.ImageName,
+		})
+		b.WriteString("spec:\n")
+		b.WriteString("  template:\n")
+		b.WriteString("    spec:\n")
+		fmt.Fprintf(&b, "      flavor: %s\n", quote(t.Flavor))
+		b.WriteString("      image:\n")
+		b.WriteString("        filter:\n")
+		fmt.Fprintf(&b, "          name: %s\n", quote(t.ImageName))
+		if t.SSHKeyName != "" {
+			fmt.Fprintf(&b, "      sshKeyName: %s\n", quote(t.SSHKeyName))
+		}
+	}
+	return []byte(b.String())
+}
+
+// Write renders the templates to path, creating its directory
+func Write(path string, templates []Template) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, Render(templates), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeMap writes a sorted string map under key, omitting it when empty
+func writeMap(b *strings.Builder, indent, key string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "%s%s:\n", indent, key)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s  %s: %s\n", indent, quote(k), quote(m[k]))
+	}
+}
+
+// quote returns s as a double-quoted YAML scalar
+func quote(s string) string {
+	return strconv.Quote(s)
+}
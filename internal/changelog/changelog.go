@@ -0,0 +1,177 @@
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/imagediff"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// ignoredConfigFields change on every build and are left out of the config diff
+var ignoredConfigFields = map[string]bool{
+	"image_version": true,
+	"vm_name":       true,
+}
+
+// ConfigChange is a top-level config field whose value differs between two builds
+type ConfigChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Changelog describes what changed in a build since the previous successful build of the same image name
+type Changelog struct {
+	ImageName        string            `json:"image_name"`
+	FromVersion      string            `json:"from_version"`
+	ToVersion        string            `json:"to_version"`
+	FromBuildID      string            `json:"from_build_id"`
+	FromImageID      int               `json:"from_image_id,omitempty"`
+	Config           []ConfigChange    `json:"config,omitempty"`
+	ScriptsAdded     []string          `json:"scripts_added,omitempty"`
+	ScriptsRemoved   []string          `json:"scripts_removed,omitempty"`
+	ScriptsReordered bool              `json:"scripts_reordered,omitempty"`
+	Packages         *imagediff.Result `json:"packages,omitempty"`
+}
+
+// Previous returns the most recent successful build of the image name in the records, or nil
+func Previous(records []history.Record, imageName string) *history.Record {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Status == history.StatusSucceeded && records[i].Config.ImageName == imageName {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// New compares a build against the previous one. Either inventory may be nil if its package list was not collected.
+func New(prev *history.Record, cfg *types.Config, scripts []string, from, to *imagediff.Inventory) (*Changelog, error) {
+	cl := &Changelog{
+		ImageName:   cfg.ImageName,
+		FromVersion: prev.Config.ImageVersion,
+		ToVersion:   cfg.ImageVersion,
+		FromBuildID: prev.ID,
+		FromImageID: prev.ImageID,
+	}
+
+	// History keeps redacted configs, and secrets have no place in the changelog either
+	redacted := history.Redact(cfg)
+	changes, err := diffConfig(&prev.Config, &redacted)
+	if err != nil {
+		return nil, err
+	}
+	cl.Config = changes
+
+	cl.ScriptsAdded = missing(scripts, prev.Scripts)
+	cl.ScriptsRemoved = missing(prev.Scripts, scripts)
+	if len(cl.ScriptsAdded) == 0 && len(cl.ScriptsRemoved) == 0 {
+		cl.ScriptsReordered = fmt.Sprint(scripts) != fmt.Sprint(prev.Scripts)
+	}
+
+	if from != nil && to != nil {
+		cl.Packages = imagediff.Diff(from, to)
+	}
+	return cl, nil
+}
+
+// diffConfig compares two configs field by field using their JSON representation
+func diffConfig(from, to *types.Config) ([]ConfigChange, error) {
+	fromFields, err := fields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := fields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range fromFields {
+		keys[k] = true
+	}
+	for k := range toFields {
+		keys[k] = true
+	}
+
+	var changes []ConfigChange
+	for k := range keys {
+		if ignoredConfigFields[k] || string(fromFields[k]) == string(toFields[k]) {
+			continue
+		}
+		changes = append(changes, ConfigChange{Field: k, From: string(fromFields[k]), To: string(toFields[k])})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func fields(cfg *types.Config) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// missing returns the entries of a that are not in b
+func missing(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, s := range b {
+		seen[s] = true
+	}
+	var result []string
+	for _, s := range a {
+		if !seen[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Empty reports whether nothing changed between the two builds
+func (c *Changelog) Empty() bool {
+	return len(c.Config) == 0 && len(c.ScriptsAdded) == 0 && len(c.ScriptsRemoved) == 0 &&
+		!c.ScriptsReordered && (c.Packages == nil || c.Packages.Empty())
+}
+
+// WriteMarkdown renders the changelog as markdown suitable for release notes
+func (c *Changelog) WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# %s %s\n\n", c.ImageName, c.ToVersion)
+	fmt.Fprintf(w, "Changes since %s (build %s).\n", c.FromVersion, c.FromBuildID)
+	if c.Empty() {
+		fmt.Fprintln(w, "\nNo changes.")
+		return
+	}
+
+	if len(c.Config) > 0 {
+		fmt.Fprintf(w, "\n## Configuration\n\n")
+		for _, change := range c.Config {
+			fmt.Fprintf(w, "- `%s`: `%s` -> `%s`\n", change.Field, change.From, change.To)
+		}
+	}
+
+	if len(c.ScriptsAdded) > 0 || len(c.ScriptsRemoved) > 0 || c.ScriptsReordered {
+		fmt.Fprintf(w, "\n## Provisioning scripts\n\n")
+		for _, s := range c.ScriptsAdded {
+			fmt.Fprintf(w, "- Added %s\n", s)
+		}
+		for _, s := range c.ScriptsRemoved {
+			fmt.Fprintf(w, "- Removed %s\n", s)
+		}
+		if c.ScriptsReordered {
+			fmt.Fprintln(w, "- Scripts reordered")
+		}
+	}
+
+	if c.Packages != nil && !c.Packages.Empty() {
+		fmt.Fprintln(w)
+		c.Packages.WriteMarkdown(w)
+	}
+}
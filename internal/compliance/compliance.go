@@ -0,0 +1,172 @@
+package compliance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported benchmark tools
+const (
+	ToolLynis = "lynis"
+	ToolOSCAP = "oscap"
+)
+
+// Report is a scored summary of a compliance benchmark run on the build VM
+type Report struct {
+	Tool     string    `json:"tool"`
+	Profile  string    `json:"profile,omitempty"`
+	Score    float64   `json:"score"`
+	MaxScore float64   `json:"max_score"`
+	Passed   int       `json:"passed"`
+	Failed   int       `json:"failed"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Finding is a failed rule or a warning raised by the benchmark
+type Finding struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Percent returns the score as a percentage of the maximum
+func (r *Report) Percent() float64 {
+	if r.MaxScore == 0 {
+		return 0
+	}
+	return r.Score / r.MaxScore * 100
+}
+
+// ParseLynis reads a lynis report file (lynis-report.dat). The hardening index is the score and every
+// warning is a failed finding; the remaining executed tests count as passed.
+func ParseLynis(data []byte) (*Report, error) {
+	report := &Report{Tool: ToolLynis, MaxScore: 100}
+	found := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "hardening_index":
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid lynis hardening_index %q: %w", value, err)
+			}
+			report.Score = score
+			found = true
+		case "tests_executed":
+			report.Passed += strings.Count(value, "|")
+		case "warning[]":
+			// Format: TEST-ID|message|details|solution|
+			fields := strings.Split(value, "|")
+			finding := Finding{ID: fields[0], Severity: "warning"}
+			if len(fields) > 1 {
+				finding.Message = fields[1]
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lynis report: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("lynis report has no hardening_index")
+	}
+
+	report.Failed = len(report.Findings)
+	report.Passed -= report.Failed
+	if report.Passed < 0 {
+		report.Passed = 0
+	}
+	return report, nil
+}
+
+// xccdfTestResult is the subset of an XCCDF TestResult element the report needs
+type xccdfTestResult struct {
+	Profile struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"profile"`
+	Scores []struct {
+		System  string  `xml:"system,attr"`
+		Maximum float64 `xml:"maximum,attr"`
+		Value   float64 `xml:",chardata"`
+	} `xml:"score"`
+	RuleResults []struct {
+		IDRef    string `xml:"idref,attr"`
+		Severity string `xml:"severity,attr"`
+		Result   string `xml:"result"`
+	} `xml:"rule-result"`
+}
+
+// ParseOSCAP reads an XCCDF results file written by `oscap xccdf eval --results`
+func ParseOSCAP(data []byte) (*Report, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("XCCDF results have no TestResult")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XCCDF results: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "TestResult" {
+			continue
+		}
+
+		var result xccdfTestResult
+		if err := decoder.DecodeElement(&result, &start); err != nil {
+			return nil, fmt.Errorf("failed to parse XCCDF TestResult: %w", err)
+		}
+		return reportFromXCCDF(&result), nil
+	}
+}
+
+func reportFromXCCDF(result *xccdfTestResult) *Report {
+	report := &Report{Tool: ToolOSCAP, Profile: result.Profile.IDRef, MaxScore: 100}
+	for _, s := range result.Scores {
+		// Prefer the default scoring model; others are used only if it's missing
+		if s.System == "urn:xccdf:scoring:default" || report.Score == 0 {
+			report.Score = s.Value
+			if s.Maximum > 0 {
+				report.MaxScore = s.Maximum
+			}
+		}
+	}
+
+	for _, r := range result.RuleResults {
+		switch r.Result {
+		case "pass", "fixed":
+			report.Passed++
+		case "fail", "error":
+			report.Failed++
+			report.Findings = append(report.Findings, Finding{ID: r.IDRef, Severity: r.Severity, Message: r.Result})
+		}
+	}
+	sort.Slice(report.Findings, func(i, j int) bool {
+		return severityRank(report.Findings[i].Severity) > severityRank(report.Findings[j].Severity)
+	})
+	return report
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package dotenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Var is one KEY=VALUE line
+type Var struct {
+	Key   string
+	Value string
+}
+
+var invalidKeyChars = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// Key upper-cases parts and joins them with underscores, replacing characters not allowed in variable names
+func Key(parts ...string) string {
+	return invalidKeyChars.ReplaceAllString(strings.ToUpper(strings.Join(parts, "_")), "_")
+}
+
+// Write writes vars in the format of GitLab's artifacts:reports:dotenv, which takes values literally
+// and has no quoting, so values must fit on one line
+func Write(path string, vars []Var) error {
+	var b strings.Builder
+	for _, v := range vars {
+		if strings.ContainsAny(v.Value, "\r\n") {
+			return fmt.Errorf("value of %s spans multiple lines", v.Key)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", v.Key, v.Value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
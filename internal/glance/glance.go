@@ -0,0 +1,121 @@
+package glance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to an OpenStack Image (Glance) v2 endpoint
+type Client struct {
+	Endpoint string
+	Token    string
+	Client   *http.Client
+}
+
+// Image is the subset of a Glance image the builder reads back
+type Image struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// New creates a Glance client for the endpoint using a Keystone token
+func New(endpoint, token string) *Client {
+	return &Client{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Token:    token,
+		// Uploads of multi-gigabyte images can take a long time
+		Client: &http.Client{Timeout: 6 * time.Hour},
+	}
+}
+
+func (c *Client) do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", c.Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.Client.Do(req)
+}
+
+// CreateImage registers a new qcow2 image with the given properties and returns it in the queued state
+func (c *Client) CreateImage(name string, properties map[string]string) (*Image, error) {
+	req := map[string]any{
+		"name":             name,
+		"disk_format":      "qcow2",
+		"container_format": "bare",
+		"visibility":       "private",
+	}
+	for k, v := range properties {
+		req[k] = v
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do("POST", "/v2/images", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Glance image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to create Glance image: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var image Image
+	if err := json.NewDecoder(resp.Body).Decode(&image); err != nil {
+		return nil, fmt.Errorf("failed to decode Glance image: %w", err)
+	}
+	return &image, nil
+}
+
+// Upload streams image data into a queued image
+func (c *Client) Upload(imageID string, data io.Reader) error {
+	resp, err := c.do("PUT", fmt.Sprintf("/v2/images/%s/file", imageID), "application/octet-stream", data)
+	if err != nil {
+		return fmt.Errorf("failed to upload Glance image data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload Glance image data: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// PropertiesFromLabels converts Hyperstack "key=value" labels into Glance image properties.
+// Keys are prefixed with "hsb_" and characters Glance tooling handles poorly are replaced.
+func PropertiesFromLabels(labels []string) map[string]string {
+	props := make(map[string]string, len(labels))
+	for _, label := range labels {
+		key, value, found := strings.Cut(label, "=")
+		if !found {
+			value = "true"
+		}
+		key = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return r + ('a' - 'A')
+			default:
+				return '_'
+			}
+		}, key)
+		props["hsb_"+key] = value
+	}
+	return props
+}
@@ -0,0 +1,113 @@
+package hcppacker
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// Platform and component type reported for Hyperstack images
+const (
+	Platform      = "hyperstack"
+	ComponentType = "hyperstack.image"
+)
+
+// Artifact is one registry artifact (an image in a region)
+type Artifact struct {
+	ExternalIdentifier string `json:"external_identifier"`
+	Region             string `json:"region"`
+}
+
+// Build mirrors the build object of the HCP Packer registry API
+type Build struct {
+	ComponentType string            `json:"component_type"`
+	Platform      string            `json:"platform"`
+	Status        string            `json:"status"`
+	Labels        map[string]string `json:"labels"`
+	Artifacts     []Artifact        `json:"artifacts"`
+}
+
+// Metadata is the registry payload for one build: the bucket, a version fingerprint and the build
+type Metadata struct {
+	BucketName   string            `json:"bucket_name"`
+	BucketLabels map[string]string `json:"bucket_labels,omitempty"`
+	Fingerprint  string            `json:"fingerprint"`
+	Build        Build             `json:"build"`
+}
+
+// PackerManifest mirrors the file written by Packer's manifest post-processor,
+// which HCP Packer tooling and existing pipelines already understand
+type PackerManifest struct {
+	Builds      []PackerManifestBuild `json:"builds"`
+	LastRunUUID string                `json:"last_run_uuid"`
+}
+
+// PackerManifestBuild is one entry of a Packer manifest
+type PackerManifestBuild struct {
+	Name          string            `json:"name"`
+	BuilderType   string            `json:"builder_type"`
+	BuildTime     int64             `json:"build_time"`
+	Files         []any             `json:"files"`
+	ArtifactID    string            `json:"artifact_id"`
+	PackerRunUUID string            `json:"packer_run_uuid"`
+	CustomData    map[string]string `json:"custom_data"`
+}
+
+// FromManifest builds registry metadata for a completed build
+func FromManifest(m *manifest.Manifest, bucketName string, bucketLabels map[string]string) *Metadata {
+	labels := map[string]string{
+		"image_name":    m.ImageName,
+		"image_version": m.ImageVersion,
+		"base_image":    m.BaseImageName,
+		"flavor":        m.FlavorName,
+		"build_id":      m.BuildID,
+	}
+
+	// Use the content hash as the fingerprint so identical inputs map to the same registry version
+	fingerprint := m.BuildID
+	if m.Lineage != nil {
+		labels["builder_version"] = m.Lineage.BuilderVersion
+		labels["base_image_id"] = strconv.Itoa(m.Lineage.BaseImageID)
+		if m.Lineage.SourceCommit != "" {
+			labels["source_commit"] = m.Lineage.SourceCommit
+		}
+		fingerprint = m.Lineage.ContentHash
+	}
+
+	return &Metadata{
+		BucketName:   bucketName,
+		BucketLabels: bucketLabels,
+		Fingerprint:  fingerprint,
+		Build: Build{
+			ComponentType: ComponentType,
+			Platform:      Platform,
+			Status:        "BUILD_DONE",
+			Labels:        labels,
+			Artifacts: []Artifact{
+				{ExternalIdentifier: strconv.Itoa(m.ImageID), Region: m.Region},
+			},
+		},
+	}
+}
+
+// PackerManifestFromManifest renders a Packer post-processor manifest for a completed build
+func PackerManifestFromManifest(m *manifest.Manifest) *PackerManifest {
+	return &PackerManifest{
+		Builds: []PackerManifestBuild{
+			{
+				Name:          m.ImageName,
+				BuilderType:   ComponentType,
+				BuildTime:     m.FinishedAt.Unix(),
+				Files:         []any{},
+				ArtifactID:    fmt.Sprintf("%s:%d", m.Region, m.ImageID),
+				PackerRunUUID: m.BuildID,
+				CustomData: map[string]string{
+					"image_name":    m.ImageName,
+					"image_version": m.ImageVersion,
+				},
+			},
+		},
+		LastRunUUID: m.BuildID,
+	}
+}
@@ -0,0 +1,102 @@
+package hints
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+)
+
+// Hint explains a recognized failure and suggests how to fix it
+type Hint struct {
+	// Class is a stable identifier for the kind of failure, e.g. "stock-out"
+	Class   string
+	Message string
+	Remedy  string
+}
+
+// rule recognizes a failure signature
+type rule struct {
+	hint  Hint
+	match func(err error, msg string) bool
+}
+
+func containsAny(msg string, substrings ...string) bool {
+	for _, s := range substrings {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// rules are checked in order, so more specific signatures come first
+var rules = []rule{
+	{
+		hint: Hint{"unauthorized", "The Hyperstack API rejected the API key.",
+			"Check that HYPERSTACK_API_KEY is set to a valid, unexpired key for this organization."},
+		match: func(err error, msg string) bool { return errors.Is(err, client.ErrUnauthorized) },
+	},
+	{
+		hint: Hint{"snapshot-quota", "The snapshot quota is exhausted.",
+			"Delete old snapshots (`gc --expired` removes expired build snapshots) or ask Hyperstack support to raise the quota."},
+		match: func(err error, msg string) bool {
+			return errors.Is(err, client.ErrQuotaExceeded) && strings.Contains(msg, "snapshot")
+		},
+	},
+	{
+		hint: Hint{"quota-exceeded", "The request exceeds an account quota.",
+			"Free up VMs, volumes or floating IPs in the environment, or request a quota increase."},
+		match: func(err error, msg string) bool { return errors.Is(err, client.ErrQuotaExceeded) },
+	},
+	{
+		hint: Hint{"stock-out", "No capacity is available for the flavor.",
+			"Retry later, or pick another flavor or an environment in another region."},
+		match: func(err error, msg string) bool { return errors.Is(err, client.ErrFlavorOutOfStock) },
+	},
+	{
+		hint: Hint{"keypair-not-found", "The keypair does not exist in the environment.",
+			"Check keypair_name; keypairs are scoped to an environment, so it must exist in environment_name."},
+		match: func(err error, msg string) bool {
+			return strings.Contains(msg, "keypair") && containsAny(msg, "not found", "does not exist")
+		},
+	},
+	{
+		hint: Hint{"ssh-auth", "The VM rejected the SSH key.",
+			"Check that private_key_path is the private half of keypair_name; the builder logs in as ubuntu, so the base image must have that user."},
+		match: func(err error, msg string) bool {
+			return containsAny(msg, "unable to authenticate", "no supported methods remain")
+		},
+	},
+	{
+		hint: Hint{"ssh-unreachable", "The VM never accepted SSH connections.",
+			"Check that port 22 is reachable from this host (firewalls, proxies) and that the VM booted; its console log is in the Hyperstack dashboard."},
+		match: func(err error, msg string) bool { return strings.Contains(msg, "failed to connect after") },
+	},
+	{
+		hint: Hint{"remote-command", "A command on the VM exited with an error.",
+			"See the step's log under logs/ in the artifacts directory for its full output."},
+		match: func(err error, msg string) bool { return strings.Contains(msg, "process exited with status") },
+	},
+	{
+		hint: Hint{"timeout", "A phase exceeded its deadline.",
+			"Raise the matching entry under timeouts in the config if the phase is just slow in this region."},
+		match: func(err error, msg string) bool { return errors.Is(err, context.DeadlineExceeded) },
+	},
+}
+
+// Classify returns the hint for a recognized failure, or nil
+func Classify(err error) *Hint {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	for _, r := range rules {
+		if r.match(err, msg) {
+			hint := r.hint
+			return &hint
+		}
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Build statuses recorded in history
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Record describes a single build
+type Record struct {
+	ID         string        `json:"id"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	ConfigHash string        `json:"config_hash"`
+	Config     types.Config  `json:"config"` // Redacted, see Redact
+	Scripts    []string      `json:"scripts"`
+	ImageID    int           `json:"image_id,omitempty"`
+	ImageName  string        `json:"image_name,omitempty"`
+	Artifacts  string        `json:"artifacts,omitempty"`
+	Cost       float64       `json:"cost"`
+	// User and Host identify who ran the build and where
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+	// BuilderVersion and SourceCommit identify the builder and the commit of the scripts directory
+	BuilderVersion string `json:"builder_version,omitempty"`
+	SourceCommit   string `json:"source_commit,omitempty"`
+	// ScriptHashes holds the SHA-256 of each provisioning script, keyed by script name
+	ScriptHashes map[string]string `json:"script_hashes,omitempty"`
+	// Phases holds how long each build phase took, keyed by phase name
+	Phases map[string]time.Duration `json:"phases,omitempty"`
+	// Steps holds how long each provisioning script took, keyed by script name
+	Steps map[string]time.Duration `json:"steps,omitempty"`
+}
+
+// Store is an append-only log of build records, kept in a JSON lines file or, when URL is set, by a
+// build server
+type Store struct {
+	Path string
+	// URL is the base URL of a build server keeping the history instead of the file
+	URL   string
+	Token string
+}
+
+// Default returns the build server history at HYPERSTACK_BUILDER_HISTORY_URL if set, authenticating with
+// HYPERSTACK_BUILDER_SERVER_TOKEN, and the file at DefaultPath otherwise
+func Default() *Store {
+	return &Store{
+		Path:  DefaultPath(),
+		URL:   strings.TrimSuffix(os.Getenv("HYPERSTACK_BUILDER_HISTORY_URL"), "/"),
+		Token: os.Getenv("HYPERSTACK_BUILDER_SERVER_TOKEN"),
+	}
+}
+
+// Location describes where the store keeps its records, for logs
+func (s *Store) Location() string {
+	if s.URL != "" {
+		return s.URL + "/history"
+	}
+	return s.Path
+}
+
+// DefaultPath returns the history file location, overridable with HYPERSTACK_BUILDER_HISTORY
+func DefaultPath() string {
+	if path := os.Getenv("HYPERSTACK_BUILDER_HISTORY"); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".hyperstack-builder", "history.jsonl")
+	}
+	return filepath.Join(homeDir, ".hyperstack-builder", "history.jsonl")
+}
+
+// Open returns a store in the file at the given path
+func Open(path string) *Store {
+	return &Store{Path: path}
+}
+
+// NewID generates a sortable build identifier
+func NewID(t time.Time) string {
+	return fmt.Sprintf("%s-%04x", t.UTC().Format("20060102-150405"), t.Nanosecond()&0xffff)
+}
+
+// ConfigHash returns a stable hash of the build configuration
+func ConfigHash(cfg *types.Config) string {
+	data, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Redact returns a copy of a build configuration fit for the shared history: script_env values, webhook
+// headers, chat webhook URLs and secret commands are blanked, in the targets too. ConfigHash still tells
+// configs apart.
+func Redact(cfg *types.Config) types.Config {
+	redacted := *cfg
+	if redacted.APIKeyCommand != "" {
+		redacted.APIKeyCommand = Redacted
+	}
+	if redacted.PrivateKeyCommand != "" {
+		redacted.PrivateKeyCommand = Redacted
+	}
+	if cfg.ScriptEnv != nil {
+		redacted.ScriptEnv = redactValues(cfg.ScriptEnv)
+	}
+	if cfg.Notifications != nil {
+		n := *cfg.Notifications
+		n.Webhooks = make([]types.WebhookConfig, len(cfg.Notifications.Webhooks))
+		for i, webhook := range cfg.Notifications.Webhooks {
+			if webhook.Headers != nil {
+				webhook.Headers = redactValues(webhook.Headers)
+			}
+			n.Webhooks[i] = webhook
+		}
+		n.Slack = redactChats(cfg.Notifications.Slack)
+		n.Teams = redactChats(cfg.Notifications.Teams)
+		redacted.Notifications = &n
+	}
+	if cfg.Targets != nil {
+		redacted.Targets = make(map[string]*types.Config, len(cfg.Targets))
+		for name, target := range cfg.Targets {
+			if target != nil {
+				t := Redact(target)
+				target = &t
+			}
+			redacted.Targets[name] = target
+		}
+	}
+	return redacted
+}
+
+// Redacted replaces a secret value in the history
+const Redacted = "REDACTED"
+
+func redactValues(m map[string]string) map[string]string {
+	redacted := make(map[string]string, len(m))
+	for k := range m {
+		redacted[k] = Redacted
+	}
+	return redacted
+}
+
+func redactChats(chats []types.ChatConfig) []types.ChatConfig {
+	redacted := make([]types.ChatConfig, len(chats))
+	for i, chat := range chats {
+		if chat.WebhookURL != "" {
+			chat.WebhookURL = Redacted
+		}
+		redacted[i] = chat
+	}
+	return redacted
+}
+
+// EstimateCost returns the cost of running a VM at the given hourly rate for the given duration
+func EstimateCost(hourlyRate float64, d time.Duration) float64 {
+	return hourlyRate * d.Hours()
+}
+
+// CurrentUser names who runs the builder: HYPERSTACK_BUILDER_USER if set, e.g. to the CI actor, otherwise
+// the OS user
+func CurrentUser() string {
+	if name := os.Getenv("HYPERSTACK_BUILDER_USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// HashFiles returns the SHA-256 of each named file in dir, keyed by name. Unreadable files are left out.
+func HashFiles(dir string, names []string) map[string]string {
+	hashes := make(map[string]string, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hashes[name] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// Append adds a record to the store
+func (s *Store) Append(rec Record) error {
+	if s.URL != "" {
+		return s.appendRemote(rec)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// List returns all records in the order they were written
+func (s *Store) List() ([]Record, error) {
+	if s.URL != "" {
+		return s.listRemote()
+	}
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse history record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return records, nil
+}
+
+// FindByImageID returns the most recent successful record that produced the given image
+func (s *Store) FindByImageID(imageID int) (*Record, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ImageID == imageID && records[i].Status == StatusSucceeded {
+			return &records[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no build of image %d found in history", imageID)
+}
+
+// Get returns the record with the given build ID
+func (s *Store) Get(id string) (*Record, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].ID == id {
+			return &records[i], nil
+		}
+	}
+	return nil, fmt.Errorf("build %s not found in history", id)
+}
+
+// TypicalPhaseDuration returns the median duration of a phase over the last few successful builds of
+// the image name, or 0 if none recorded it
+func TypicalPhaseDuration(records []Record, imageName, phase string) time.Duration {
+	var durations []time.Duration
+	for i := len(records) - 1; i >= 0 && len(durations) < 5; i-- {
+		rec := records[i]
+		if rec.Status != StatusSucceeded || rec.Config.ImageName != imageName {
+			continue
+		}
+		if d, ok := rec.Phases[phase]; ok {
+			durations = append(durations, d)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2]
+}
+
+// httpClient is used to reach a remote history
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// appendRemote POSTs the record to the build server's history
+func (s *Store) appendRemote(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do("POST", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listRemote fetches every record from the build server's history
+func (s *Store) listRemote() ([]Record, error) {
+	resp, err := s.do("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var records []Record
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to parse history from %s: %w", s.Location(), err)
+	}
+	return records, nil
+}
+
+// do sends a request to the build server's history endpoint, failing on a non-2xx response
+func (s *Store) do(method string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.Location(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach history at %s: %w", s.Location(), err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("history at %s returned status %d: %s", s.Location(), resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
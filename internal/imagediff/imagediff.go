@@ -0,0 +1,244 @@
+package imagediff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+)
+
+// Inventory is the software inventory of a built image, loaded from its collected artifacts
+type Inventory struct {
+	Source   string            `json:"source"`
+	Kernel   string            `json:"kernel"`
+	Driver   string            `json:"driver"`
+	Packages map[string]string `json:"packages"`
+}
+
+// Change is a package whose version differs between two images
+type Change struct {
+	Package string `json:"package"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// Result is the difference between two image inventories
+type Result struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Kernel   *Change  `json:"kernel,omitempty"`
+	Driver   *Change  `json:"driver,omitempty"`
+	Added    []Change `json:"added"`
+	Removed  []Change `json:"removed"`
+	Upgraded []Change `json:"changed"`
+}
+
+// Load reads an inventory from an artifacts directory, or from a bare dpkg package list file
+func Load(path string) (*Inventory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{Source: path}
+	packagesPath := path
+	if info.IsDir() {
+		packagesPath = artifacts.CollectedPath(path, "packages.txt")
+		inv.Kernel = readFirstLine(artifacts.CollectedPath(path, "kernel.txt"))
+		inv.Driver = readFirstLine(artifacts.CollectedPath(path, "nvidia-driver.txt"))
+	}
+
+	f, err := os.Open(packagesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package list: %w", err)
+	}
+	defer f.Close()
+
+	inv.Packages, err = ParsePackages(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the package list when the dedicated files were not collected
+	if inv.Kernel == "" {
+		inv.Kernel = latestMatching(inv.Packages, "linux-image-")
+	}
+	if inv.Driver == "" {
+		inv.Driver = latestMatching(inv.Packages, "nvidia-driver-")
+	}
+
+	return inv, nil
+}
+
+// ParsePackages parses "package<TAB>version" lines as written by dpkg-query
+func ParsePackages(r io.Reader) (map[string]string, error) {
+	packages := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		packages[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read package list: %w", err)
+	}
+	return packages, nil
+}
+
+// Diff compares two inventories
+func Diff(from, to *Inventory) *Result {
+	result := &Result{From: from.Source, To: to.Source}
+
+	if from.Kernel != to.Kernel {
+		result.Kernel = &Change{Package: "kernel", From: from.Kernel, To: to.Kernel}
+	}
+	if from.Driver != to.Driver {
+		result.Driver = &Change{Package: "nvidia-driver", From: from.Driver, To: to.Driver}
+	}
+
+	for name, version := range to.Packages {
+		old, ok := from.Packages[name]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, Change{Package: name, To: version})
+		case old != version:
+			result.Upgraded = append(result.Upgraded, Change{Package: name, From: old, To: version})
+		}
+	}
+	for name, version := range from.Packages {
+		if _, ok := to.Packages[name]; !ok {
+			result.Removed = append(result.Removed, Change{Package: name, From: version})
+		}
+	}
+
+	for _, changes := range [][]Change{result.Added, result.Removed, result.Upgraded} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Package < changes[j].Package })
+	}
+	return result
+}
+
+// Empty reports whether the two inventories were identical
+func (r *Result) Empty() bool {
+	return r.Kernel == nil && r.Driver == nil && len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Upgraded) == 0
+}
+
+// WriteMarkdown renders the diff as markdown suitable for release notes
+func (r *Result) WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "## Changes from %s to %s\n\n", r.From, r.To)
+	if r.Empty() {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	if r.Kernel != nil {
+		fmt.Fprintf(w, "- Kernel: %s -> %s\n", orNone(r.Kernel.From), orNone(r.Kernel.To))
+	}
+	if r.Driver != nil {
+		fmt.Fprintf(w, "- NVIDIA driver: %s -> %s\n", orNone(r.Driver.From), orNone(r.Driver.To))
+	}
+
+	sections := []struct {
+		title   string
+		changes []Change
+	}{
+		{"Added packages", r.Added},
+		{"Removed packages", r.Removed},
+		{"Changed packages", r.Upgraded},
+	}
+	for _, section := range sections {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s (%d)\n\n", section.title, len(section.changes))
+		for _, c := range section.changes {
+			switch {
+			case c.From == "":
+				fmt.Fprintf(w, "- %s %s\n", c.Package, c.To)
+			case c.To == "":
+				fmt.Fprintf(w, "- %s %s\n", c.Package, c.From)
+			default:
+				fmt.Fprintf(w, "- %s %s -> %s\n", c.Package, c.From, c.To)
+			}
+		}
+	}
+}
+
+func readFirstLine(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line)
+}
+
+// latestMatching returns "<package> <version>" for the package with the prefix and the highest version
+// after it, e.g. linux-image-6.8.0-45-generic. Meta packages without a version, such as
+// linux-image-virtual, are skipped.
+func latestMatching(packages map[string]string, prefix string) string {
+	best, bestVersion := "", ""
+	for name := range packages {
+		version, ok := strings.CutPrefix(name, prefix)
+		if !ok || version == "" || version[0] < '0' || version[0] > '9' {
+			continue
+		}
+		if best == "" || compareVersions(version, bestVersion) > 0 {
+			best, bestVersion = name, version
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", best, packages[best])
+}
+
+// compareVersions compares two versions run by run, numbers by value and the rest as text, so that
+// 6.8.0-100 is newer than 6.8.0-45
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		runA, restA := nextRun(a)
+		runB, restB := nextRun(b)
+		if c := compareRuns(runA, runB); c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+	return len(a) - len(b)
+}
+
+// nextRun splits off the leading run of digits, or of other characters, of s
+func nextRun(s string) (string, string) {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func compareRuns(a, b string) int {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// TestSuites is the root element of a JUnit XML report
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite groups the checks run against one VM
+type TestSuite struct {
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Time     float64    `xml:"time,attr"`
+	Cases    []TestCase `xml:"testcase"`
+}
+
+// TestCase is a single check
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *Failure `xml:"failure,omitempty"`
+}
+
+// Failure describes why a check failed
+type Failure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// NewReport creates an empty report named after the image
+func NewReport(name string) *TestSuites {
+	return &TestSuites{Name: name}
+}
+
+// AddChecks adds a suite of validation check results
+func (r *TestSuites) AddChecks(suite string, checks []manifest.CheckResult) {
+	s := TestSuite{Name: suite}
+	for _, c := range checks {
+		tc := TestCase{Name: c.Name, ClassName: suite, Time: c.Duration.Seconds()}
+		if !c.Passed {
+			tc.Failure = &Failure{Message: c.Error, Text: c.Command}
+		}
+		s.add(tc)
+	}
+	r.add(s)
+}
+
+// AddCase adds a suite holding a single test case, for tests without individual checks
+func (r *TestSuites) AddCase(suite, name string, d time.Duration, errMsg string) {
+	s := TestSuite{Name: suite}
+	tc := TestCase{Name: name, ClassName: suite, Time: d.Seconds()}
+	if errMsg != "" {
+		tc.Failure = &Failure{Message: errMsg}
+	}
+	s.add(tc)
+	r.add(s)
+}
+
+func (s *TestSuite) add(tc TestCase) {
+	s.Cases = append(s.Cases, tc)
+	s.Tests++
+	s.Time += tc.Time
+	if tc.Failure != nil {
+		s.Failures++
+	}
+}
+
+func (r *TestSuites) add(s TestSuite) {
+	r.Suites = append(r.Suites, s)
+	r.Tests += s.Tests
+	r.Failures += s.Failures
+	r.Time += s.Time
+}
+
+// Write saves the report as XML
+func (r *TestSuites) Write(path string) error {
+	data, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package labels
+
+import (
+	"strings"
+	"time"
+)
+
+// Builder marks every resource created by the builder
+const Builder = "builder=hyperstack-image-builder"
+
+// Label prefixes; the value follows the prefix
+const (
+	BuildIDPrefix     = "hsb.build_id="   // Correlates resources with a build
+	ClaimPrefix       = "hsb.lock="       // Claims an image name in a region across hosts while it is being built
+	ExpiresPrefix     = "hsb.expires_at=" // When a temporary build resource may be reaped
+	ChannelPrefix     = "channel="        // An image's release channel
+	ImageFamilyPrefix = "hsb.image_name=" // The image name without its version
+)
+
+// Channels are the release channels, in promotion order. New builds land in the first one.
+var Channels = []string{"dev", "staging", "stable"}
+
+// BuildID returns the label correlating resources with a build
+func BuildID(buildID string) string {
+	return BuildIDPrefix + buildID
+}
+
+// Claim returns the VM label used to claim an image name in a region across hosts
+func Claim(name string) string {
+	return ClaimPrefix + name
+}
+
+// Expires returns the TTL label for a resource expiring at t
+func Expires(t time.Time) string {
+	return ExpiresPrefix + t.UTC().Format(time.RFC3339)
+}
+
+// Expired reports whether labels carry a TTL label that has passed
+func Expired(labels []string, now time.Time) bool {
+	for _, l := range labels {
+		if !strings.HasPrefix(l, ExpiresPrefix) {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, strings.TrimPrefix(l, ExpiresPrefix))
+		if err != nil {
+			continue
+		}
+		return now.After(expiresAt)
+	}
+	return false
+}
+
+// Channel returns the label placing an image in a channel
+func Channel(channel string) string {
+	return ChannelPrefix + channel
+}
@@ -0,0 +1,166 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// StaleAfter is how long a lockfile may exist before it is considered abandoned
+const StaleAfter = 6 * time.Hour
+
+// ErrLocked is returned when another build already holds the lock
+var ErrLocked = errors.New("build lock is held by another process")
+
+// Info describes the holder of a lock
+type Info struct {
+	Name       string    `json:"name"`
+	PID        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// Lock is a local lockfile guarding builds of a single image name
+type Lock struct {
+	path string
+	info Info
+}
+
+// Path returns the lockfile path used for the given image name
+func Path(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	return filepath.Join(os.TempDir(), fmt.Sprintf("hyperstack-builder-%s.lock", safe))
+}
+
+// Acquire takes the local lock for the given image name, removing stale locks left by dead processes
+func Acquire(name string) (*Lock, error) {
+	hostname, _ := os.Hostname()
+	l := &Lock{
+		path: Path(name),
+		info: Info{
+			Name:       name,
+			PID:        os.Getpid(),
+			Hostname:   hostname,
+			AcquiredAt: time.Now().UTC(),
+		},
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			defer f.Close()
+			if err := json.NewEncoder(f).Encode(l.info); err != nil {
+				os.Remove(l.path)
+				return nil, fmt.Errorf("failed to write lockfile: %w", err)
+			}
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lockfile: %w", err)
+		}
+
+		holder, readErr := Read(l.path)
+		if readErr == nil && !holder.stale(hostname) {
+			return nil, fmt.Errorf("%w: %s (pid %d on %s since %s)", ErrLocked,
+				l.path, holder.PID, holder.Hostname, holder.AcquiredAt.Format(time.RFC3339))
+		}
+
+		// Holder is gone or the file is unreadable, clear it and retry once
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale lockfile: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrLocked, l.path)
+}
+
+// Read returns the holder information recorded in a lockfile
+func Read(path string) (*Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Holder returns who holds the lock for the given name, or nil if it is free or its holder is gone
+func Holder(name string) *Info {
+	info, err := Read(Path(name))
+	if err != nil {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	if info.stale(hostname) {
+		return nil
+	}
+	return info
+}
+
+// Release removes the lockfile
+func (l *Lock) Release() error {
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// stale reports whether the holder is no longer running or has held the lock too long
+func (i *Info) stale(hostname string) bool {
+	if time.Since(i.AcquiredAt) > StaleAfter {
+		return true
+	}
+	if i.Hostname != hostname {
+		return false
+	}
+	process, err := os.FindProcess(i.PID)
+	if err != nil {
+		return true
+	}
+	return process.Signal(syscall.Signal(0)) != nil
+}
+
+// slotPollInterval is how often AcquireSlot checks for a free slot
+const slotPollInterval = 5 * time.Second
+
+// AcquireSlot takes one of n slots of a pool shared by every process on this host, waiting until one is
+// free or ctx is done. Slots are lockfiles, so one held by a process that died is reclaimed.
+func AcquireSlot(ctx context.Context, pool string, n int) (*Lock, error) {
+	waiting := false
+	for {
+		for i := 0; i < n; i++ {
+			l, err := Acquire(fmt.Sprintf("%s-slot-%d", pool, i))
+			if err == nil {
+				return l, nil
+			}
+			if !errors.Is(err, ErrLocked) {
+				return nil, err
+			}
+		}
+		if !waiting {
+			slog.Info("Waiting for a free slot", "pool", pool, "slots", n)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no %s slot became free: %w", pool, context.Cause(ctx))
+		case <-time.After(slotPollInterval):
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package logging
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// context is the build state attached to every record
+type context struct {
+	buildID string
+	vmID    int
+	phase   string
+}
+
+var (
+	root    = slog.Default()
+	current context
+)
+
+// Setup installs the default logger writing to w in the given format ("text" or "json")
+func Setup(w io.Writer, format string, level slog.Level) error {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", FormatText:
+		root = slog.New(redactHandler{slog.NewTextHandler(w, opts)})
+	case FormatJSON:
+		root = slog.New(redactHandler{slog.NewJSONHandler(w, opts)})
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+	apply()
+	return nil
+}
+
+// SetupFromEnv configures logging from HYPERSTACK_BUILDER_LOG_FORMAT and HYPERSTACK_BUILDER_LOG_LEVEL
+func SetupFromEnv() error {
+	level := slog.LevelInfo
+	if s := os.Getenv("HYPERSTACK_BUILDER_LOG_LEVEL"); s != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+			return fmt.Errorf("invalid HYPERSTACK_BUILDER_LOG_LEVEL %q: %w", s, err)
+		}
+	}
+	return Setup(os.Stderr, os.Getenv("HYPERSTACK_BUILDER_LOG_FORMAT"), level)
+}
+
+// apply rebuilds the default logger from the root logger and the current build context
+func apply() {
+	logger := root
+	if current.buildID != "" {
+		logger = logger.With("build_id", current.buildID)
+	}
+	if current.vmID != 0 {
+		logger = logger.With("vm_id", current.vmID)
+	}
+	if current.phase != "" {
+		logger = logger.With("phase", current.phase)
+	}
+	slog.SetDefault(logger)
+}
+
+// StartBuild attaches the build ID to every record until the returned function restores the previous context
+func StartBuild(buildID string) func() {
+	prev := current
+	current = context{buildID: buildID}
+	apply()
+	return func() {
+		current = prev
+		apply()
+	}
+}
+
+// SetVM attaches the build VM's ID to every record of the current build
+func SetVM(vmID int) {
+	current.vmID = vmID
+	apply()
+}
+
+// SetPhase attaches the build phase to every record until the next phase starts
+func SetPhase(phase string) {
+	current.phase = phase
+	apply()
+}
+
+// Fatal logs at error level and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// redacted replaces secrets in log output
+const redacted = "[REDACTED]"
+
+// minSecretLength keeps short values, which would match ordinary text, from being registered as secrets
+const minSecretLength = 6
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// AddSecret redacts value from every log record, and from the remote output of builds, from now on
+func AddSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = append(secrets, value)
+}
+
+// Redact replaces the secrets registered with AddSecret in s
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// RedactWriter returns a writer that redacts secrets from what is written through it to w. A secret split
+// across two writes is not caught, so it suits writers fed whole lines.
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactHandler redacts secrets from the message and attributes of records before passing them on
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx stdcontext.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = redactAttr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(redactedAttrs)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr redacts secrets from strings, errors and anything else that prints a secret
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redactedGroup[i] = redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactedGroup...)}
+	case slog.KindAny:
+		s := fmt.Sprint(v.Any())
+		if r := Redact(s); r != s {
+			return slog.String(a.Key, r)
+		}
+	}
+	return a
+}
@@ -0,0 +1,187 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/changelog"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/compliance"
+)
+
+// Manifest records the outcome of a successful build
+type Manifest struct {
+	BuildID       string    `json:"build_id"`
+	ImageID       int       `json:"image_id"`
+	ImageName     string    `json:"image_name"`
+	ImageVersion  string    `json:"image_version"`
+	Region        string    `json:"region"`
+	BaseImageName string    `json:"base_image_name"`
+	FlavorName    string    `json:"flavor_name"`
+	VMID          int       `json:"vm_id"`
+	SnapshotID    int       `json:"snapshot_id"`
+	Labels        []string  `json:"labels"`
+	Scripts       []string  `json:"scripts"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+
+	Software   *Software       `json:"software,omitempty"`
+	Lineage    *Lineage        `json:"lineage,omitempty"`
+	LaunchTest []CheckResult   `json:"launch_test,omitempty"`
+	Flavors    []FlavorResult  `json:"flavors,omitempty"`
+	JoinTest   *JoinTestResult `json:"join_test,omitempty"`
+
+	Changelog  *changelog.Changelog `json:"changelog,omitempty"`
+	Compliance *compliance.Report   `json:"compliance,omitempty"`
+	Phases     []Phase              `json:"phases,omitempty"`
+	// Steps are the provisioning scripts within the provision phase
+	Steps []Phase `json:"steps,omitempty"`
+}
+
+// Software is the versions of key components actually installed in the image, queried after provisioning
+type Software struct {
+	Kernel       string `json:"kernel,omitempty"`
+	NvidiaDriver string `json:"nvidia_driver,omitempty"`
+	CUDA         string `json:"cuda,omitempty"`
+	Containerd   string `json:"containerd,omitempty"`
+	Kubernetes   string `json:"kubernetes,omitempty"`
+}
+
+// Phase statuses
+const (
+	PhaseSucceeded = "succeeded"
+	PhaseFailed    = "failed"
+)
+
+// Phase records when a build phase started, how long it took and how it ended
+type Phase struct {
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Status    string        `json:"status"`
+}
+
+// JoinTestResult is the outcome of joining a VM booted from the image to a test cluster
+type JoinTestResult struct {
+	Node     string        `json:"node"`
+	Ready    bool          `json:"ready"`
+	GPUs     string        `json:"gpus"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Lineage traces an image back to the inputs that produced it
+type Lineage struct {
+	BaseImageID    int    `json:"base_image_id"`
+	BuilderVersion string `json:"builder_version"`
+	SourceCommit   string `json:"source_commit,omitempty"`
+	SourceDirty    bool   `json:"source_dirty,omitempty"`
+	ContentHash    string `json:"content_hash"`
+	InputDigest    string `json:"input_digest"`            // Content hash plus base image; equal digests mean equal inputs
+	RootfsDigest   string `json:"rootfs_digest,omitempty"` // Hash of the rootfs file listing produced by the build
+}
+
+// Label prefixes used to stamp lineage onto images
+const (
+	LabelBaseImageID    = "hsb.base_image_id="
+	LabelBuilderVersion = "hsb.builder_version="
+	LabelSourceCommit   = "hsb.source_commit="
+	LabelContentHash    = "hsb.content_hash="
+	LabelInputDigest    = "hsb.input_digest="
+	LabelRootfsDigest   = "hsb.rootfs_digest="
+)
+
+// Labels returns the image labels recording the lineage. The content hash is shortened to fit label limits.
+func (l *Lineage) Labels() []string {
+	labels := []string{
+		fmt.Sprintf("%s%d", LabelBaseImageID, l.BaseImageID),
+		LabelBuilderVersion + l.BuilderVersion,
+		LabelContentHash + shorten(l.ContentHash, 16),
+		LabelInputDigest + shorten(l.InputDigest, 16),
+	}
+	if l.RootfsDigest != "" {
+		labels = append(labels, LabelRootfsDigest+shorten(l.RootfsDigest, 16))
+	}
+	if l.SourceCommit != "" {
+		commit := shorten(l.SourceCommit, 12)
+		if l.SourceDirty {
+			commit += "-dirty"
+		}
+		labels = append(labels, LabelSourceCommit+commit)
+	}
+	return labels
+}
+
+func shorten(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// CheckResult is the outcome of one validation check run against a launch-tested image
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Command  string        `json:"command"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// FlavorResult is the outcome of launch-testing the image on an additional flavor
+type FlavorResult struct {
+	Flavor string        `json:"flavor"`
+	Passed bool          `json:"passed"`
+	Checks []CheckResult `json:"checks,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Write saves the manifest as indented JSON, creating the parent directory
+func Write(m *Manifest, path string) error {
+	return WriteJSON(m, path)
+}
+
+// WriteJSON saves any build report as indented JSON, creating the parent directory
+func WriteJSON(v any, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Read loads a manifest from disk
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// RegionalManifest lists the per-region images of a build replicated to several regions
+type RegionalManifest struct {
+	ImageName    string          `json:"image_name"`
+	ImageVersion string          `json:"image_version"`
+	Regions      []RegionalImage `json:"regions"`
+}
+
+// RegionalImage is the image built in one region
+type RegionalImage struct {
+	Region    string `json:"region"`
+	ImageID   int    `json:"image_id,omitempty"`
+	ImageName string `json:"image_name,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// SchemaVersion is the version of the metadata label format
+const SchemaVersion = 1
+
+// LabelPrefix prefixes every metadata label on an image
+const LabelPrefix = "hsb.meta."
+
+// Metadata is the set of build facts stamped onto an image as hsb.meta.<key>=<value> labels.
+// Its JSON form is what `inspect` prints.
+type Metadata struct {
+	Schema            int    `json:"schema"`
+	BuildID           string `json:"build_id"`
+	ImageName         string `json:"image_name"`
+	ImageVersion      string `json:"image_version"`
+	ContentHash       string `json:"content_hash,omitempty"`
+	DriverVersion     string `json:"driver_version,omitempty"`
+	CUDAVersion       string `json:"cuda_version,omitempty"`
+	ContainerdVersion string `json:"containerd_version,omitempty"`
+	KubernetesVersion string `json:"kubernetes_version,omitempty"`
+	Region            string `json:"region,omitempty"`
+	BuiltAt           string `json:"built_at,omitempty"`
+}
+
+// Labels returns the image labels encoding the metadata. Empty fields are left out.
+func (m *Metadata) Labels() []string {
+	labels := []string{LabelPrefix + "schema=" + strconv.Itoa(SchemaVersion)}
+	for _, field := range m.fields() {
+		if *field.value != "" {
+			labels = append(labels, LabelPrefix+field.key+"="+*field.value)
+		}
+	}
+	return labels
+}
+
+func (m *Metadata) fields() []struct {
+	key   string
+	value *string
+} {
+	return []struct {
+		key   string
+		value *string
+	}{
+		{"build_id", &m.BuildID},
+		{"image_name", &m.ImageName},
+		{"image_version", &m.ImageVersion},
+		{"content_hash", &m.ContentHash},
+		{"driver_version", &m.DriverVersion},
+		{"cuda_version", &m.CUDAVersion},
+		{"containerd_version", &m.ContainerdVersion},
+		{"kubernetes_version", &m.KubernetesVersion},
+		{"region", &m.Region},
+		{"built_at", &m.BuiltAt},
+	}
+}
+
+// Parse reads metadata back out of image labels. Unknown keys are ignored so older builders can read newer images.
+func Parse(labels []string) (*Metadata, error) {
+	m := &Metadata{}
+	values := make(map[string]string)
+	for _, label := range labels {
+		if !strings.HasPrefix(label, LabelPrefix) {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(label, LabelPrefix), "=")
+		values[key] = value
+	}
+
+	schema, ok := values["schema"]
+	if !ok {
+		return nil, fmt.Errorf("image has no %sschema label", LabelPrefix)
+	}
+	var err error
+	if m.Schema, err = strconv.Atoi(schema); err != nil {
+		return nil, fmt.Errorf("invalid metadata schema %q: %w", schema, err)
+	}
+
+	for _, field := range m.fields() {
+		*field.value = values[field.key]
+	}
+	return m, nil
+}
+
+// FromImage parses the metadata labels of an image
+func FromImage(image *types.Image) (*Metadata, error) {
+	labels := make([]string, 0, len(image.Labels))
+	for _, l := range image.Labels {
+		labels = append(labels, l.Label)
+	}
+	return Parse(labels)
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the chat message used when none is configured
+const DefaultTemplate = `{{if eq .Type "build.started"}}:hammer_and_wrench: Started building *{{.ImageName}}* {{.ImageVersion}} in {{.Region}}
+Build ID: {{.BuildID}}
+{{- else if eq .Type "build.provisioned"}}:package: Provisioned *{{.ImageName}}* {{.ImageVersion}} in {{.Region}}, creating the image
+Duration: {{.Duration}} | Cost: ${{printf "%.2f" .Cost}}
+{{- else if eq .Type "image.created"}}:cd: Created image *{{.ImageName}}* {{.ImageVersion}} in {{.Region}}
+Image ID: {{.ImageID}} | Duration: {{.Duration}} | Cost: ${{printf "%.2f" .Cost}}
+{{- else}}{{if .Succeeded}}:white_check_mark: Built{{else}}:x: Failed to build{{end}} *{{.ImageName}}* {{.ImageVersion}} in {{.Region}}
+Duration: {{.Duration}} | Validation: {{.Validation}} | Cost: ${{printf "%.2f" .Cost}}{{if .Manifest}}
+Image ID: {{.Manifest.ImageID}}{{end}}{{if .Error}}
+Error: {{.Error}}{{end}}{{if .Hint}}
+Hint: {{.Hint}}{{end}}{{end}}`
+
+// messageData is the data available to chat message templates
+type messageData struct {
+	*Event
+	Duration   time.Duration
+	Validation string
+}
+
+// Render executes a message template (DefaultTemplate if empty) against the event
+func Render(tmpl string, event *Event) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	t, err := template.New("message").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid message template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	data := messageData{Event: event, Duration: event.Duration.Round(time.Second), Validation: event.Validation()}
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Slack posts a templated message to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+	Template   string
+}
+
+// Name identifies the notifier in logs
+func (s *Slack) Name() string {
+	return "Slack"
+}
+
+// Notify sends the event
+func (s *Slack) Notify(event *Event) error {
+	text, err := Render(s.Template, event)
+	if err != nil {
+		return err
+	}
+	return postJSON(s.WebhookURL, nil, map[string]string{"text": text})
+}
+
+// Teams posts a templated message card to a Microsoft Teams incoming webhook
+type Teams struct {
+	WebhookURL string
+	Template   string
+}
+
+// Name identifies the notifier in logs
+func (t *Teams) Name() string {
+	return "Teams"
+}
+
+// Notify sends the event
+func (t *Teams) Notify(event *Event) error {
+	text, err := Render(t.Template, event)
+	if err != nil {
+		return err
+	}
+
+	color := "0076D7"
+	switch {
+	case event.Succeeded():
+		color = "2EB886"
+	case event.Failed():
+		color = "D00000"
+	}
+	return postJSON(t.WebhookURL, nil, map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "http://schema.org/extensions",
+		"summary":    fmt.Sprintf("%s %s: %s", event.ImageName, event.ImageVersion, event.Type),
+		"themeColor": color,
+		// Teams renders the card text as markdown, where single newlines are ignored
+		"text": strings.ReplaceAll(text, "\n", "\n\n"),
+	})
+}
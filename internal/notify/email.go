@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultEmailTemplate is the email body used when none is configured
+const DefaultEmailTemplate = `{{if eq .Type "build.started"}}Started building{{else if eq .Type "build.provisioned"}}Provisioned{{else if eq .Type "image.created"}}Created image{{else if .Succeeded}}Built{{else}}Failed to build{{end}} {{.ImageName}} {{.ImageVersion}} in {{.Region}}.
+
+Build ID:   {{.BuildID}}
+Duration:   {{.Duration}}
+{{- if or .Succeeded .Failed}}
+Validation: {{.Validation}}
+{{- end}}
+Cost:       ${{printf "%.2f" .Cost}}
+{{- if and .ImageID (not .Manifest)}}
+Image ID:   {{.ImageID}}
+{{- end}}
+{{- if .Manifest}}
+Image:      {{.Manifest.ImageName}} (ID: {{.Manifest.ImageID}})
+{{- end}}
+{{- if .Error}}
+
+Error: {{.Error}}
+{{- end}}
+{{- if .Hint}}
+Hint:  {{.Hint}}
+{{- end}}
+`
+
+// reportFiles are attached to emails when present in the build's artifacts directory
+var reportFiles = []string{"launch-test.json", "join-test.json"}
+
+// Email sends the event through an SMTP server, attaching the validation reports
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	Template string
+}
+
+// Name identifies the notifier in logs
+func (e *Email) Name() string {
+	return "email " + strings.Join(e.To, ", ")
+}
+
+// Notify sends the event
+func (e *Email) Notify(event *Event) error {
+	tmpl := e.Template
+	if tmpl == "" {
+		tmpl = DefaultEmailTemplate
+	}
+	body, err := Render(tmpl, event)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("[hyperstack-builder] %s %s %s", event.ImageName, event.ImageVersion, event.Status())
+
+	msg, err := e.message(subject, body, event.Artifacts)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	// SendMail upgrades to TLS with STARTTLS when the server supports it
+	return smtp.SendMail(fmt.Sprintf("%s:%d", e.Host, e.Port), auth, e.From, e.To, msg)
+}
+
+// message builds a multipart MIME message with the body and any report files as attachments
+func (e *Email) message(subject, body, artifactsDir string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+
+	for _, name := range reportFiles {
+		if artifactsDir == "" {
+			break
+		}
+		data, err := os.ReadFile(filepath.Join(artifactsDir, name))
+		if err != nil {
+			continue
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/json"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
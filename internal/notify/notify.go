@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Build outcome events
+const (
+	EventSucceeded = "build.succeeded"
+	EventFailed    = "build.failed"
+)
+
+// Build lifecycle events, sent while the build runs
+const (
+	EventStarted      = "build.started"
+	EventProvisioned  = "build.provisioned"
+	EventImageCreated = "image.created"
+)
+
+// eventNames maps each event to the name notifiers subscribe to it by in their "on" list
+var eventNames = map[string]string{
+	EventSucceeded:    "success",
+	EventFailed:       "failure",
+	EventStarted:      "started",
+	EventProvisioned:  "provisioned",
+	EventImageCreated: "image_created",
+}
+
+// Event describes the outcome of a build, or a step it reached
+type Event struct {
+	Type         string             `json:"event"`
+	BuildID      string             `json:"build_id"`
+	ImageName    string             `json:"image_name"`
+	ImageVersion string             `json:"image_version"`
+	Region       string             `json:"region"`
+	Duration     time.Duration      `json:"duration"`
+	Cost         float64            `json:"cost"`
+	ImageID      int                `json:"image_id,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	Hint         string             `json:"hint,omitempty"`
+	Artifacts    string             `json:"artifacts,omitempty"`
+	Manifest     *manifest.Manifest `json:"manifest,omitempty"`
+}
+
+// Succeeded reports whether the event is for a successful build
+func (e *Event) Succeeded() bool {
+	return e.Type == EventSucceeded
+}
+
+// Failed reports whether the event is for a failed build
+func (e *Event) Failed() bool {
+	return e.Type == EventFailed
+}
+
+// Status describes the event in a few words, e.g. for email subjects
+func (e *Event) Status() string {
+	switch e.Type {
+	case EventSucceeded:
+		return "succeeded"
+	case EventFailed:
+		return "failed"
+	case EventStarted:
+		return "started"
+	case EventProvisioned:
+		return "provisioned"
+	case EventImageCreated:
+		return "image created"
+	}
+	return e.Type
+}
+
+// Validation summarizes the launch and join test results recorded in the manifest
+func (e *Event) Validation() string {
+	if e.Manifest == nil {
+		return "n/a"
+	}
+
+	var parts []string
+	if checks := e.Manifest.LaunchTest; len(checks) > 0 {
+		passed := 0
+		for _, c := range checks {
+			if c.Passed {
+				passed++
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d/%d checks passed", passed, len(checks)))
+	}
+	if jt := e.Manifest.JoinTest; jt != nil {
+		if jt.Ready {
+			parts = append(parts, "node joined")
+		} else {
+			parts = append(parts, "node join failed")
+		}
+	}
+	if len(parts) == 0 {
+		return "not run"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Notifier delivers build events to an external system
+type Notifier interface {
+	Name() string
+	Notify(event *Event) error
+}
+
+// FromConfig returns the notifiers configured for the given event type
+func FromConfig(cfg *types.NotificationsConfig, eventType string) []Notifier {
+	if cfg == nil {
+		return nil
+	}
+
+	var notifiers []Notifier
+	for _, hook := range cfg.Webhooks {
+		if subscribed(hook.On, eventType) {
+			notifiers = append(notifiers, &Webhook{URL: hook.URL, Headers: hook.Headers})
+		}
+	}
+	for _, chat := range cfg.Slack {
+		if subscribed(chat.On, eventType) {
+			notifiers = append(notifiers, &Slack{WebhookURL: chat.WebhookURL, Template: chat.Template})
+		}
+	}
+	for _, chat := range cfg.Teams {
+		if subscribed(chat.On, eventType) {
+			notifiers = append(notifiers, &Teams{WebhookURL: chat.WebhookURL, Template: chat.Template})
+		}
+	}
+	for _, email := range cfg.Email {
+		if subscribed(email.On, eventType) {
+			port := email.SMTPPort
+			if port == 0 {
+				port = 587
+			}
+			notifiers = append(notifiers, &Email{
+				Host:     email.SMTPHost,
+				Port:     port,
+				Username: email.Username,
+				Password: os.Getenv(email.PasswordEnv),
+				From:     email.From,
+				To:       email.To,
+				Template: email.Template,
+			})
+		}
+	}
+	return notifiers
+}
+
+// CheckConfig rejects notifiers subscribed to events that don't exist
+func CheckConfig(cfg *types.NotificationsConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	var lists [][]string
+	for _, hook := range cfg.Webhooks {
+		lists = append(lists, hook.On)
+	}
+	for _, chat := range append(append([]types.ChatConfig{}, cfg.Slack...), cfg.Teams...) {
+		lists = append(lists, chat.On)
+	}
+	for _, email := range cfg.Email {
+		lists = append(lists, email.On)
+	}
+
+	known := make(map[string]bool, len(eventNames))
+	for _, name := range eventNames {
+		known[name] = true
+	}
+	for _, on := range lists {
+		for _, o := range on {
+			if !known[o] {
+				return fmt.Errorf("unknown notification event %q, expected success, failure, started, provisioned or image_created", o)
+			}
+		}
+	}
+	return nil
+}
+
+// subscribed reports whether a notifier listening on the given events ("success", "failure", "started",
+// "provisioned", "image_created") wants the event. An empty list subscribes to the build outcomes only.
+func subscribed(on []string, eventType string) bool {
+	want := eventNames[eventType]
+	if len(on) == 0 {
+		return eventType == EventSucceeded || eventType == EventFailed
+	}
+	for _, o := range on {
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
+
+// httpClient is shared by notifiers that POST to HTTP endpoints
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends v as a JSON request body and fails on a non-2xx response
+func postJSON(url string, headers map[string]string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Webhook POSTs the event as JSON to a URL
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Name identifies the notifier in logs
+func (w *Webhook) Name() string {
+	return "webhook " + w.URL
+}
+
+// Notify sends the event
+func (w *Webhook) Notify(event *Event) error {
+	return postJSON(w.URL, w.Headers, event)
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Check validates a final image name and its full label set against the naming policy
+func Check(p *types.NamingPolicy, imageName string, labels []string) error {
+	return check(p, imageName, labels, true)
+}
+
+// Precheck validates the image name and the configured tags before a build starts.
+// Required labels are not enforced since the builder adds some labels only at the end of the build.
+func Precheck(p *types.NamingPolicy, imageName string, tags []string) error {
+	return check(p, imageName, tags, false)
+}
+
+func check(p *types.NamingPolicy, imageName string, labels []string, requireAll bool) error {
+	if p == nil {
+		return nil
+	}
+
+	var violations []string
+	if p.ImageName != "" {
+		re, err := regexp.Compile(anchor(p.ImageName))
+		if err != nil {
+			return fmt.Errorf("invalid naming policy image_name pattern: %w", err)
+		}
+		if !re.MatchString(imageName) {
+			violations = append(violations, fmt.Sprintf("image name %q does not match %s", imageName, p.ImageName))
+		}
+	}
+
+	values := make(map[string][]string)
+	for _, label := range labels {
+		key, value, _ := strings.Cut(label, "=")
+		values[key] = append(values[key], value)
+	}
+
+	for _, rule := range p.Labels {
+		found, ok := values[rule.Key]
+		if !ok {
+			if rule.Required && requireAll {
+				violations = append(violations, fmt.Sprintf("required label %s is missing", rule.Key))
+			}
+			continue
+		}
+		if rule.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(anchor(rule.Pattern))
+		if err != nil {
+			return fmt.Errorf("invalid naming policy pattern for label %s: %w", rule.Key, err)
+		}
+		for _, value := range found {
+			if !re.MatchString(value) {
+				violations = append(violations, fmt.Sprintf("label %s=%s does not match %s", rule.Key, value, rule.Pattern))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("naming policy violated: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// anchor makes a pattern match the whole string
+func anchor(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
@@ -0,0 +1,83 @@
+package publish
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Upload copies a local artifacts directory to an s3:// or gs:// destination prefix,
+// placing it under a subdirectory with the same base name, and returns the remote location
+func Upload(localDir, destination string) (string, error) {
+	prefix := strings.TrimSuffix(destination, "/")
+	target := prefix + "/" + filepath.Base(localDir)
+
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(destination, "s3://"):
+		cmd = exec.Command("aws", "s3", "cp", "--recursive", "--only-show-errors", localDir, target)
+	case strings.HasPrefix(destination, "gs://"):
+		// gcloud copies the directory itself into the prefix
+		cmd = exec.Command("gcloud", "storage", "cp", "--recursive", localDir, prefix+"/")
+	default:
+		return "", fmt.Errorf("unsupported publish destination %q: must start with s3:// or gs://", destination)
+	}
+	if cmd.Err != nil {
+		return "", fmt.Errorf("%s not found in PATH: %w", cmd.Args[0], cmd.Err)
+	}
+
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to upload artifacts to %s: %w", target, err)
+	}
+	return target, nil
+}
+
+// UploadFile copies a single local file to an s3:// or gs:// object URL
+func UploadFile(localPath, destination string) error {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(destination, "s3://"):
+		cmd = exec.Command("aws", "s3", "cp", "--only-show-errors", localPath, destination)
+	case strings.HasPrefix(destination, "gs://"):
+		cmd = exec.Command("gcloud", "storage", "cp", localPath, destination)
+	default:
+		return fmt.Errorf("unsupported publish destination %q: must start with s3:// or gs://", destination)
+	}
+	if cmd.Err != nil {
+		return fmt.Errorf("%s not found in PATH: %w", cmd.Args[0], cmd.Err)
+	}
+
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %w", localPath, destination, err)
+	}
+	return nil
+}
+
+// DownloadFile copies an s3:// or gs:// object to a local file
+func DownloadFile(source, localPath string) error {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(source, "s3://"):
+		cmd = exec.Command("aws", "s3", "cp", "--only-show-errors", source, localPath)
+	case strings.HasPrefix(source, "gs://"):
+		cmd = exec.Command("gcloud", "storage", "cp", source, localPath)
+	default:
+		return fmt.Errorf("unsupported source %q: must start with s3:// or gs://", source)
+	}
+	if cmd.Err != nil {
+		return fmt.Errorf("%s not found in PATH: %w", cmd.Args[0], cmd.Err)
+	}
+
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to download %s: %w", source, err)
+	}
+	return nil
+}
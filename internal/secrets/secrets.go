@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds how long a secret command may run
+const commandTimeout = time.Minute
+
+// Source says where a secret is read from. The first of its fields that is set is used.
+type Source struct {
+	File    string // File holding the secret
+	Command string // Shell command printing the secret
+	Vault   string // Vault secret holding it, as <path>#<field>, e.g. secret/data/hyperstack#api_key
+}
+
+// IsSet reports whether any source is set
+func (s Source) IsSet() bool {
+	return s.File != "" || s.Command != "" || s.Vault != ""
+}
+
+// Read returns the secret, without surrounding whitespace
+func (s Source) Read() (string, error) {
+	var value string
+	var err error
+	switch {
+	case s.File != "":
+		value, err = readFile(s.File)
+	case s.Command != "":
+		value, err = runCommand(s.Command)
+	case s.Vault != "":
+		value, err = readVault(s.Vault)
+	default:
+		return "", fmt.Errorf("no secret source set")
+	}
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("secret is empty")
+	}
+	return value, nil
+}
+
+// readFile reads a secret file, expanding a leading ~ to the home directory
+func readFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return string(data), nil
+}
+
+// runCommand runs a secret command with sh -c and returns what it printed. Its stderr is passed through
+// so prompts and errors of tools such as pass or op are visible.
+func runCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("secret command %q failed: %w", command, err)
+	}
+	return stdout.String(), nil
+}
+
+// readVault reads a field of a Vault secret from VAULT_ADDR, authenticating with VAULT_TOKEN or the token
+// `vault login` saved in ~/.vault-token. Both KV version 1 and 2 secrets are understood.
+func readVault(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("invalid Vault secret %q, expected <path>#<field>", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR must be set to read Vault secret %s", path)
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read Vault secret %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read Vault secret %s: status %d", path, resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse Vault secret %s: %w", path, err)
+	}
+	data := secret.Data
+	// KV version 2 nests the fields under data.data, next to data.metadata
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no string field %s", path, field)
+	}
+	return value, nil
+}
+
+// vaultToken returns VAULT_TOKEN, or the token saved by `vault login`
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", fmt.Errorf("VAULT_TOKEN must be set, or a token saved with `vault login`, to read Vault secrets")
+}
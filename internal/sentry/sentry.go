@@ -0,0 +1,157 @@
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Client sends events to a Sentry project through the envelope endpoint
+type Client struct {
+	dsn      string
+	endpoint string
+	key      string
+	client   *http.Client
+
+	Release     string
+	Environment string
+}
+
+// New parses a DSN of the form https://<public_key>@<host>/<project_id>
+func New(dsn string) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN: missing public key")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN: missing project ID")
+	}
+
+	return &Client{
+		dsn:      dsn,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		key:      u.User.Username(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Failure is the sanitized context of a failed build
+type Failure struct {
+	Class   string
+	Message string
+	Tags    map[string]string
+	Extra   map[string]any
+}
+
+type exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type event struct {
+	EventID     string `json:"event_id"`
+	Timestamp   string `json:"timestamp"`
+	Level       string `json:"level"`
+	Platform    string `json:"platform"`
+	Logger      string `json:"logger"`
+	Release     string `json:"release,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	Fingerprint []string          `json:"fingerprint"`
+}
+
+// Capture reports a build failure, grouped in Sentry by its class and failed phase
+func (c *Client) Capture(f Failure) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	ev := event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "hyperstack-image-builder",
+		Release:     c.Release,
+		Environment: c.Environment,
+		Tags:        f.Tags,
+		Extra:       f.Extra,
+		Fingerprint: []string{f.Class, f.Tags["phase"]},
+	}
+	ev.Exception.Values = []exception{{Type: f.Class, Value: Sanitize(f.Message)}}
+
+	header, err := json.Marshal(map[string]string{"event_id": ev.EventID, "dsn": c.dsn})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest("POST", c.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=hyperstack-image-builder/%s, sentry_key=%s", c.Release, c.key))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event to Sentry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Sentry rejected event: status %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// redactions strip values that could identify hosts or carry credentials from error messages
+var redactions = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(?i)(api[_-]?key|token|password|secret|authorization)(["']?\s*[:=]\s*["']?)[^\s"',}]+`), "${1}${2}[redacted]"},
+	{regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer [redacted]"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`), "[ip]"},
+	{regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`), "[redacted]"},
+}
+
+// Sanitize removes credentials, long opaque tokens and IP addresses from a message
+func Sanitize(s string) string {
+	for _, r := range redactions {
+		s = r.pattern.ReplaceAllString(s, r.replace)
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package signing
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+)
+
+// BundleSuffix is appended to a signed file's path to name its cosign bundle
+const BundleSuffix = ".bundle"
+
+// SignOptions selects between key-based and keyless (OIDC) signing
+type SignOptions struct {
+	Key string // Path or KMS URI of the cosign private key; empty for keyless signing
+}
+
+// VerifyOptions holds the trust material for verification
+type VerifyOptions struct {
+	Key                 string // Public key path or KMS URI for key-based signatures
+	CertificateIdentity string // Expected signer identity for keyless signatures
+	CertificateIssuer   string // Expected OIDC issuer for keyless signatures
+}
+
+// BundlePath returns the path of the cosign bundle for a file
+func BundlePath(path string) string {
+	return path + BundleSuffix
+}
+
+// Sign signs a file with cosign, writing a bundle next to it
+func Sign(path string, opts SignOptions) (string, error) {
+	bundle := BundlePath(path)
+	args := []string{"sign-blob", "--yes", "--bundle", bundle}
+	if opts.Key != "" {
+		args = append(args, "--key", opts.Key)
+	}
+	args = append(args, path)
+
+	if err := cosign(args...); err != nil {
+		return "", fmt.Errorf("failed to sign %s: %w", path, err)
+	}
+	return bundle, nil
+}
+
+// Verify checks a file against its cosign bundle
+func Verify(path string, opts VerifyOptions) error {
+	args := []string{"verify-blob", "--bundle", BundlePath(path)}
+	switch {
+	case opts.Key != "":
+		args = append(args, "--key", opts.Key)
+	case opts.CertificateIdentity != "" && opts.CertificateIssuer != "":
+		args = append(args, "--certificate-identity", opts.CertificateIdentity, "--certificate-oidc-issuer", opts.CertificateIssuer)
+	default:
+		return fmt.Errorf("verification requires a public key or a certificate identity and issuer")
+	}
+	args = append(args, path)
+
+	if err := cosign(args...); err != nil {
+		return fmt.Errorf("signature verification failed for %s: %w", path, err)
+	}
+	return nil
+}
+
+func cosign(args ...string) error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("cosign not found in PATH: %w", err)
+	}
+	cmd := exec.Command("cosign", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Files returns the manifest plus any collected SBOM files in an artifacts directory
+func Files(artifactsPath, manifestPath string) []string {
+	files := []string{manifestPath}
+	entries, err := os.ReadDir(artifacts.CollectedDir(artifactsPath))
+	if err != nil {
+		return files
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.Contains(strings.ToLower(name), "sbom") && !strings.HasSuffix(name, BundleSuffix) {
+			files = append(files, artifacts.CollectedPath(artifactsPath, name))
+		}
+	}
+	return files
+}
@@ -0,0 +1,144 @@
+// Package sshharness runs the SSH client against a throwaway sshd container, so the provisioning
+// semantics (file copies, permissions, exit codes, output capture, cancellation) can be checked without a
+// cloud VM. Its tests skip when Docker is unavailable.
+package sshharness
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/ssh"
+)
+
+const (
+	// Image is the sshd container image; it creates USER_NAME with PUBLIC_KEY authorized and listens on 2222
+	Image = "lscr.io/linuxserver/openssh-server:latest"
+	// User is the login user, matching the user the builder connects as
+	User = "ubuntu"
+)
+
+// Server is a running sshd container reachable on a local port
+type Server struct {
+	ContainerID string
+	Addr        string
+	KeyPath     string
+	dir         string
+}
+
+// docker runs a docker CLI command and returns its trimmed stdout
+func docker(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Available reports whether a Docker daemon can be reached to run the container
+func Available() bool {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return false
+	}
+	_, err := docker("info", "--format", "{{.ServerVersion}}")
+	return err == nil
+}
+
+// Start generates a key pair and starts an sshd container that accepts it
+func Start() (*Server, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("docker not found in PATH: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "sshharness-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{dir: dir, KeyPath: filepath.Join(dir, "id_ed25519")}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "sshharness")
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+	if err := os.WriteFile(s.KeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		s.Stop()
+		return nil, err
+	}
+	sshPub, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+
+	s.ContainerID, err = docker("run", "-d", "--rm",
+		"-p", "127.0.0.1::2222",
+		"-e", "USER_NAME="+User,
+		"-e", "PUBLIC_KEY="+strings.TrimSpace(string(gossh.MarshalAuthorizedKey(sshPub))),
+		"-e", "SUDO_ACCESS=true",
+		"-e", "PASSWORD_ACCESS=false",
+		Image)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+
+	s.Addr, err = docker("port", s.ContainerID, "2222/tcp")
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+	// docker port may list an IPv6 binding as well; use the first
+	s.Addr = strings.SplitN(s.Addr, "\n", 2)[0]
+	return s, nil
+}
+
+// connectTimeout bounds how long Client waits for sshd to start
+const connectTimeout = 5 * time.Minute
+
+// Client connects the builder's SSH client to the container, retrying while sshd starts
+func (s *Server) Client() (*ssh.Client, error) {
+	c, err := ssh.New(s.KeyPath, User)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := c.Connect(ctx, s.Addr); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Stop removes the container and the generated key
+func (s *Server) Stop() error {
+	var errs []error
+	if s.ContainerID != "" {
+		if _, err := docker("rm", "-f", s.ContainerID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,206 @@
+package sshharness
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/ssh"
+)
+
+// remoteDir holds the files the tests copy to the container
+const remoteDir = "/tmp/sshharness"
+
+// server and client are the container started by TestMain and a connection to it, or nil when Docker is
+// unavailable
+var (
+	server *Server
+	client *ssh.Client
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	if !Available() {
+		return m.Run()
+	}
+	var err error
+	server, err = Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer server.Stop()
+	client, err = server.Client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to sshd container: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+	if err := client.ExecuteCommand("mkdir -p " + remoteDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// connected returns the shared client, skipping the test without Docker
+func connected(t *testing.T) *ssh.Client {
+	t.Helper()
+	if client == nil {
+		t.Skip("Docker is not available")
+	}
+	return client
+}
+
+func TestCopyFilePreservesContentAndSetsMode(t *testing.T) {
+	c := connected(t)
+	content := []byte("line one\nline two with \"quotes\" and $VARS\n\x00binary\xff")
+	local := filepath.Join(t.TempDir(), "copied.txt")
+	if err := os.WriteFile(local, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote := remoteDir + "/copied.txt"
+	if err := c.CopyFile(local, remote); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.CommandOutput("cat " + remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content mismatch: got %q, want %q", got, content)
+	}
+	mode, err := c.CommandOutput("stat -c %a " + remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := strings.TrimSpace(string(mode)); m != "644" {
+		t.Errorf("mode is %s, want 644", m)
+	}
+}
+
+func TestExecuteScriptMakesItExecutableAndRunsIt(t *testing.T) {
+	c := connected(t)
+	local := filepath.Join(t.TempDir(), "script.sh")
+	script := "#!/bin/sh\nset -e\necho ran > " + remoteDir + "/script-marker\n"
+	if err := os.WriteFile(local, []byte(script), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote := remoteDir + "/script.sh"
+	if err := c.CopyFile(local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExecuteScript(remote); err != nil {
+		t.Fatal(err)
+	}
+
+	marker, err := c.CommandOutput("cat " + remoteDir + "/script-marker")
+	if err != nil {
+		t.Fatalf("script did not run: %v", err)
+	}
+	if strings.TrimSpace(string(marker)) != "ran" {
+		t.Errorf("unexpected marker %q", marker)
+	}
+	if err := c.ExecuteCommand("test -x " + remote); err != nil {
+		t.Errorf("script is not executable: %v", err)
+	}
+}
+
+func TestExecuteCommandSurfacesExitStatus(t *testing.T) {
+	c := connected(t)
+	err := c.ExecuteCommand("exit 3")
+	var exitErr *gossh.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an exit error, got %v", err)
+	}
+	if exitErr.ExitStatus() != 3 {
+		t.Errorf("exit status %d, want 3", exitErr.ExitStatus())
+	}
+}
+
+func TestExecuteCommandReturnsWhenRemoteTimeoutFires(t *testing.T) {
+	c := connected(t)
+	start := time.Now()
+	if err := c.ExecuteCommand("timeout 1 sleep 30"); err == nil {
+		t.Fatal("expected the timed out command to fail")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("command took %s to return after its timeout", d)
+	}
+}
+
+// The builder cancels a running script by closing the client once its context is done, as in provision
+func TestCancelingContextInterruptsRunningCommand(t *testing.T) {
+	connected(t)
+	// A connection of its own, as canceling closes it
+	c, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer context.AfterFunc(ctx, func() { c.Close() })()
+	time.AfterFunc(time.Second, cancel)
+
+	start := time.Now()
+	if err := c.ExecuteCommand("sleep 30"); err == nil {
+		t.Fatal("expected the interrupted command to fail")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("command took %s to return after the context was canceled", d)
+	}
+	if ctx.Err() == nil {
+		t.Error("command returned before the context was canceled")
+	}
+}
+
+func TestCommandOutputReturnsStdoutOnly(t *testing.T) {
+	c := connected(t)
+	out, err := c.CommandOutput("echo out; echo err >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "out\n" {
+		t.Errorf("got %q, want %q", out, "out\n")
+	}
+}
+
+func TestSetOutputMirrorsStdoutAndStderr(t *testing.T) {
+	c := connected(t)
+	var buf bytes.Buffer
+	c.SetOutput(&buf)
+	defer c.SetOutput(nil)
+
+	if err := c.ExecuteCommand("echo to-stdout; echo to-stderr >&2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"to-stdout", "to-stderr"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("mirrored output %q is missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestStreamOutputStreamsStdout(t *testing.T) {
+	c := connected(t)
+	var buf bytes.Buffer
+	if err := c.StreamOutput("head -c 100000 /dev/zero | tr '\\0' a", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 100000 {
+		t.Errorf("streamed %d bytes, want 100000", buf.Len())
+	}
+}
@@ -0,0 +1,57 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// DefaultVariable is the tfvars variable the outputs are written to when none is configured
+const DefaultVariable = "hyperstack_image"
+
+// Image is the image built in one region
+type Image struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Outputs is the value of the tfvars variable: the image name and version, and the image in every region
+// that built successfully
+type Outputs struct {
+	Name    string           `json:"name"`
+	Version string           `json:"version"`
+	Regions map[string]Image `json:"regions"`
+}
+
+// FromRegional collects the successfully built images of a (possibly single-region) build
+func FromRegional(m *manifest.RegionalManifest) *Outputs {
+	out := &Outputs{Name: m.ImageName, Version: m.ImageVersion, Regions: make(map[string]Image)}
+	for _, r := range m.Regions {
+		if r.Error != "" {
+			continue
+		}
+		out.Regions[r.Region] = Image{ID: r.ImageID, Name: r.ImageName}
+	}
+	return out
+}
+
+// Write writes the outputs as a tfvars JSON file assigning them to variable
+func Write(path, variable string, out *Outputs) error {
+	if variable == "" {
+		variable = DefaultVariable
+	}
+	data, err := json.MarshalIndent(map[string]*Outputs{variable: out}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write terraform outputs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServiceName is the service.name of exported spans unless OTEL_SERVICE_NAME is set
+const DefaultServiceName = "hyperstack-builder"
+
+// flushInterval is how often finished spans are exported while a build runs
+const flushInterval = 10 * time.Second
+
+// exporter sends finished spans to an OTLP/HTTP endpoint as JSON
+type exporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	// remoteTrace and remoteParent continue a trace started by another process, from TRACEPARENT
+	remoteTrace  string
+	remoteParent string
+}
+
+var (
+	mu       sync.Mutex
+	exp      *exporter
+	current  *Span
+	finished []*Span
+	flushMu  sync.Mutex
+)
+
+// SetupFromEnv enables tracing when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT is set.
+// OTEL_EXPORTER_OTLP_HEADERS adds request headers and OTEL_SERVICE_NAME names the service. A W3C
+// TRACEPARENT continues the trace of the process that started this one.
+func SetupFromEnv() error {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); strings.HasPrefix(protocol, "grpc") {
+		return fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q, only OTLP over HTTP is supported", protocol)
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+
+	e := &exporter{
+		endpoint: endpoint,
+		headers:  make(map[string]string),
+		service:  DefaultServiceName,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		e.service = name
+	}
+	if headers := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); headers != "" {
+		for _, kv := range strings.Split(headers, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q, expected key=value", kv)
+			}
+			if unescaped, err := url.QueryUnescape(v); err == nil {
+				v = unescaped
+			}
+			e.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if tp := os.Getenv("TRACEPARENT"); tp != "" {
+		trace, parent, ok := parseTraceparent(tp)
+		if !ok {
+			slog.Warn("Ignoring invalid TRACEPARENT", "traceparent", tp)
+		} else {
+			e.remoteTrace, e.remoteParent = trace, parent
+		}
+	}
+
+	mu.Lock()
+	exp = e
+	mu.Unlock()
+	go func() {
+		for range time.Tick(flushInterval) {
+			Flush()
+		}
+	}()
+	return nil
+}
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return exp != nil
+}
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Span is a timed operation. A nil Span, returned while tracing is disabled, ignores every call.
+type Span struct {
+	name     string
+	traceID  string
+	spanID   string
+	parentID string
+	parent   *Span
+	isCurr   bool
+	start    time.Time
+	end      time.Time
+	attrs    []Attr
+	err      error
+}
+
+// Start begins a span as a child of the current span. Code without a build context of its own, such as
+// the API and SSH clients, uses it so its spans land under the phase or script that is running.
+func Start(name string, attrs ...Attr) *Span {
+	mu.Lock()
+	defer mu.Unlock()
+	return startLocked(name, attrs)
+}
+
+// StartCurrent begins a span as a child of the current span and makes it the current span until it ends
+func StartCurrent(name string, attrs ...Attr) *Span {
+	mu.Lock()
+	defer mu.Unlock()
+	s := startLocked(name, attrs)
+	if s != nil {
+		s.isCurr = true
+		current = s
+	}
+	return s
+}
+
+func startLocked(name string, attrs []Attr) *Span {
+	if exp == nil {
+		return nil
+	}
+	s := &Span{name: name, spanID: randomHex(8), start: time.Now(), attrs: attrs}
+	switch {
+	case current != nil:
+		s.traceID, s.parentID, s.parent = current.traceID, current.spanID, current
+	case exp.remoteTrace != "":
+		s.traceID, s.parentID = exp.remoteTrace, exp.remoteParent
+	default:
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes the span, marking it failed if err is not nil, and restores its parent as the current span
+// if it was current
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	if s.isCurr && current == s {
+		current = s.parent
+		// A parent that already ended can't be current again
+		for current != nil && !current.end.IsZero() {
+			current = current.parent
+		}
+	}
+	finished = append(finished, s)
+}
+
+// EndAll ends the current span and every running span it descends from with err, for a process about to
+// exit before the code that started them can end them
+func EndAll(err error) {
+	for {
+		mu.Lock()
+		s := current
+		mu.Unlock()
+		if s == nil {
+			return
+		}
+		s.End(err)
+	}
+}
+
+// Traceparent returns the W3C traceparent of the current span, so another process can continue the trace,
+// or "" when tracing is disabled or no span is running
+func Traceparent() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", current.traceID, current.spanID)
+}
+
+// Flush exports the spans finished so far. Failures are logged, as tracing never fails a build.
+func Flush() {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	mu.Lock()
+	e, spans := exp, finished
+	finished = nil
+	mu.Unlock()
+	if e == nil || len(spans) == 0 {
+		return
+	}
+	if err := e.export(spans); err != nil {
+		slog.Warn("Failed to export trace spans", "endpoint", e.endpoint, "spans", len(spans), "error", err)
+	}
+}
+
+// export POSTs the spans in the OTLP JSON encoding
+func (e *exporter) export(spans []*Span) error {
+	otlpSpans := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            map[string]any{"code": 1}, // STATUS_CODE_OK
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		if s.err != nil {
+			span["status"] = map[string]any{"code": 2, "message": s.err.Error()} // STATUS_CODE_ERROR
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+	payload := map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": otlpAttributes([]Attr{String("service.name", e.service)}),
+			},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": DefaultServiceName},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// otlpAttributes encodes attributes as OTLP key/value pairs
+func otlpAttributes(attrs []Attr) []map[string]any {
+	encoded := make([]map[string]any, 0, len(attrs))
+	for _, a := range attrs {
+		var value map[string]any
+		switch v := a.Value.(type) {
+		case int:
+			// 64-bit integers are strings in the OTLP JSON encoding
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]any{"key": a.Key, "value": value})
+	}
+	return encoded
+}
+
+// parseTraceparent returns the trace and parent span IDs of a W3C traceparent header
+func parseTraceparent(tp string) (trace, parent string, ok bool) {
+	parts := strings.Split(tp, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// randomHex returns n random bytes, hex-encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEndAllExportsRunningSpans(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", srv.URL+"/v1/traces")
+	if err := SetupFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	StartCurrent("build-command")
+	StartCurrent("provision")
+	EndAll(errors.New("script failed"))
+	Flush()
+
+	if Traceparent() != "" {
+		t.Errorf("a span is still current after EndAll")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	exported := strings.Join(bodies, "\n")
+	for _, name := range []string{`"build-command"`, `"provision"`, "script failed"} {
+		if !strings.Contains(exported, name) {
+			t.Errorf("exported spans are missing %s: %s", name, exported)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package versioning
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Auto is the image_version value that asks the builder to compute the next version
+const Auto = "auto"
+
+// Supported version schemes
+const (
+	SchemeCalVer  = "calver"  // YYYYMM.DD.N, N counting builds on the same day
+	SchemeSemVer  = "semver"  // MAJOR.MINOR.PATCH, bumping the patch
+	SchemeCounter = "counter" // 1, 2, 3, ...
+)
+
+// versionPattern matches the versions of every scheme, and others starting with a number such as
+// 1.2.0-rc1, but not the rest of a longer image name such as cuda_12.4
+var versionPattern = regexp.MustCompile(`^v?[0-9][0-9A-Za-z.+-]*$`)
+
+// Valid reports whether v looks like an image version rather than part of an image name
+func Valid(v string) bool {
+	return versionPattern.MatchString(v)
+}
+
+// Existing returns the versions of images named <imageName>_<version>
+func Existing(imageNames []string, imageName string) []string {
+	prefix := imageName + "_"
+	var versions []string
+	for _, name := range imageNames {
+		if strings.HasPrefix(name, prefix) {
+			versions = append(versions, strings.TrimPrefix(name, prefix))
+		}
+	}
+	return versions
+}
+
+// Next returns the version following the highest existing version under the scheme.
+// Versions that don't parse under the scheme are ignored.
+func Next(scheme string, existing []string, now time.Time) (string, error) {
+	switch scheme {
+	case "", SchemeCalVer:
+		prefix := now.UTC().Format("200601.02") + "."
+		next := 0
+		for _, v := range existing {
+			if !strings.HasPrefix(v, prefix) {
+				continue
+			}
+			if n, err := strconv.Atoi(strings.TrimPrefix(v, prefix)); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+		return fmt.Sprintf("%s%d", prefix, next), nil
+
+	case SchemeSemVer:
+		var highest []int
+		for _, v := range existing {
+			parts, ok := parseSemVer(v)
+			if ok && (highest == nil || less(highest, parts)) {
+				highest = parts
+			}
+		}
+		if highest == nil {
+			return "1.0.0", nil
+		}
+		return fmt.Sprintf("%d.%d.%d", highest[0], highest[1], highest[2]+1), nil
+
+	case SchemeCounter:
+		highest := 0
+		for _, v := range existing {
+			if n, err := strconv.Atoi(v); err == nil && n > highest {
+				highest = n
+			}
+		}
+		return strconv.Itoa(highest + 1), nil
+
+	default:
+		return "", fmt.Errorf("unknown version scheme %q, expected one of: %s, %s, %s", scheme, SchemeCalVer, SchemeSemVer, SchemeCounter)
+	}
+}
+
+func parseSemVer(v string) ([]int, bool) {
+	fields := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(fields) != 3 {
+		return nil, false
+	}
+	parts := make([]int, 3)
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+func less(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+func runImportKeypair(args []string) error {
+	fs := flag.NewFlagSet("import-keypair", flag.ExitOnError)
+	publicKey := fs.String("public-key", "~/.ssh/id_rsa.pub", "SSH public key to import")
+	environment := fs.String("environment", "", "environment to import the keypair into")
+	// The name may come before or after the flags
+	var names []string
+	for fs.Parse(args); fs.NArg() > 0; fs.Parse(args) {
+		names = append(names, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(names) != 1 || *environment == "" {
+		return withExitCode(exitConfig, fmt.Errorf("usage: import-keypair <name> --environment <env> [--public-key <path>]"))
+	}
+	key, err := builder.ReadPublicKey(*publicKey)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	kp, err := hyperstackClient.ImportKeypair(ctx, names[0], *environment, key)
+	if err != nil {
+		return apiFailure(err)
+	}
+	slog.Info("Imported keypair", "keypair", kp.Name, "id", kp.ID, "environment", *environment, "fingerprint", kp.Fingerprint)
+	return nil
+}
+
+func runDeleteKeypair(args []string) error {
+	fs := flag.NewFlagSet("delete-keypair", flag.ExitOnError)
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	ids, err := parseIDs(fs, args)
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if len(ids) == 0 {
+		return withExitCode(exitConfig, fmt.Errorf("usage: delete-keypair <id>... [--force]"))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	// There is no endpoint for a single keypair, so look them up in the list
+	keypairs, err := hyperstackClient.ListKeypairs(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, err)
+	}
+	byID := make(map[int]types.Keypair, len(keypairs))
+	for _, kp := range keypairs {
+		byID[kp.ID] = kp
+	}
+
+	for _, id := range ids {
+		if _, ok := byID[id]; !ok {
+			return apiFailure(fmt.Errorf("keypair %d %w", id, client.ErrNotFound))
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT\tFINGERPRINT")
+	for _, id := range ids {
+		kp := byID[id]
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", kp.ID, kp.Name, kp.Environment.Name, kp.Fingerprint)
+	}
+	w.Flush()
+
+	if !*force {
+		ok, err := confirm(fmt.Sprintf("Delete %d keypair(s)?", len(ids)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			slog.Info("Nothing was deleted")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := hyperstackClient.DeleteKeypair(ctx, id); err != nil {
+			slog.Error("Failed to delete keypair", "keypair_id", id, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Deleted keypair", "keypair_id", id)
+	}
+	if failed > 0 {
+		return withExitCode(exitAPI, fmt.Errorf("%d of %d keypairs could not be deleted", failed, len(ids)))
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// matrixResult is the outcome of one build of a matrix
+type matrixResult struct {
+	ImageName     string                   `json:"image_name"`
+	ImageVersion  string                   `json:"image_version"`
+	BaseImageName string                   `json:"base_image_name"`
+	FlavorName    string                   `json:"flavor_name"`
+	DriverVersion string                   `json:"driver_version,omitempty"`
+	Images        []manifest.RegionalImage `json:"images,omitempty"`
+	Error         string                   `json:"error,omitempty"`
+
+	code int // Exit code of the failed build
+}
+
+// checkMatrix rejects a matrix that cannot be expanded into independent builds
+func checkMatrix(cfg *types.Config) error {
+	if cfg.Matrix == nil {
+		return nil
+	}
+	if len(cfg.Stages) > 0 {
+		return fmt.Errorf("matrix cannot be combined with stages")
+	}
+	if cfg.Matrix.Concurrency < 0 {
+		return fmt.Errorf("matrix concurrency must not be negative")
+	}
+	_, err := config.ExpandMatrix(cfg)
+	return err
+}
+
+// buildMatrix runs a build for every combination of the matrix, at most matrix.concurrency at a time, each in
+// a builder process of its own, and writes matrix.json listing the images they produced
+func buildMatrix(ctx context.Context, hyperstackClient builder.API, cfg *types.Config, flagArgs []string) error {
+	builds, err := config.ExpandMatrix(cfg)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the builder executable: %w", err)
+	}
+
+	// The children read their expanded config from here
+	configDir, err := os.MkdirTemp("", "hyperstack-matrix-")
+	if err != nil {
+		return fmt.Errorf("failed to create matrix config directory: %w", err)
+	}
+	defer os.RemoveAll(configDir)
+
+	concurrency := cfg.Matrix.Concurrency
+	if concurrency <= 0 {
+		// With max_parallel the VM slots do the queuing, including for entries that build several regions
+		concurrency = 1
+		if cfg.MaxParallel > 0 {
+			concurrency = cfg.MaxParallel
+		}
+	}
+	configs := make([]*types.Config, len(builds))
+	for i, build := range builds {
+		configs[i] = build.Config
+	}
+	if err := builder.CheckMatrixQuotas(ctx, hyperstackClient, configs, concurrency, cfg.MaxParallel > 0); err != nil {
+		return err
+	}
+	slog.Info("Building matrix", "image_name", cfg.ImageName, "builds", len(builds), "concurrency", concurrency)
+
+	results := make([]matrixResult, len(builds))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, build := range builds {
+		buildCfg := build.Config
+		results[i] = matrixResult{
+			ImageName:     buildCfg.ImageName,
+			BaseImageName: buildCfg.BaseImageName,
+			FlavorName:    buildCfg.FlavorName,
+			DriverVersion: buildCfg.ScriptEnv[config.DriverVersionEnv],
+		}
+		// Each image name has its own versions, so "auto" is resolved per build
+		if err := resolveVersion(ctx, hyperstackClient, buildCfg); err != nil {
+			results[i].Error, results[i].code = err.Error(), exitCode(err)
+			continue
+		}
+		results[i].ImageVersion = buildCfg.ImageVersion
+
+		path := filepath.Join(configDir, strings.Join(build.Keys, "-")+".json")
+		if err := config.Save(buildCfg, path); err != nil {
+			results[i].Error, results[i].code = fmt.Sprintf("failed to write config: %v", err), exitFailure
+			continue
+		}
+
+		wg.Add(1)
+		go func(res *matrixResult, buildCfg *types.Config, path, prefix string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			buildMatrixEntry(ctx, exe, buildCfg, path, prefix, flagArgs, concurrency, res)
+		}(&results[i], buildCfg, path, "["+strings.Join(build.Keys, "/")+"] ")
+	}
+	wg.Wait()
+
+	path := filepath.Join(builder.ArtifactsRoot(cfg), "matrix.json")
+	if err := manifest.WriteJSON(results, path); err != nil {
+		return fmt.Errorf("failed to write matrix manifest: %w", err)
+	}
+	slog.Info("Wrote matrix manifest", "path", path)
+
+	codes := writeMatrixSummary(results)
+	if len(codes) > 0 {
+		return withExitCode(commonExitCode(codes), fmt.Errorf("%d of %d matrix builds failed", len(codes), len(results)))
+	}
+	return nil
+}
+
+// buildMatrixEntry runs the build of one matrix entry and records the images it produced, or why it failed
+func buildMatrixEntry(ctx context.Context, exe string, cfg *types.Config, configPath, prefix string, flagArgs []string, siblings int, res *matrixResult) {
+	fail := func(code int, format string, args ...any) {
+		res.Error, res.code = fmt.Sprintf(format, args...), code
+	}
+
+	slog.Info("Starting matrix build", "image_name", cfg.ImageName)
+	// Later flags win, so the already resolved version overrides anything passed through
+	args := append([]string{"build", configPath}, flagArgs...)
+	args = append(args, "--image-version", cfg.ImageVersion)
+	if err := runChild(ctx, exe, args, prefix, siblings); err != nil {
+		slog.Error("Matrix build failed", "image_name", cfg.ImageName, "error", err)
+		fail(childExitCode(err), "build failed: %v", err)
+		return
+	}
+
+	artifactsPath := artifacts.PathFor(builder.ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+	if len(cfg.Regions) > 0 {
+		data, err := os.ReadFile(filepath.Join(artifactsPath, "regions.json"))
+		if err != nil {
+			fail(exitFailure, "failed to read regional manifest: %v", err)
+			return
+		}
+		var regional manifest.RegionalManifest
+		if err := json.Unmarshal(data, &regional); err != nil {
+			fail(exitFailure, "failed to parse regional manifest: %v", err)
+			return
+		}
+		res.Images = regional.Regions
+		return
+	}
+
+	m, err := manifest.Read(filepath.Join(artifactsPath, "manifest.json"))
+	if err != nil {
+		fail(exitFailure, "failed to read manifest: %v", err)
+		return
+	}
+	res.Images = []manifest.RegionalImage{{Region: cfg.Region, ImageID: m.ImageID, ImageName: m.ImageName}}
+}
+
+// writeMatrixSummary prints a table of the matrix builds and returns the exit codes of the failed ones
+func writeMatrixSummary(results []matrixResult) []int {
+	var codes []int
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tBASE IMAGE\tFLAVOR\tDRIVER\tSTATUS\tIMAGE IDS")
+	for _, res := range results {
+		status := "succeeded"
+		if res.Error != "" {
+			status = "failed"
+			codes = append(codes, res.code)
+		}
+		var ids []string
+		for _, image := range res.Images {
+			ids = append(ids, strconv.Itoa(image.ImageID))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", res.ImageName, res.BaseImageName, res.FlavorName,
+			orDash(res.DriverVersion), status, orDash(strings.Join(ids, ",")))
+	}
+	w.Flush()
+	return codes
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/capi"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/dotenv"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/publish"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/terraform"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// writeOutputs hands the built images to downstream tooling once every region has been built.
+// Failures are logged, not returned, since the images themselves are already usable.
+func writeOutputs(cfg *types.Config, regional *manifest.RegionalManifest) {
+	artifactsDir := artifacts.PathFor(builder.ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+
+	if tf := cfg.Terraform; tf != nil && tf.Enabled {
+		writeTerraformOutputs(tf, regional, artifactsDir)
+	}
+	if c := cfg.CAPI; c != nil && c.Enabled {
+		writeMachineTemplates(cfg, regional, artifactsDir)
+	}
+	if d := cfg.Dotenv; d != nil && d.Enabled {
+		writeDotenv(cfg, regional)
+	}
+}
+
+// writeTerraformOutputs writes the per-region image IDs as tfvars JSON and optionally publishes the file
+func writeTerraformOutputs(tf *types.TerraformConfig, regional *manifest.RegionalManifest, artifactsDir string) {
+	path := tf.Path
+	if path == "" {
+		path = filepath.Join(artifactsDir, "images.auto.tfvars.json")
+	}
+	if err := terraform.Write(path, tf.Variable, terraform.FromRegional(regional)); err != nil {
+		slog.Warn("Failed to write Terraform outputs", "error", err)
+		return
+	}
+	slog.Info("Wrote Terraform outputs", "path", path)
+
+	if tf.Publish != "" {
+		if err := publish.UploadFile(path, tf.Publish); err != nil {
+			slog.Warn("Failed to publish Terraform outputs", "error", err)
+			return
+		}
+		slog.Info("Published Terraform outputs", "target", tf.Publish)
+	}
+}
+
+// writeMachineTemplates writes a Cluster API OpenStackMachineTemplate for every region the image was built in
+func writeMachineTemplates(cfg *types.Config, regional *manifest.RegionalManifest, artifactsDir string) {
+	prefix := cfg.CAPI.Name
+	if prefix == "" {
+		prefix = cfg.ImageName
+	}
+
+	var templates []capi.Template
+	for _, entry := range regional.Regions {
+		if entry.Error != "" {
+			continue
+		}
+		regionCfg := cfg
+		for _, replica := range cfg.Replicas {
+			if replica.Region == entry.Region {
+				regionCfg = replicaConfig(cfg, replica)
+			}
+		}
+
+		region := ""
+		if len(regional.Regions) > 1 {
+			region = entry.Region
+		}
+
+		labels := map[string]string{
+			capi.RegionLabel:       entry.Region,
+			capi.ImageVersionLabel: cfg.ImageVersion,
+		}
+		for k, v := range cfg.CAPI.Labels {
+			labels[k] = v
+		}
+
+		t := capi.Template{
+			Name:       capi.Name(prefix, cfg.ImageVersion, region),
+			Namespace:  cfg.CAPI.Namespace,
+			Region:     entry.Region,
+			Flavor:     cfg.CAPI.Flavor,
+			SSHKeyName: cfg.CAPI.SSHKeyName,
+			ImageID:    entry.ImageID,
+			ImageName:  entry.ImageName,
+			Labels:     labels,
+		}
+		if t.Flavor == "" {
+			t.Flavor = regionCfg.FlavorName
+		}
+		if t.SSHKeyName == "" {
+			t.SSHKeyName = regionCfg.KeypairName
+		}
+		templates = append(templates, t)
+	}
+
+	path := cfg.CAPI.Path
+	if path == "" {
+		path = filepath.Join(artifactsDir, "machine-templates.yaml")
+	}
+	if err := capi.Write(path, templates); err != nil {
+		slog.Warn("Failed to write Cluster API machine templates", "error", err)
+		return
+	}
+	slog.Info("Wrote Cluster API machine templates", "path", path, "count", len(templates))
+}
+
+// writeDotenv writes the primary region's image, plus the image of every region when replicated, as CI variables.
+// The path is fixed rather than per version so CI configs can reference it before the version is known.
+func writeDotenv(cfg *types.Config, regional *manifest.RegionalManifest) {
+	primary := regional.Regions[0]
+	vars := []dotenv.Var{
+		{Key: "IMAGE_ID", Value: strconv.Itoa(primary.ImageID)},
+		{Key: "IMAGE_NAME", Value: primary.ImageName},
+		{Key: "IMAGE_VERSION", Value: regional.ImageVersion},
+		{Key: "REGION", Value: primary.Region},
+	}
+	if len(regional.Regions) > 1 {
+		for _, entry := range regional.Regions {
+			if entry.Error != "" {
+				continue
+			}
+			vars = append(vars,
+				dotenv.Var{Key: dotenv.Key("IMAGE_ID", entry.Region), Value: strconv.Itoa(entry.ImageID)},
+				dotenv.Var{Key: dotenv.Key("IMAGE_NAME", entry.Region), Value: entry.ImageName},
+			)
+		}
+	}
+
+	path := cfg.Dotenv.Path
+	if path == "" {
+		path = filepath.Join(builder.ArtifactsRoot(cfg), "build.env")
+	}
+	if err := dotenv.Write(path, vars); err != nil {
+		slog.Warn("Failed to write dotenv report", "error", err)
+		return
+	}
+	slog.Info("Wrote dotenv report", "path", path)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// orderStages returns stages sorted so that every stage runs after its base stage
+func orderStages(stages []types.Stage) ([]types.Stage, error) {
+	byName := make(map[string]types.Stage, len(stages))
+	for _, stage := range stages {
+		if stage.Name == "" {
+			return nil, fmt.Errorf("every stage must have a name")
+		}
+		if _, exists := byName[stage.Name]; exists {
+			return nil, fmt.Errorf("duplicate stage name: %s", stage.Name)
+		}
+		byName[stage.Name] = stage
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(stages))
+	var ordered []types.Stage
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("stage %s has a circular base_stage dependency", name)
+		}
+		state[name] = visiting
+
+		stage := byName[name]
+		if stage.BaseStage != "" {
+			if _, ok := byName[stage.BaseStage]; !ok {
+				return fmt.Errorf("stage %s references unknown base_stage %s", name, stage.BaseStage)
+			}
+			if err := visit(stage.BaseStage); err != nil {
+				return err
+			}
+		}
+
+		state[name] = done
+		ordered = append(ordered, stage)
+		return nil
+	}
+
+	// Visit in declaration order so independent stages keep their configured order
+	for _, stage := range stages {
+		if err := visit(stage.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// stageConfig derives the build config for a stage from the pipeline config
+func stageConfig(cfg *types.Config, stage types.Stage, built map[string]*types.Image) *types.Config {
+	stageCfg := *cfg
+	stageCfg.Stages = nil
+	stageCfg.ImageName = stage.ImageName
+	if stage.ImageVersion != "" {
+		stageCfg.ImageVersion = stage.ImageVersion
+	}
+	if stage.FlavorName != "" {
+		stageCfg.FlavorName = stage.FlavorName
+	}
+	if stage.BaseStage != "" {
+		stageCfg.BaseImageName = built[stage.BaseStage].Name
+	}
+	stageCfg.Tags = append(append([]string{}, cfg.Tags...), stage.Tags...)
+	return &stageCfg
+}
+
+// runPipeline builds every stage in dependency order, feeding built images into dependent stages
+func runPipeline(ctx context.Context, b *builder.Builder, cfg *types.Config) error {
+	stages, err := orderStages(cfg.Stages)
+	if err != nil {
+		return err
+	}
+
+	built := make(map[string]*types.Image, len(stages))
+	var cleanupErrs []error
+	for i, stage := range stages {
+		stageCfg := stageConfig(cfg, stage, built)
+		if err := resolveVersion(ctx, b.API, stageCfg); err != nil {
+			return fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+
+		scripts := stage.Scripts
+		if len(scripts) == 0 {
+			scripts = scriptsFor(stageCfg)
+		}
+
+		slog.Info("Starting stage", "stage", stage.Name, "index", i+1, "total", len(stages), "base_image", stageCfg.BaseImageName)
+		res, err := b.Build(ctx, stageCfg, scripts)
+		if err != nil {
+			return fmt.Errorf("stage %s failed: %w", stage.Name, err)
+		}
+		built[stage.Name] = res.Image
+		writeOutputs(stageCfg, singleRegion(stageCfg, res.Image))
+		pruneAfterBuild(ctx, b.API, stageCfg)
+		if res.CleanupErr != nil {
+			cleanupErrs = append(cleanupErrs, fmt.Errorf("stage %s: %w", stage.Name, res.CleanupErr))
+		}
+	}
+
+	slog.Info("Pipeline completed successfully")
+	for _, stage := range stages {
+		slog.Info("Stage image", "stage", stage.Name, "image_name", built[stage.Name].Name, "image_id", built[stage.Name].ID)
+	}
+	if len(cleanupErrs) > 0 {
+		return withExitCode(exitCleanup, fmt.Errorf("images were built but not every build VM was deleted: %w", errors.Join(cleanupErrs...)))
+	}
+	return nil
+}
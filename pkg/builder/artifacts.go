@@ -0,0 +1,74 @@
+package builder
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/hcppacker"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/publish"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/signing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// writeHCPPackerMetadata writes HCP Packer registry metadata and a Packer manifest into the artifacts directory
+func writeHCPPackerMetadata(cfg *types.Config, m *manifest.Manifest, artifactsDir *artifacts.Dir) {
+	bucket := cfg.HCPPacker.BucketName
+	if bucket == "" {
+		bucket = strings.ReplaceAll(cfg.ImageName, "_", "-")
+	}
+
+	files := map[string]any{
+		"hcp-packer.json":      hcppacker.FromManifest(m, bucket, cfg.HCPPacker.BucketLabels),
+		"packer-manifest.json": hcppacker.PackerManifestFromManifest(m),
+	}
+	for name, v := range files {
+		if err := manifest.WriteJSON(v, artifactsDir.File(name)); err != nil {
+			slog.Warn("Failed to write HCP Packer metadata", "file", name, "error", err)
+			continue
+		}
+		slog.Info("Wrote HCP Packer metadata", "path", artifactsDir.File(name))
+	}
+}
+
+// finalizeArtifacts archives and publishes the artifacts directory once the build has finished, successfully or not
+func finalizeArtifacts(cfg *types.ArtifactsConfig, artifactsDir *artifacts.Dir) {
+	if cfg.Archive {
+		archivePath, err := artifactsDir.Archive()
+		if err != nil {
+			slog.Warn("Failed to archive build artifacts", "error", err)
+		} else {
+			slog.Info("Archived build artifacts", "path", archivePath)
+		}
+	}
+
+	if cfg.Publish != "" {
+		target, err := publish.Upload(artifactsDir.Path, cfg.Publish)
+		if err != nil {
+			slog.Warn("Failed to publish build artifacts", "error", err)
+			return
+		}
+		slog.Info("Published build artifacts", "target", target)
+	}
+}
+
+// signArtifacts signs the manifest and SBOM of a build with cosign
+func signArtifacts(cfg *types.SigningConfig, artifactsDir *artifacts.Dir, manifestPath string) error {
+	for _, path := range signing.Files(artifactsDir.Path, manifestPath) {
+		bundle, err := signing.Sign(path, signing.SignOptions{Key: cfg.Key})
+		if err != nil {
+			return err
+		}
+		slog.Info("Signed file", "path", path, "bundle", bundle)
+	}
+	return nil
+}
+
+// ArtifactsRoot returns the configured artifacts root directory
+func ArtifactsRoot(cfg *types.Config) string {
+	if cfg.Artifacts != nil && cfg.Artifacts.Dir != "" {
+		return cfg.Artifacts.Dir
+	}
+	return artifacts.DefaultRoot
+}
@@ -0,0 +1,714 @@
+// Package builder builds Hyperstack images: it provisions a VM, snapshots it and turns the snapshot into
+// a tested, labeled image.
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/buildstate"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/compliance"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/lock"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/logging"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metrics"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/notify"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/policy"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/ssh"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// API is the part of the Hyperstack API the builder uses, implemented by *client.HyperstackClient
+type API interface {
+	CreateVM(ctx context.Context, config types.Config) (*types.VMCreateResponse, error)
+	GetVMDetails(ctx context.Context, vmID int) (*types.VMInstance, error)
+	WaitForVMReady(ctx context.Context, vmID int) (string, error)
+	ListVMs(ctx context.Context) ([]types.VMInstance, error)
+	DetachFloatingIP(ctx context.Context, vmID int) error
+	DeleteVM(ctx context.Context, vmID int) error
+	WaitForVMStatus(ctx context.Context, vmID int, status string) error
+	StopVM(ctx context.Context, vmID int) error
+	HardRebootVM(ctx context.Context, vmID int) error
+	ShelveVM(ctx context.Context, vmID int) error
+
+	CreateSnapshot(ctx context.Context, vmID int, name string, labels []string) (*types.Snapshot, error)
+	WaitForSnapshotReady(ctx context.Context, snapshotID int) error
+	ListSnapshots(ctx context.Context) ([]types.Snapshot, error)
+	DeleteSnapshot(ctx context.Context, snapshotID int) error
+
+	CreateImageFromSnapshot(ctx context.Context, snapshotID int, name string, labels []string) (*types.Image, error)
+	WaitForImageReady(ctx context.Context, imageID int) error
+	GetImage(ctx context.Context, imageID int) (*types.Image, error)
+	ListImages(ctx context.Context) ([]types.Image, error)
+	UpdateImage(ctx context.Context, imageID int, imageName string, labels []string) (*types.Image, error)
+	DeleteImage(ctx context.Context, imageID int) error
+
+	ListRegions(ctx context.Context) ([]types.Region, error)
+	ListFlavors(ctx context.Context) ([]types.Flavor, error)
+	ListStocks(ctx context.Context) ([]types.Stock, error)
+	ListQuotas(ctx context.Context) ([]types.Quota, error)
+	ListKeypairs(ctx context.Context) ([]types.Keypair, error)
+	ImportKeypair(ctx context.Context, name, environmentName, publicKey string) (*types.Keypair, error)
+	ListEnvironments(ctx context.Context) ([]types.Environment, error)
+
+	CreateVolume(ctx context.Context, name, environmentName string, sizeGB int, volumeType string) (*types.Volume, error)
+	WaitForVolumeStatus(ctx context.Context, volumeID int, status string) error
+	AttachVolume(ctx context.Context, vmID, volumeID int) error
+	DetachVolume(ctx context.Context, vmID, volumeID int) error
+	DeleteVolume(ctx context.Context, volumeID int) error
+	CreateEnvironment(ctx context.Context, name, region string) (*types.Environment, error)
+}
+
+// Shell runs commands on a VM, implemented by *ssh.Client
+type Shell interface {
+	Connect(ctx context.Context, host string) error
+	Close() error
+	SetOutput(w io.Writer)
+	SetStep(step string)
+	SetEnv(env map[string]string)
+	CopyFile(localPath, remotePath string) error
+	ExecuteCommand(command string) error
+	ExecuteScript(scriptPath string) error
+	CommandOutput(command string) ([]byte, error)
+	StreamOutput(command string, w io.Writer) error
+}
+
+// Dialer creates a Shell that authenticates with the given key and user
+type Dialer func(privateKeyPath, username string) (Shell, error)
+
+// DialSSH is the default Dialer, connecting with an *ssh.Client
+func DialSSH(privateKeyPath, username string) (Shell, error) {
+	sshClient, err := ssh.New(privateKeyPath, username)
+	if err != nil {
+		// Avoid returning a typed nil inside a non-nil Shell
+		return nil, err
+	}
+	return sshClient, nil
+}
+
+var (
+	_ API   = (*client.HyperstackClient)(nil)
+	_ Shell = (*ssh.Client)(nil)
+)
+
+// Options configure a Builder
+type Options struct {
+	API       API              // Required
+	Dial      Dialer           // Defaults to DialSSH
+	ScriptDir string           // Directory the provisioning scripts are read from, defaults to "scripts"
+	FilesDir  string           // Directory the LocalPath of Files is relative to, defaults to "files"
+	Files     []FileDeployment // Files copied onto the VM after the scripts have run
+}
+
+// Builder runs image builds against the injected API and VM shells
+type Builder struct {
+	API       API
+	Dial      Dialer
+	ScriptDir string
+	FilesDir  string
+	Files     []FileDeployment
+}
+
+// New returns a builder for the given options
+func New(opts Options) *Builder {
+	b := &Builder{
+		API:       opts.API,
+		Dial:      opts.Dial,
+		ScriptDir: opts.ScriptDir,
+		FilesDir:  opts.FilesDir,
+		Files:     opts.Files,
+	}
+	if b.Dial == nil {
+		b.Dial = DialSSH
+	}
+	if b.ScriptDir == "" {
+		b.ScriptDir = "scripts"
+	}
+	if b.FilesDir == "" {
+		b.FilesDir = "files"
+	}
+	return b
+}
+
+// Result is the outcome of a build. BuildID and Phases are set even when the build fails, Image and
+// Manifest only when it created an image.
+type Result struct {
+	BuildID  string
+	Image    *types.Image
+	Manifest *manifest.Manifest
+	Phases   []manifest.Phase
+	KeptVM   *KeptVM // Set when a failed build's VM was kept for debugging
+	// CleanupErr is set when the image was built but the build VM could not be deleted
+	CleanupErr error
+}
+
+// KeptVM is a failed build's VM left running for debugging
+type KeptVM struct {
+	ID             int
+	Name           string
+	IP             string
+	PrivateKeyPath string
+	Shelved        bool // Shelved with shelve_kept_vm, to be unshelved before logging in
+}
+
+// SSHCommand returns the command that logs into the VM
+func (k *KeptVM) SSHCommand() string {
+	return fmt.Sprintf("ssh -i %s ubuntu@%s", k.PrivateKeyPath, k.IP)
+}
+
+// Phases a build can be resumed from
+const (
+	ResumeFromProvision = "provision"
+	ResumeFromSnapshot  = "snapshot"
+)
+
+// ResumePoint names an already running build VM, such as one kept by a failed build, and the phase to
+// continue from on it
+type ResumePoint struct {
+	VMID int
+	From string // ResumeFromProvision or ResumeFromSnapshot
+}
+
+// Build builds a single image and records the outcome in history. Canceling ctx aborts the build and
+// tears down what it created.
+func (b *Builder) Build(ctx context.Context, cfg *types.Config, scripts []string) (*Result, error) {
+	return b.run(ctx, cfg, scripts, nil)
+}
+
+// Resume builds a single image on an existing VM, skipping VM creation (and provisioning when resuming from
+// the snapshot phase), and records the outcome in history
+func (b *Builder) Resume(ctx context.Context, cfg *types.Config, scripts []string, resume ResumePoint) (*Result, error) {
+	if resume.From != ResumeFromProvision && resume.From != ResumeFromSnapshot {
+		return nil, fmt.Errorf("cannot resume from %q, expected %s or %s", resume.From, ResumeFromProvision, ResumeFromSnapshot)
+	}
+	if cfg.SkipSnapshot && resume.From == ResumeFromSnapshot {
+		return nil, fmt.Errorf("cannot resume from %s when skipping the snapshot", ResumeFromSnapshot)
+	}
+	return b.run(ctx, cfg, scripts, &resume)
+}
+
+// run builds a single image, from scratch or on the VM named by resume, and records the outcome
+func (b *Builder) run(ctx context.Context, cfg *types.Config, scripts []string, resume *ResumePoint) (*Result, error) {
+	startedAt := time.Now()
+	res := &Result{BuildID: history.NewID(startedAt)}
+	buildID := res.BuildID
+
+	// Tag every log line of this build with its ID
+	defer logging.StartBuild(buildID)()
+
+	metrics.BuildsStarted.Inc()
+	span := tracing.StartCurrent("build",
+		tracing.String("build.id", buildID),
+		tracing.String("image.name", cfg.ImageName),
+		tracing.String("image.version", cfg.ImageVersion),
+		tracing.String("cloud.region", cfg.Region),
+		tracing.String("vm.flavor", cfg.FlavorName),
+	)
+	phases := &phaseTimer{}
+	state, err := buildstate.Create(buildstate.DefaultDir(), buildstate.State{
+		BuildID:      buildID,
+		ImageName:    cfg.ImageName,
+		ImageVersion: cfg.ImageVersion,
+		StartedAt:    startedAt.UTC(),
+		ArtifactsDir: artifacts.PathFor(ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion),
+	})
+	if err != nil {
+		slog.Warn("Failed to write build state", "error", err)
+	} else {
+		phases.state = state
+		defer state.Remove()
+	}
+
+	err = b.build(ctx, cfg, scripts, resume, res, phases)
+	if err != nil {
+		err = &PhaseError{Phase: phases.phase, Err: err}
+	}
+	phases.finish(err)
+	if res.Image != nil {
+		span.SetAttributes(tracing.Int("image.id", res.Image.ID))
+	}
+	span.End(err)
+	phases.writeSummary(os.Stderr)
+	if res.KeptVM != nil {
+		slog.Warn("Kept build VM for debugging", "vm_id", res.KeptVM.ID, "vm_name", res.KeptVM.Name, "ip", res.KeptVM.IP)
+		fmt.Fprintf(os.Stderr, "\nBuild VM %s (ID: %d) was kept for debugging:\n  %s\nIt is deleted by `cleanup --expired` once its resource_ttl has passed.\n",
+			res.KeptVM.Name, res.KeptVM.ID, res.KeptVM.SSHCommand())
+		if res.KeptVM.Shelved {
+			fmt.Fprintf(os.Stderr, "It is shelved, unshelve it with `vm unshelve %d` before logging in.\n", res.KeptVM.ID)
+		}
+	}
+	res.Phases = phases.completed
+	if err != nil {
+		metrics.BuildsFailed.Inc()
+	} else {
+		metrics.BuildsSucceeded.Inc()
+	}
+	b.recordBuild(buildID, cfg, scripts, startedAt, phases, res.Image, err)
+	notifyBuild(buildID, cfg, startedAt, err)
+	reportFailure(buildID, cfg, startedAt, phases, err)
+	return res, err
+}
+
+// build runs the build phases in order, filling in res as it goes
+func (b *Builder) build(ctx context.Context, cfg *types.Config, scripts []string, resume *ResumePoint, res *Result, phases *phaseTimer) (err error) {
+	buildID := res.BuildID
+	startedAt := time.Now()
+
+	ttl, err := resourceTTL(cfg)
+	if err != nil {
+		return err
+	}
+	timeouts, err := config.ResolveTimeouts(cfg)
+	if err != nil {
+		return err
+	}
+	budget, budgetLimit, err := buildBudget(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Every wait and SSH session of the build ends once ctx is canceled or the build's own deadline, if any,
+	// has passed
+	defer func() {
+		if err != nil && errors.Is(context.Cause(ctx), context.Canceled) {
+			err = fmt.Errorf("build canceled: %w", err)
+		}
+	}()
+	if budget > 0 {
+		slog.Info("Build budget", "limit", budgetLimit, "budget", budget.Round(time.Second))
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, budget, fmt.Errorf("%w: ran for %s, the %s", ErrBudgetExceeded, budget.Round(time.Second), budgetLimit))
+		defer cancel()
+		defer func() {
+			if cause := context.Cause(ctx); err != nil && errors.Is(cause, ErrBudgetExceeded) {
+				err = fmt.Errorf("%w: %w", cause, err)
+			}
+		}()
+	}
+	if timeouts.Build > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Build)
+		defer cancel()
+		defer func() {
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("build exceeded its %s timeout: %w", timeouts.Build, err)
+			}
+		}()
+	}
+
+	collect := defaultCollect
+	if cfg.Artifacts != nil {
+		collect = append(append([]types.CollectSpec{}, defaultCollect...), cfg.Artifacts.Collect...)
+	}
+	newArtifacts := artifacts.New
+	if resume != nil && resume.From == ResumeFromSnapshot {
+		// The snapshot still needs what the interrupted build collected
+		newArtifacts = artifacts.Reuse
+	}
+	artifactsDir, err := newArtifacts(ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+	if err != nil {
+		return err
+	}
+	slog.Info("Writing build artifacts", "dir", artifactsDir.Path)
+	if cfg.Artifacts != nil {
+		defer finalizeArtifacts(cfg.Artifacts, artifactsDir)
+	}
+
+	// Fail before creating anything if the name or tags already violate the naming policy
+	imageName := fmt.Sprintf("%s_%s", cfg.ImageName, cfg.ImageVersion)
+	if err := policy.Precheck(cfg.Naming, imageName, cfg.Tags); err != nil {
+		return err
+	}
+	// and before the API rejects a VM made of resources that don't exist
+	if resume == nil {
+		if err := ensureEnvironment(ctx, b.API, cfg); err != nil {
+			return err
+		}
+		if err := ensureKeypair(ctx, b.API, cfg); err != nil {
+			return err
+		}
+		if err := Preflight(ctx, b.API, cfg); err != nil {
+			return err
+		}
+	}
+	if err := resolveSSHCIDR(ctx, cfg); err != nil {
+		return err
+	}
+
+	// Serialize builds of the same image name and region on this host
+	buildLock, err := lock.Acquire(claimName(cfg))
+	if errors.Is(err, lock.ErrLocked) {
+		return fmt.Errorf("%w: %w", ErrBuildInProgress, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := buildLock.Release(); err != nil {
+			slog.Warn("Failed to release build lock", "error", err)
+		}
+	}()
+
+	// Refuse to start while another host holds the API claim on this image name. A resumed VM holds it itself.
+	claims, err := findClaims(ctx, b.API, claimName(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to check build claims: %w", err)
+	}
+	for _, claim := range claims {
+		if resume == nil || claim.ID != resume.VMID {
+			return fmt.Errorf("%w: image %s is already being built in %s by VM %s (ID: %d)", ErrBuildInProgress, cfg.ImageName, cfg.Region, claim.Name, claim.ID)
+		}
+	}
+
+	// Hold one of the host's VM slots until the build and its test VMs are done
+	queued := resume == nil && cfg.MaxParallel > 0
+	if queued {
+		release, err := acquireVMSlot(ctx, cfg.MaxParallel)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	notifyStep(notify.EventStarted, buildID, cfg, startedAt, 0)
+
+	var vm types.VMInstance
+	if resume != nil {
+		slog.Info("Resuming build on existing VM", "vm_id", resume.VMID, "from", resume.From)
+		existing, err := b.API.GetVMDetails(ctx, resume.VMID)
+		if err != nil {
+			return fmt.Errorf("failed to get VM to resume: %w", err)
+		}
+		if existing.Status != "ACTIVE" {
+			return fmt.Errorf("VM %s (ID: %d) is %s, not ACTIVE", existing.Name, existing.ID, existing.Status)
+		}
+		vm = *existing
+	} else {
+		// Make VM name unique by adding timestamp, and label it with the claim
+		vmCfg := *cfg
+		vmCfg.VMName = fmt.Sprintf("%s-%d", cfg.VMName, time.Now().Unix())
+		vmCfg.Tags = append(append([]string{}, cfg.Tags...), labels.Builder, labels.BuildID(buildID), labels.Claim(claimName(cfg)), labels.Expires(time.Now().Add(ttl)))
+
+		phases.start("create-vm")
+		slog.Info("Creating virtual machine", "name", vmCfg.VMName)
+		var vmResp *types.VMCreateResponse
+		if queued {
+			vmResp, err = b.createQueuedVM(ctx, vmCfg)
+		} else {
+			vmResp, err = b.API.CreateVM(ctx, vmCfg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create VM: %w", err)
+		}
+
+		if len(vmResp.Instances) == 0 {
+			return fmt.Errorf("no instances created")
+		}
+		vm = vmResp.Instances[0]
+		slog.Info("Created VM", "name", vm.Name)
+	}
+	logging.SetVM(vm.ID)
+	phases.updateState(func(s *buildstate.State) { s.VMID = vm.ID })
+
+	// Every return before the VM is torn down below is a failure; keep the VM for debugging if asked to
+	vmTornDown := false
+	defer func() {
+		if vmTornDown {
+			return
+		}
+		// Cleanup still runs when the build was cancelled
+		cleanupCtx := context.WithoutCancel(ctx)
+		// A VM that ran out of budget is deleted even when asked to keep it
+		if cfg.KeepVMOnFailure && !errors.Is(context.Cause(ctx), ErrBudgetExceeded) {
+			res.KeptVM = keptVM(cleanupCtx, b.API, vm, cfg.PrivateKeyPath)
+			if cfg.ShelveKeptVM {
+				res.KeptVM.Shelved = shelveVM(cleanupCtx, b.API, vm.ID)
+			}
+			return
+		}
+		TeardownVM(cleanupCtx, b.API, vm.ID)
+	}()
+
+	var vmIP string
+	if resume == nil {
+		// Another host may have raced us between the check and creation; the lowest VM ID wins
+		claims, err = findClaims(ctx, b.API, claimName(cfg))
+		if err != nil {
+			return fmt.Errorf("failed to check build claims: %w", err)
+		}
+		for _, claim := range claims {
+			if claim.ID < vm.ID {
+				slog.Warn("Lost build claim", "image_name", cfg.ImageName, "region", cfg.Region, "claimed_by_vm", claim.ID)
+				TeardownVM(ctx, b.API, vm.ID)
+				vmTornDown = true
+				return fmt.Errorf("%w: image %s is already being built in %s by VM %s (ID: %d)", ErrBuildInProgress, cfg.ImageName, cfg.Region, claim.Name, claim.ID)
+			}
+		}
+
+		phases.start("wait-vm")
+		slog.Info("Waiting for VM to be ready", "timeout", timeouts.VMReady)
+		vmReadyCtx, cancel := context.WithTimeout(client.WithExpectedDuration(ctx, typicalPhaseDuration(cfg, "wait-vm")), timeouts.VMReady)
+		vmIP, err = b.API.WaitForVMReady(vmReadyCtx, vm.ID)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("VM failed to become ready: %w", err)
+		}
+	}
+
+	// Get VM details for additional information
+	slog.Info("Getting VM details")
+	vmDetails, err := b.API.GetVMDetails(ctx, vm.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get VM details: %w", err)
+	}
+	if resume != nil {
+		vmIP = vmDetails.FloatingIP
+		if vmIP == "" {
+			return fmt.Errorf("VM %s (ID: %d) has no floating IP", vm.Name, vm.ID)
+		}
+	}
+
+	phases.updateState(func(s *buildstate.State) { s.VMIP = vmIP })
+	slog.Info("VM is ready", "ip", vmIP, "floating_ip", vmDetails.FloatingIP, "fixed_ip", vmDetails.FixedIP)
+
+	lineage, err := b.computeLineage(vmDetails.Image.ID, cfg.BaseImageName, scripts, b.files(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to compute image lineage: %w", err)
+	}
+	var complianceReport *compliance.Report
+	if resume == nil || resume.From == ResumeFromProvision {
+		phases.start("provision")
+		if cfg.RebootUnreachable {
+			if err := b.rebootIfUnreachable(ctx, cfg, vm.ID, vmIP, timeouts.VMReady); err != nil {
+				return err
+			}
+		}
+		var scratch *scratchVolume
+		if cfg.ScratchVolume != nil && resume != nil {
+			slog.Warn("Not attaching a scratch volume to a resumed VM")
+		} else if cfg.ScratchVolume != nil {
+			// A failed build removes the volume with the VM, unless the VM is kept
+			defer func() {
+				if scratch == nil {
+					return
+				}
+				if !vmTornDown && cfg.KeepVMOnFailure && !errors.Is(context.Cause(ctx), ErrBudgetExceeded) {
+					slog.Warn("Keeping the scratch volume with the VM", "volume_id", scratch.id)
+					return
+				}
+				if err := b.removeScratchVolume(context.WithoutCancel(ctx), cfg, scratch, ""); err != nil {
+					slog.Warn("Failed to remove scratch volume", "volume_id", scratch.id, "error", err)
+				}
+			}()
+			scratch, err = b.attachScratchVolume(ctx, cfg, vm, vmIP)
+			if err != nil {
+				return err
+			}
+		}
+
+		slog.Info("Executing provisioning scripts")
+		release := &imageRelease{
+			Name:      cfg.ImageName,
+			Version:   cfg.ImageVersion,
+			BuildID:   buildID,
+			BaseImage: cfg.BaseImageName,
+			BuiltAt:   time.Now(),
+		}
+		if err := b.provision(ctx, cfg, vmIP, scripts, collect, release, artifactsDir, phases); err != nil {
+			return fmt.Errorf("provisioning failed: %w", err)
+		}
+
+		if cfg.Compliance != nil && cfg.Compliance.Enabled {
+			phases.start("compliance")
+			complianceReport, err = b.complianceScan(ctx, cfg, vmIP, artifactsDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The scratch volume goes before the snapshot, so nothing written to it ends up in the image
+		if scratch != nil {
+			if err := b.removeScratchVolume(ctx, cfg, scratch, vmIP); err != nil {
+				return err
+			}
+			scratch = nil
+		}
+		notifyStep(notify.EventProvisioned, buildID, cfg, startedAt, 0)
+	} else {
+		slog.Info("Skipping provisioning, using the artifacts collected by the earlier attempt")
+	}
+
+	// A script test run ends here, leaving no snapshot or image behind
+	if cfg.SkipSnapshot {
+		phases.start("cleanup")
+		slog.Info("Skipping snapshot and image creation")
+		if err := TeardownVM(ctx, b.API, vm.ID); err != nil {
+			res.CleanupErr = err
+		}
+		vmTornDown = true
+		slog.Info("Provisioning completed successfully, no image was created", "artifacts_dir", artifactsDir.Path)
+		return nil
+	}
+
+	software := installedSoftware(artifactsDir)
+	lineage.RootfsDigest = rootfsDigest(artifactsDir)
+
+	snapshotName := fmt.Sprintf("%s-snapshot-%d", cfg.VMName, time.Now().Unix())
+	phases.start("snapshot")
+	if cfg.StopForSnapshot {
+		if err := stopVM(ctx, b.API, vm.ID); err != nil {
+			return err
+		}
+	}
+	slog.Info("Creating snapshot", "name", snapshotName)
+	snapshot, err := b.API.CreateSnapshot(ctx, vm.ID, snapshotName, []string{labels.Builder, labels.BuildID(buildID), labels.Expires(time.Now().Add(ttl))})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	slog.Info("Created snapshot", "name", snapshot.Name, "snapshot_id", snapshot.ID)
+	phases.updateState(func(s *buildstate.State) { s.SnapshotID = snapshot.ID })
+
+	slog.Info("Waiting for snapshot to be ready", "timeout", timeouts.Snapshot)
+	snapshotCtx, cancel := context.WithTimeout(client.WithExpectedDuration(ctx, typicalPhaseDuration(cfg, "snapshot")), timeouts.Snapshot)
+	err = b.API.WaitForSnapshotReady(snapshotCtx, snapshot.ID)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("snapshot failed to become ready: %w", err)
+	}
+
+	phases.start("image")
+	slog.Info("Creating image", "name", imageName)
+
+	// Create image labels combining config tags with k8s-specific labels
+	imageLabels := append([]string{}, cfg.Tags...) // Start with config tags
+
+	// Add k8s-specific labels
+	imageLabels = append(imageLabels,
+		"kubernetes.io/os=linux",
+		"kubernetes.io/arch=amd64",
+		"nvidia.com/gpu=true",
+		"nvidia.com/cuda=true",
+		"container.runtime=docker",
+		"image.type=kubernetes-node",
+		labels.Builder,
+		labels.BuildID(buildID),
+		labels.ImageFamilyPrefix+cfg.ImageName,
+		labels.Channel(labels.Channels[0]),
+	)
+	imageLabels = append(imageLabels, lineage.Labels()...)
+	imageLabels = append(imageLabels, softwareLabels(software)...)
+	imageLabels = append(imageLabels, buildMetadata(cfg, buildID, lineage.ContentHash, software).Labels()...)
+
+	if err := policy.Check(cfg.Naming, imageName, imageLabels); err != nil {
+		return err
+	}
+
+	image, err := b.API.CreateImageFromSnapshot(ctx, snapshot.ID, imageName, imageLabels)
+	if err != nil {
+		return fmt.Errorf("failed to create image: %w", err)
+	}
+
+	slog.Info("Created image", "name", image.Name, "image_id", image.ID)
+	phases.updateState(func(s *buildstate.State) { s.ImageID = image.ID })
+
+	slog.Info("Waiting for image to be ready", "timeout", timeouts.Image)
+	imageCtx, cancel := context.WithTimeout(client.WithExpectedDuration(ctx, typicalPhaseDuration(cfg, "image")), timeouts.Image)
+	err = b.API.WaitForImageReady(imageCtx, image.ID)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("image failed to become ready: %w", err)
+	}
+	notifyStep(notify.EventImageCreated, buildID, cfg, startedAt, image.ID)
+
+	phases.start("cleanup")
+	// The image is usable even if the VM outlives the build, so this only shows up in the result
+	if err := TeardownVM(ctx, b.API, vm.ID); err != nil {
+		res.CleanupErr = err
+	}
+	vmTornDown = true
+
+	var launchResults []manifest.CheckResult
+	var flavorResults []manifest.FlavorResult
+	var joinResult *manifest.JoinTestResult
+	// Write the report on every return so failed tests show up in CI too
+	defer func() {
+		writeJUnit(artifactsDir, imageName, launchResults, flavorResults, joinResult)
+	}()
+	if cfg.LaunchTest != nil && cfg.LaunchTest.Enabled {
+		phases.start("launch-test")
+		launchResults, flavorResults, err = b.launchTest(ctx, cfg, image, buildID, artifactsDir)
+		if err != nil {
+			discardImage(context.WithoutCancel(ctx), b.API, image, snapshot)
+			return fmt.Errorf("launch test failed, image deleted: %w", err)
+		}
+	}
+
+	if cfg.JoinTest != nil && cfg.JoinTest.Enabled {
+		phases.start("join-test")
+		joinResult, err = b.joinTest(ctx, cfg, image, buildID, artifactsDir)
+		if err != nil {
+			discardImage(context.WithoutCancel(ctx), b.API, image, snapshot)
+			return fmt.Errorf("join test failed, image deleted: %w", err)
+		}
+	}
+
+	phases.start("finalize")
+	m := &manifest.Manifest{
+		BuildID:       buildID,
+		ImageID:       image.ID,
+		ImageName:     image.Name,
+		ImageVersion:  cfg.ImageVersion,
+		Region:        cfg.Region,
+		BaseImageName: cfg.BaseImageName,
+		FlavorName:    cfg.FlavorName,
+		VMID:          vm.ID,
+		SnapshotID:    snapshot.ID,
+		Labels:        imageLabels,
+		Scripts:       scripts,
+		StartedAt:     startedAt.UTC(),
+		FinishedAt:    time.Now().UTC(),
+		LaunchTest:    launchResults,
+		Flavors:       flavorResults,
+		JoinTest:      joinResult,
+		Software:      software,
+		Compliance:    complianceReport,
+		Lineage:       lineage,
+		Changelog:     writeChangelog(cfg, scripts, artifactsDir),
+		// Everything up to finalize, which is still running
+		Phases: append([]manifest.Phase{}, phases.completed...),
+		Steps:  phases.steps,
+	}
+	manifestPath := artifactsDir.File("manifest.json")
+	if err := manifest.Write(m, manifestPath); err != nil {
+		slog.Warn("Failed to write manifest", "error", err)
+	} else {
+		slog.Info("Wrote manifest", "path", manifestPath)
+	}
+
+	if cfg.HCPPacker != nil && cfg.HCPPacker.Enabled {
+		writeHCPPackerMetadata(cfg, m, artifactsDir)
+	}
+
+	if cfg.Signing != nil && cfg.Signing.Enabled {
+		if err := signArtifacts(cfg.Signing, artifactsDir, manifestPath); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Image creation completed successfully", "image_id", image.ID, "image_name", image.Name)
+	res.Image = image
+	res.Manifest = m
+	return nil
+}
@@ -0,0 +1,111 @@
+package builder_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder/buildertest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+var scripts = []string{buildertest.Script}
+
+func TestBuildLabelsImage(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{})
+
+	res, err := b.Build(context.Background(), cfg, scripts)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	image, err := api.GetImage(context.Background(), res.Image.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imageLabels []string
+	for _, l := range image.Labels {
+		imageLabels = append(imageLabels, l.Label)
+	}
+	for _, want := range []string{labels.Builder, labels.BuildID(res.BuildID), labels.ImageFamilyPrefix + cfg.ImageName, labels.Channel("dev")} {
+		if !slices.Contains(imageLabels, want) {
+			t.Errorf("image labels %v are missing %s", imageLabels, want)
+		}
+	}
+	if !api.Called("DeleteVM 1") {
+		t.Errorf("build VM was not deleted, calls: %v", api.Calls())
+	}
+}
+
+func TestProvisioningFailureTearsDownVM(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{FailScript: buildertest.Script})
+
+	res, err := b.Build(context.Background(), cfg, scripts)
+	var phaseErr *builder.PhaseError
+	if !errors.As(err, &phaseErr) || phaseErr.Phase != "provision" {
+		t.Fatalf("Build() error = %v, want a provision phase error", err)
+	}
+	if !api.Called("DeleteVM 1") {
+		t.Errorf("build VM was not deleted, calls: %v", api.Calls())
+	}
+	if res.KeptVM != nil {
+		t.Errorf("KeptVM = %+v, want nil", res.KeptVM)
+	}
+}
+
+func TestKeepVMOnFailure(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{FailScript: buildertest.Script})
+	cfg.KeepVMOnFailure = true
+
+	res, err := b.Build(context.Background(), cfg, scripts)
+	if err == nil {
+		t.Fatal("Build() succeeded, want a provisioning failure")
+	}
+	if api.Called("DeleteVM 1") {
+		t.Errorf("build VM was deleted despite keep_vm_on_failure, calls: %v", api.Calls())
+	}
+	if res.KeptVM == nil || res.KeptVM.ID != 1 || res.KeptVM.IP != "192.0.2.1" {
+		t.Errorf("KeptVM = %+v, want VM 1 at 192.0.2.1", res.KeptVM)
+	}
+}
+
+func TestBudgetExceededDeletesKeptVM(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{Hang: true})
+	cfg.KeepVMOnFailure = true
+	// A budget of 100ms
+	cfg.HourlyCost = 36
+	cfg.MaxBuildCost = 0.001
+
+	res, err := b.Build(context.Background(), cfg, scripts)
+	if !errors.Is(err, builder.ErrBudgetExceeded) {
+		t.Fatalf("Build() error = %v, want ErrBudgetExceeded", err)
+	}
+	if !api.Called("DeleteVM 1") {
+		t.Errorf("build VM over budget was not deleted, calls: %v", api.Calls())
+	}
+	if res.KeptVM != nil {
+		t.Errorf("KeptVM = %+v, want nil", res.KeptVM)
+	}
+}
+
+func TestLaunchTestFailureDeletesImageAndSnapshot(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{FailCommand: "nvidia-smi"})
+	cfg.LaunchTest = &types.LaunchTestConfig{Enabled: true, Commands: []string{"nvidia-smi"}}
+
+	res, err := b.Build(context.Background(), cfg, scripts)
+	var phaseErr *builder.PhaseError
+	if !errors.As(err, &phaseErr) || phaseErr.Phase != "launch-test" {
+		t.Fatalf("Build() error = %v, want a launch-test phase error", err)
+	}
+	if res.Image != nil {
+		t.Errorf("Image = %+v, want nil", res.Image)
+	}
+	// The build VM is 1, then come its snapshot, its image and the test VM
+	for _, call := range []string{"DeleteVM 1", "DeleteSnapshot 2", "DeleteImage 3", "DeleteVM 4"} {
+		if !api.Called(call) {
+			t.Errorf("missing call %s, calls: %v", call, api.Calls())
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package buildertest provides in-memory fakes of the Hyperstack API and VM shell a Builder runs against,
+// so builds and the commands that manage their images can be tested without a cloud account
+package buildertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+var (
+	_ builder.API   = (*API)(nil)
+	_ builder.Shell = (*Shell)(nil)
+)
+
+// errNotImplemented is returned by the calls no test needs yet
+var errNotImplemented = errors.New("not implemented by buildertest")
+
+// API is an in-memory Hyperstack account holding the base image, flavor, keypair and environment of a
+// config. It records every call that changes something, e.g. "DeleteVM 1"; VMs, snapshots and images
+// share one sequence of IDs starting at 1.
+type API struct {
+	cfg *types.Config
+
+	mu     sync.Mutex
+	nextID int
+	vms    map[int]*types.VMInstance
+	images map[int]*types.Image
+	calls  []string
+}
+
+// NewAPI returns an account with the resources cfg builds from
+func NewAPI(cfg *types.Config) *API {
+	return &API{cfg: cfg, vms: make(map[int]*types.VMInstance), images: make(map[int]*types.Image)}
+}
+
+// AddImage adds an image to the account, such as one built before the test
+func (f *API) AddImage(image types.Image) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[image.ID] = &image
+}
+
+// Called reports whether the API was called as in "DeleteVM 1"
+func (f *API) Called(call string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Contains(f.calls, call)
+}
+
+// Calls returns the recorded calls in order
+func (f *API) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+func (f *API) record(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *API) newID() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	return f.nextID
+}
+
+func imageLabels(labels []string) []types.ImageLabel {
+	result := make([]types.ImageLabel, len(labels))
+	for i, l := range labels {
+		result[i] = types.ImageLabel{Label: l}
+	}
+	return result
+}
+
+func (f *API) CreateVM(ctx context.Context, config types.Config) (*types.VMCreateResponse, error) {
+	vm := types.VMInstance{
+		ID:         f.newID(),
+		Name:       config.VMName,
+		Status:     "ACTIVE",
+		FixedIP:    "10.0.0.1",
+		FloatingIP: "192.0.2.1",
+		Labels:     config.Tags,
+	}
+	f.mu.Lock()
+	f.vms[vm.ID] = &vm
+	f.mu.Unlock()
+	f.record("CreateVM %d", vm.ID)
+	return &types.VMCreateResponse{Instances: []types.VMInstance{vm}}, nil
+}
+
+func (f *API) GetVMDetails(ctx context.Context, vmID int) (*types.VMInstance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vm, ok := f.vms[vmID]
+	if !ok {
+		return nil, client.ErrNotFound
+	}
+	details := *vm
+	return &details, nil
+}
+
+func (f *API) WaitForVMReady(ctx context.Context, vmID int) (string, error) {
+	vm, err := f.GetVMDetails(ctx, vmID)
+	if err != nil {
+		return "", err
+	}
+	return vm.FloatingIP, nil
+}
+
+func (f *API) ListVMs(ctx context.Context) ([]types.VMInstance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var vms []types.VMInstance
+	for _, vm := range f.vms {
+		vms = append(vms, *vm)
+	}
+	return vms, nil
+}
+
+func (f *API) DetachFloatingIP(ctx context.Context, vmID int) error {
+	f.record("DetachFloatingIP %d", vmID)
+	return nil
+}
+
+func (f *API) DeleteVM(ctx context.Context, vmID int) error {
+	f.mu.Lock()
+	delete(f.vms, vmID)
+	f.mu.Unlock()
+	f.record("DeleteVM %d", vmID)
+	return nil
+}
+
+func (f *API) WaitForVMStatus(ctx context.Context, vmID int, status string) error { return nil }
+
+func (f *API) StopVM(ctx context.Context, vmID int) error {
+	f.record("StopVM %d", vmID)
+	return nil
+}
+
+func (f *API) HardRebootVM(ctx context.Context, vmID int) error {
+	f.record("HardRebootVM %d", vmID)
+	return nil
+}
+
+func (f *API) ShelveVM(ctx context.Context, vmID int) error {
+	f.record("ShelveVM %d", vmID)
+	return nil
+}
+
+func (f *API) CreateSnapshot(ctx context.Context, vmID int, name string, labels []string) (*types.Snapshot, error) {
+	snapshot := &types.Snapshot{ID: f.newID(), Name: name, VMID: vmID}
+	f.record("CreateSnapshot %d", snapshot.ID)
+	return snapshot, nil
+}
+
+func (f *API) WaitForSnapshotReady(ctx context.Context, snapshotID int) error { return nil }
+
+func (f *API) ListSnapshots(ctx context.Context) ([]types.Snapshot, error) { return nil, nil }
+
+func (f *API) DeleteSnapshot(ctx context.Context, snapshotID int) error {
+	f.record("DeleteSnapshot %d", snapshotID)
+	return nil
+}
+
+func (f *API) CreateImageFromSnapshot(ctx context.Context, snapshotID int, name string, labels []string) (*types.Image, error) {
+	image := types.Image{
+		ID:         f.newID(),
+		Name:       name,
+		RegionName: f.cfg.Region,
+		Labels:     imageLabels(labels),
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	f.AddImage(image)
+	f.record("CreateImageFromSnapshot %d", image.ID)
+	return &image, nil
+}
+
+func (f *API) WaitForImageReady(ctx context.Context, imageID int) error { return nil }
+
+func (f *API) GetImage(ctx context.Context, imageID int) (*types.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	image, ok := f.images[imageID]
+	if !ok {
+		return nil, fmt.Errorf("image %d %w", imageID, client.ErrNotFound)
+	}
+	found := *image
+	return &found, nil
+}
+
+// ListImages lists the base image of the config followed by the other images in ID order
+func (f *API) ListImages(ctx context.Context) ([]types.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	images := []types.Image{{ID: 1000000, Name: f.cfg.BaseImageName, RegionName: f.cfg.Region, IsPublic: true}}
+	var ids []int
+	for id := range f.images {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		images = append(images, *f.images[id])
+	}
+	return images, nil
+}
+
+func (f *API) UpdateImage(ctx context.Context, imageID int, imageName string, labels []string) (*types.Image, error) {
+	f.mu.Lock()
+	image, ok := f.images[imageID]
+	if ok {
+		if imageName != "" {
+			image.Name = imageName
+		}
+		image.Labels = imageLabels(labels)
+	}
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("image %d %w", imageID, client.ErrNotFound)
+	}
+	f.record("UpdateImage %d", imageID)
+	return f.GetImage(ctx, imageID)
+}
+
+func (f *API) DeleteImage(ctx context.Context, imageID int) error {
+	f.mu.Lock()
+	delete(f.images, imageID)
+	f.mu.Unlock()
+	f.record("DeleteImage %d", imageID)
+	return nil
+}
+
+func (f *API) ListRegions(ctx context.Context) ([]types.Region, error) { return nil, nil }
+
+func (f *API) ListFlavors(ctx context.Context) ([]types.Flavor, error) {
+	return []types.Flavor{{Name: f.cfg.FlavorName, RegionName: f.cfg.Region}}, nil
+}
+
+func (f *API) ListStocks(ctx context.Context) ([]types.Stock, error) { return nil, nil }
+
+func (f *API) ListQuotas(ctx context.Context) ([]types.Quota, error) { return nil, nil }
+
+func (f *API) ListKeypairs(ctx context.Context) ([]types.Keypair, error) {
+	return []types.Keypair{{Name: f.cfg.KeypairName, Environment: types.Environment{Name: f.cfg.EnvironmentName}}}, nil
+}
+
+func (f *API) ImportKeypair(ctx context.Context, name, environmentName, publicKey string) (*types.Keypair, error) {
+	return nil, errNotImplemented
+}
+
+func (f *API) ListEnvironments(ctx context.Context) ([]types.Environment, error) {
+	return []types.Environment{{Name: f.cfg.EnvironmentName, Region: f.cfg.Region}}, nil
+}
+
+func (f *API) CreateVolume(ctx context.Context, name, environmentName string, sizeGB int, volumeType string) (*types.Volume, error) {
+	return nil, errNotImplemented
+}
+
+func (f *API) WaitForVolumeStatus(ctx context.Context, volumeID int, status string) error {
+	return errNotImplemented
+}
+
+func (f *API) AttachVolume(ctx context.Context, vmID, volumeID int) error { return errNotImplemented }
+
+func (f *API) DetachVolume(ctx context.Context, vmID, volumeID int) error { return errNotImplemented }
+
+func (f *API) DeleteVolume(ctx context.Context, volumeID int) error { return errNotImplemented }
+
+func (f *API) CreateEnvironment(ctx context.Context, name, region string) (*types.Environment, error) {
+	return nil, errNotImplemented
+}
+
+// Shell runs nothing; every command succeeds unless it is told otherwise
+type Shell struct {
+	FailScript  string // ExecuteScript of this script fails
+	FailCommand string // ExecuteCommand of this command fails
+	Hang        bool   // ExecuteScript blocks until the shell is closed
+
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+// Dialer returns a Dialer handing out a new shell that behaves like s on every connection
+func (s Shell) Dialer() builder.Dialer {
+	return func(privateKeyPath, username string) (builder.Shell, error) {
+		shell := s
+		shell.closed = make(chan struct{})
+		shell.closeOnce = &sync.Once{}
+		return &shell, nil
+	}
+}
+
+func (s *Shell) Connect(ctx context.Context, host string) error { return nil }
+
+func (s *Shell) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *Shell) SetOutput(w io.Writer)        {}
+func (s *Shell) SetStep(step string)          {}
+func (s *Shell) SetEnv(env map[string]string) {}
+
+func (s *Shell) CopyFile(localPath, remotePath string) error { return nil }
+
+func (s *Shell) ExecuteCommand(command string) error {
+	if command == s.FailCommand {
+		return fmt.Errorf("command %q exited with status 1", command)
+	}
+	return nil
+}
+
+func (s *Shell) ExecuteScript(scriptPath string) error {
+	if s.Hang {
+		<-s.closed
+		return errors.New("connection closed")
+	}
+	if filepath.Base(scriptPath) == s.FailScript {
+		return fmt.Errorf("script %s exited with status 1", scriptPath)
+	}
+	return nil
+}
+
+func (s *Shell) CommandOutput(command string) ([]byte, error) { return nil, nil }
+
+func (s *Shell) StreamOutput(command string, w io.Writer) error { return nil }
+
+// Script is the provisioning script New writes to the builder's script directory
+const Script = "install.sh"
+
+// New returns a config, with its artifacts, history, build state and locks in temporary directories, and
+// a builder running the script Script against a new API and shell
+func New(t testing.TB, shell Shell) (*types.Config, *API, *builder.Builder) {
+	t.Helper()
+	t.Setenv("HYPERSTACK_BUILDER_HISTORY", filepath.Join(t.TempDir(), "history.jsonl"))
+	t.Setenv("HYPERSTACK_BUILDER_HISTORY_URL", "")
+	t.Setenv("HYPERSTACK_BUILDER_STATE_DIR", t.TempDir())
+	t.Setenv("SENTRY_DSN", "")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	scriptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scriptDir, Script), []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &types.Config{
+		Region:          "CANADA-1",
+		ImageName:       "kube-node",
+		ImageVersion:    "v1.0.0",
+		BaseImageName:   "Ubuntu Server 22.04 LTS",
+		VMName:          "kube-node-builder",
+		FlavorName:      "n3-RTX-A6000x1",
+		KeypairName:     "builder",
+		PrivateKeyPath:  "/dev/null",
+		EnvironmentName: "default-CANADA-1",
+		Artifacts:       &types.ArtifactsConfig{Dir: t.TempDir()},
+	}
+	api := NewAPI(cfg)
+	b := builder.New(builder.Options{API: api, Dial: shell.Dialer(), ScriptDir: scriptDir, FilesDir: t.TempDir()})
+	return cfg, api, b
+}
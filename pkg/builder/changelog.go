@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/changelog"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/imagediff"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// writeChangelog compares the build against the previous successful build of the same image name in history
+// and writes changelog.md and changelog.json to the artifacts directory. It returns nil for a first build.
+func writeChangelog(cfg *types.Config, scripts []string, artifactsDir *artifacts.Dir) *changelog.Changelog {
+	records, err := history.Default().List()
+	if err != nil {
+		slog.Warn("Failed to read build history for changelog", "error", err)
+		return nil
+	}
+	prev := changelog.Previous(records, cfg.ImageName)
+	if prev == nil {
+		slog.Info("No previous build in history, skipping changelog", "image_name", cfg.ImageName)
+		return nil
+	}
+
+	var from, to *imagediff.Inventory
+	if prev.Artifacts != "" {
+		if from, err = imagediff.Load(prev.Artifacts); err != nil {
+			slog.Warn("Failed to load packages of previous build", "previous_build_id", prev.ID, "error", err)
+		} else {
+			from.Source = prev.ImageName
+		}
+	}
+	if to, err = imagediff.Load(artifactsDir.Path); err != nil {
+		slog.Warn("Failed to load packages of this build", "error", err)
+	} else {
+		to.Source = cfg.ImageName + "_" + cfg.ImageVersion
+	}
+
+	cl, err := changelog.New(prev, cfg, scripts, from, to)
+	if err != nil {
+		slog.Warn("Failed to compute changelog", "error", err)
+		return nil
+	}
+
+	if err := manifest.WriteJSON(cl, artifactsDir.File("changelog.json")); err != nil {
+		slog.Warn("Failed to write changelog", "error", err)
+	}
+	f, err := os.Create(artifactsDir.File("changelog.md"))
+	if err != nil {
+		slog.Warn("Failed to write changelog", "error", err)
+		return cl
+	}
+	defer f.Close()
+	cl.WriteMarkdown(f)
+
+	slog.Info("Wrote changelog", "since_version", prev.Config.ImageVersion, "path", f.Name())
+	return cl
+}
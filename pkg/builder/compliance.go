@@ -0,0 +1,118 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/compliance"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// lynisCommand runs a lynis audit, installing lynis for the run only if the image doesn't already have it
+const lynisCommand = `sudo sh -c 'installed=; command -v lynis >/dev/null || { DEBIAN_FRONTEND=noninteractive apt-get install -y -qq lynis >/dev/null && installed=1; }; ` +
+	`lynis audit system --quick --no-colors --report-file /tmp/lynis-report.dat --logfile /tmp/lynis.log >/dev/null; status=$?; ` +
+	`[ -n "$installed" ] && DEBIAN_FRONTEND=noninteractive apt-get purge -y -qq lynis >/dev/null; exit $status'`
+
+// runCompliance runs the configured benchmark on the build VM, downloads its raw results into the
+// collected artifacts and returns the scored report
+func runCompliance(sshClient Shell, cc *types.ComplianceConfig, artifactsDir *artifacts.Dir) (*compliance.Report, error) {
+	var command, resultsPath string
+	var downloads []string
+	switch cc.Tool {
+	case "", compliance.ToolLynis:
+		command = lynisCommand
+		resultsPath = "/tmp/lynis-report.dat"
+		downloads = []string{resultsPath, "/tmp/lynis.log"}
+	case compliance.ToolOSCAP:
+		if cc.Profile == "" || cc.Datastream == "" {
+			return nil, fmt.Errorf("compliance with oscap requires profile and datastream")
+		}
+		resultsPath = "/tmp/oscap-results.xml"
+		// Exit status 2 means some rules failed, which the report records rather than treating as an error
+		command = fmt.Sprintf("sudo oscap xccdf eval --profile %s --results %s --report /tmp/oscap-report.html %s; rc=$?; [ $rc -eq 0 ] || [ $rc -eq 2 ]",
+			cc.Profile, resultsPath, cc.Datastream)
+		downloads = []string{resultsPath, "/tmp/oscap-report.html"}
+	default:
+		return nil, fmt.Errorf("unknown compliance tool %q, expected lynis or oscap", cc.Tool)
+	}
+
+	report, err := artifactsDir.StepLog("compliance")
+	if err != nil {
+		return nil, err
+	}
+	defer report.Close()
+	sshClient.SetOutput(report)
+	sshClient.SetStep("compliance")
+	defer sshClient.SetOutput(nil)
+	defer sshClient.SetStep("")
+
+	slog.Info("Running compliance benchmark", "tool", orDefault(cc.Tool, compliance.ToolLynis))
+	if err := sshClient.ExecuteCommand(command); err != nil {
+		return nil, fmt.Errorf("compliance benchmark failed: %w", err)
+	}
+
+	var results []byte
+	for _, path := range downloads {
+		data, err := sshClient.CommandOutput("sudo cat " + path)
+		if err != nil {
+			slog.Warn("Failed to download compliance results", "path", path, "error", err)
+			continue
+		}
+		if err := artifactsDir.WriteCollected("compliance-"+filepath.Base(path), data); err != nil {
+			slog.Warn("Failed to save compliance results", "path", path, "error", err)
+		}
+		if path == resultsPath {
+			results = data
+		}
+	}
+	if err := sshClient.ExecuteCommand("sudo rm -f " + strings.Join(downloads, " ")); err != nil {
+		slog.Warn("Failed to remove compliance results from the VM", "error", err)
+	}
+	if results == nil {
+		return nil, fmt.Errorf("failed to download compliance results")
+	}
+
+	var scored *compliance.Report
+	if cc.Tool == compliance.ToolOSCAP {
+		scored, err = compliance.ParseOSCAP(results)
+	} else {
+		scored, err = compliance.ParseLynis(results)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := manifest.WriteJSON(scored, artifactsDir.File("compliance.json")); err != nil {
+		slog.Warn("Failed to write compliance report", "error", err)
+	}
+	slog.Info("Compliance benchmark scored", "score_percent", fmt.Sprintf("%.1f", scored.Percent()), "passed", scored.Passed, "failed", scored.Failed)
+
+	if cc.MinScore > 0 && scored.Percent() < cc.MinScore {
+		return scored, fmt.Errorf("compliance score %.1f%% is below the minimum of %.1f%%", scored.Percent(), cc.MinScore)
+	}
+	return scored, nil
+}
+
+// complianceScan connects to the build VM and runs the compliance benchmark
+func (b *Builder) complianceScan(ctx context.Context, cfg *types.Config, vmIP string, artifactsDir *artifacts.Dir) (*compliance.Report, error) {
+	sshClient, err := b.dialVM(ctx, cfg, vmIP)
+	if err != nil {
+		return nil, err
+	}
+	defer sshClient.Close()
+	defer context.AfterFunc(ctx, func() { sshClient.Close() })()
+
+	return runCompliance(sshClient, cfg.Compliance, artifactsDir)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
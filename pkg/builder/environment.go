@@ -0,0 +1,44 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// environmentName is the environment a build runs in: environment_name, or with ensure_environment
+// default-<REGION> when it is left out
+func environmentName(cfg *types.Config) string {
+	if cfg.EnvironmentName == "" && cfg.EnsureEnvironment {
+		return fmt.Sprintf("default-%s", cfg.Region)
+	}
+	return cfg.EnvironmentName
+}
+
+// ensureEnvironment creates the environment of a config with ensure_environment when the account doesn't
+// have it, so a build in a new region or account doesn't need it set up in the console first
+func ensureEnvironment(ctx context.Context, api API, cfg *types.Config) error {
+	if !cfg.EnsureEnvironment {
+		return nil
+	}
+	cfg.EnvironmentName = environmentName(cfg)
+	environments, err := api.ListEnvironments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	for _, env := range environments {
+		// One in another region is left for the preflight check to report
+		if env.Name == cfg.EnvironmentName {
+			return nil
+		}
+	}
+
+	env, err := api.CreateEnvironment(ctx, cfg.EnvironmentName, cfg.Region)
+	if err != nil {
+		return err
+	}
+	slog.Info("Created environment", "environment", env.Name, "id", env.ID, "region", cfg.Region)
+	return nil
+}
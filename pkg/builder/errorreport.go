@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/hints"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/sentry"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// reportFailure sends a failed build to Sentry when SENTRY_DSN is set. Only the error class, the
+// sanitized error, phase timings and non-secret config fields are sent.
+func reportFailure(buildID string, cfg *types.Config, startedAt time.Time, phases *phaseTimer, buildErr error) {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" || buildErr == nil {
+		return
+	}
+
+	reporter, err := sentry.New(dsn)
+	if err != nil {
+		slog.Warn("Failed to set up error reporting", "error", err)
+		return
+	}
+	reporter.Release = builderVersion()
+	reporter.Environment = os.Getenv("SENTRY_ENVIRONMENT")
+
+	class := "unclassified"
+	if hint := hints.Classify(buildErr); hint != nil {
+		class = hint.Class
+	}
+
+	// Failures before the VM is created, such as policy or lock checks, happen outside any phase
+	failedPhase := "setup"
+	phaseDurations := make(map[string]float64)
+	for _, phase := range phases.completed {
+		phaseDurations[phase.Name] += phase.Duration.Seconds()
+		if phase.Status == manifest.PhaseFailed {
+			failedPhase = phase.Name
+		}
+	}
+
+	failure := sentry.Failure{
+		Class:   class,
+		Message: buildErr.Error(),
+		Tags: map[string]string{
+			"phase":       failedPhase,
+			"error_class": class,
+			"image_name":  cfg.ImageName,
+			"region":      cfg.Region,
+			"flavor":      cfg.FlavorName,
+		},
+		Extra: map[string]any{
+			"build_id":                buildID,
+			"duration_seconds":        time.Since(startedAt).Seconds(),
+			"phase_durations_seconds": phaseDurations,
+		},
+	}
+	if err := reporter.Capture(failure); err != nil {
+		slog.Warn("Failed to report build failure", "error", err)
+		return
+	}
+	slog.Info("Reported build failure to Sentry", "error_class", class)
+}
@@ -0,0 +1,24 @@
+package builder
+
+import "errors"
+
+// ErrBuildInProgress is returned when another build holds the lock or API claim on the image name and region
+var ErrBuildInProgress = errors.New("another build is in progress")
+
+// ErrVMUnreachable is returned when no SSH connection to a VM could be established in time
+var ErrVMUnreachable = errors.New("VM is unreachable over SSH")
+
+// ErrBudgetExceeded is the cause of a build aborted for running past max_build_minutes or max_build_cost
+var ErrBudgetExceeded = errors.New("build budget exceeded")
+
+// ErrPreflight is returned when a resource the build VM is created from does not exist where the config says
+var ErrPreflight = errors.New("preflight check failed")
+
+// PhaseError is a build failure annotated with the phase it happened in, "" if before the first phase
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string { return e.Err.Error() }
+func (e *PhaseError) Unwrap() error { return e.Err }
@@ -0,0 +1,58 @@
+package builder
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// recordBuild appends the outcome of a build, who ran it and what went into it to the history store
+func (b *Builder) recordBuild(buildID string, cfg *types.Config, scripts []string, startedAt time.Time, phases *phaseTimer, image *types.Image, buildErr error) {
+	finishedAt := time.Now()
+	rec := history.Record{
+		ID:         buildID,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+		Duration:   finishedAt.Sub(startedAt),
+		Status:     history.StatusSucceeded,
+		ConfigHash: history.ConfigHash(cfg),
+		Config:     history.Redact(cfg),
+		Scripts:    scripts,
+		Cost:       history.EstimateCost(cfg.HourlyCost, finishedAt.Sub(startedAt)),
+		Phases:     phases.durations(),
+		Steps:      phases.stepDurations(),
+
+		User:           history.CurrentUser(),
+		BuilderVersion: builderVersion(),
+		ScriptHashes:   history.HashFiles(b.ScriptDir, scripts),
+	}
+	rec.Host, _ = os.Hostname()
+	rec.SourceCommit, _ = sourceCommit(b.ScriptDir)
+	if buildErr != nil {
+		rec.Status = history.StatusFailed
+		rec.Error = buildErr.Error()
+	}
+	if image != nil {
+		rec.ImageID = image.ID
+		rec.ImageName = image.Name
+	}
+	rec.Artifacts = artifacts.PathFor(ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+
+	store := history.Default()
+	err := store.Append(rec)
+	if err != nil && store.URL != "" {
+		// Keep the record locally rather than lose it
+		slog.Warn("Failed to record build in the remote history, recording it locally", "error", err)
+		store = history.Open(store.Path)
+		err = store.Append(rec)
+	}
+	if err != nil {
+		slog.Warn("Failed to record build history", "error", err)
+		return
+	}
+	slog.Info("Recorded build history", "path", store.Location())
+}
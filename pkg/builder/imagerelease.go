@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// imageReleasePath is where nodes booted from the image can read which golden image they run
+const imageReleasePath = "/etc/image-release"
+
+// imageRelease identifies the image being built, for the generated /etc/image-release file
+type imageRelease struct {
+	Name      string
+	Version   string
+	BuildID   string
+	BaseImage string
+	BuiltAt   time.Time
+}
+
+// render formats the release as os-release style KEY="value" lines, leaving out unknown versions
+func (r *imageRelease) render(sw *manifest.Software) []byte {
+	var buf bytes.Buffer
+	for _, field := range []struct{ key, value string }{
+		{"IMAGE_NAME", r.Name},
+		{"IMAGE_VERSION", r.Version},
+		{"IMAGE_BUILD_ID", r.BuildID},
+		{"IMAGE_BUILD_DATE", r.BuiltAt.UTC().Format(time.RFC3339)},
+		{"IMAGE_BASE", r.BaseImage},
+		{"NVIDIA_DRIVER_VERSION", sw.NvidiaDriver},
+		{"CUDA_VERSION", sw.CUDA},
+		{"CONTAINERD_VERSION", sw.Containerd},
+		{"KUBERNETES_VERSION", sw.Kubernetes},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&buf, "%s=%s\n", field.key, strconv.Quote(field.value))
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeImageRelease installs the generated release file on the VM and keeps a copy in the artifacts directory
+func writeImageRelease(sshClient Shell, release *imageRelease, artifactsDir *artifacts.Dir) error {
+	localPath := artifactsDir.File("image-release")
+	if err := os.WriteFile(localPath, release.render(installedSoftware(artifactsDir)), 0644); err != nil {
+		return fmt.Errorf("failed to write image release file: %w", err)
+	}
+
+	tempPath := "/tmp/image-release"
+	if err := sshClient.CopyFile(localPath, tempPath); err != nil {
+		return fmt.Errorf("failed to copy image release file: %w", err)
+	}
+	if err := sshClient.ExecuteCommand(fmt.Sprintf("sudo install -m 0644 -o root -g root %s %s && rm -f %s", tempPath, imageReleasePath, tempPath)); err != nil {
+		return fmt.Errorf("failed to install %s: %w", imageReleasePath, err)
+	}
+
+	slog.Info("Wrote image release file", "path", imageReleasePath)
+	return nil
+}
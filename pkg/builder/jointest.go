@@ -0,0 +1,170 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+const defaultJoinReadyTimeout = 10 * time.Minute
+
+// joinConfigTemplate is the kubeadm JoinConfiguration used so the token never appears in logged commands
+const joinConfigTemplate = `apiVersion: kubeadm.k8s.io/v1beta3
+kind: JoinConfiguration
+discovery:
+  bootstrapToken:
+    apiServerEndpoint: %q
+    token: %q
+    caCertHashes:
+      - %q
+`
+
+// nodeStatus is the subset of a kubectl node object the join test inspects
+type nodeStatus struct {
+	Status struct {
+		Allocatable map[string]string `json:"allocatable"`
+		Conditions  []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// kubectl runs kubectl against the test control plane and returns its stdout
+func kubectl(kubeconfig string, args ...string) ([]byte, error) {
+	cmd := exec.Command("kubectl", append([]string{"--kubeconfig", kubeconfig}, args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+// waitForNode polls the control plane until the node is Ready and advertises GPUs
+func waitForNode(kubeconfig, node string, timeout time.Duration) (bool, string, error) {
+	deadline := time.Now().Add(timeout)
+	ready, gpus := false, ""
+
+	for time.Now().Before(deadline) {
+		output, err := kubectl(kubeconfig, "get", "node", node, "-o", "json")
+		if err == nil {
+			var status nodeStatus
+			if err := json.Unmarshal(output, &status); err != nil {
+				return false, "", fmt.Errorf("failed to parse node status: %w", err)
+			}
+
+			ready = false
+			for _, cond := range status.Status.Conditions {
+				if cond.Type == "Ready" && cond.Status == "True" {
+					ready = true
+				}
+			}
+			gpus = status.Status.Allocatable["nvidia.com/gpu"]
+
+			if ready && gpus != "" && gpus != "0" {
+				return ready, gpus, nil
+			}
+		}
+
+		slog.Info("Join test: waiting for node", "node", node, "ready", ready, "gpus", gpus)
+		time.Sleep(10 * time.Second)
+	}
+
+	return ready, gpus, fmt.Errorf("node %s did not become Ready with nvidia.com/gpu resources within %s", node, timeout)
+}
+
+// joinTest boots a VM from the built image, joins it to the test control plane and verifies it becomes a GPU node
+func (b *Builder) joinTest(ctx context.Context, cfg *types.Config, image *types.Image, buildID string, artifactsDir *artifacts.Dir) (*manifest.JoinTestResult, error) {
+	jt := cfg.JoinTest
+	started := time.Now()
+	result := &manifest.JoinTestResult{}
+
+	fail := func(err error) (*manifest.JoinTestResult, error) {
+		result.Error = err.Error()
+		result.Duration = time.Since(started)
+		if writeErr := manifest.WriteJSON(result, artifactsDir.File("join-test.json")); writeErr != nil {
+			slog.Warn("Failed to write join test results", "error", writeErr)
+		}
+		return result, err
+	}
+
+	// The token is only ever read from the environment, so it isn't saved with the config or its history
+	tokenEnv := jt.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = "KUBEADM_JOIN_TOKEN"
+	}
+	token := os.Getenv(tokenEnv)
+	if jt.APIServerEndpoint == "" || token == "" || jt.CACertHash == "" || jt.Kubeconfig == "" {
+		return fail(fmt.Errorf("join_test requires api_server_endpoint, a token in %s, ca_cert_hash and kubeconfig", tokenEnv))
+	}
+	readyTimeout := defaultJoinReadyTimeout
+	if jt.ReadyTimeout != "" {
+		d, err := time.ParseDuration(jt.ReadyTimeout)
+		if err != nil {
+			return fail(fmt.Errorf("invalid join_test.ready_timeout %q: %w", jt.ReadyTimeout, err))
+		}
+		readyTimeout = d
+	}
+
+	vm, cleanup, err := b.BootTestVM(ctx, cfg, image, buildID, jt.FlavorName, "jointest")
+	defer cleanup()
+	if err != nil {
+		return fail(err)
+	}
+
+	report, err := artifactsDir.StepLog("join-test")
+	if err != nil {
+		return fail(err)
+	}
+	defer report.Close()
+	vm.SSH.SetOutput(report)
+	vm.SSH.SetStep("join-test")
+
+	hostname, err := vm.SSH.CommandOutput("hostname")
+	if err != nil {
+		return fail(fmt.Errorf("failed to read hostname: %w", err))
+	}
+	result.Node = strings.ToLower(strings.TrimSpace(string(hostname)))
+
+	// Ship the join configuration as a file so the bootstrap token stays out of the logs
+	joinConfig, err := os.CreateTemp("", "kubeadm-join-*.yaml")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.Remove(joinConfig.Name())
+	fmt.Fprintf(joinConfig, joinConfigTemplate, jt.APIServerEndpoint, token, jt.CACertHash)
+	joinConfig.Close()
+
+	if err := vm.SSH.CopyFile(joinConfig.Name(), "/tmp/kubeadm-join.yaml"); err != nil {
+		return fail(fmt.Errorf("failed to copy join configuration: %w", err))
+	}
+
+	slog.Info("Join test: joining node", "node", result.Node, "api_server", jt.APIServerEndpoint)
+	joinErr := vm.SSH.ExecuteCommand("sudo kubeadm join --config /tmp/kubeadm-join.yaml && rm -f /tmp/kubeadm-join.yaml")
+	defer func() {
+		if _, err := kubectl(jt.Kubeconfig, "delete", "node", result.Node, "--ignore-not-found"); err != nil {
+			slog.Warn("Failed to remove node from test cluster", "node", result.Node, "error", err)
+		}
+	}()
+	if joinErr != nil {
+		return fail(fmt.Errorf("kubeadm join failed: %w", joinErr))
+	}
+
+	result.Ready, result.GPUs, err = waitForNode(jt.Kubeconfig, result.Node, readyTimeout)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Duration = time.Since(started)
+	if err := manifest.WriteJSON(result, artifactsDir.File("join-test.json")); err != nil {
+		slog.Warn("Failed to write join test results", "error", err)
+	}
+	slog.Info("Join test passed", "node", result.Node, "gpus", result.GPUs)
+	return result, nil
+}
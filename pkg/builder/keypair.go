@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// ensureKeypair imports public_key_path as keypair_name when the environment has no keypair of that name,
+// so a build can start in an environment nobody has set up a keypair in
+func ensureKeypair(ctx context.Context, api API, cfg *types.Config) error {
+	if cfg.PublicKeyPath == "" {
+		return nil
+	}
+	publicKey, err := ReadPublicKey(cfg.PublicKeyPath)
+	if err != nil {
+		return err
+	}
+	keypairs, err := api.ListKeypairs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list keypairs: %w", err)
+	}
+	for _, kp := range keypairs {
+		if kp.Name == cfg.KeypairName && kp.Environment.Name == cfg.EnvironmentName {
+			return nil
+		}
+	}
+
+	kp, err := api.ImportKeypair(ctx, cfg.KeypairName, cfg.EnvironmentName, publicKey)
+	if err != nil {
+		return err
+	}
+	slog.Info("Imported keypair", "keypair", kp.Name, "id", kp.ID, "environment", cfg.EnvironmentName, "fingerprint", kp.Fingerprint)
+	return nil
+}
+
+// ReadPublicKey reads an SSH public key in authorized_keys format, expanding a leading ~ to the home
+// directory, and checks that it parses
+func ReadPublicKey(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key: %w", err)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err != nil {
+		return "", fmt.Errorf("%s is not an SSH public key: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
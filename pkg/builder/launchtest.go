@@ -0,0 +1,228 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/junit"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// defaultValidationChecks is the suite run against a launch-tested image when none is configured
+var defaultValidationChecks = []types.ValidationCheck{
+	{Name: "nvidia-smi", Command: "nvidia-smi"},
+	{Name: "containerd", Command: "systemctl is-active containerd && containerd --version"},
+	{Name: "kubelet", Command: "kubelet --version"},
+}
+
+// validationChecks returns the configured checks, falling back to the default suite
+func validationChecks(lt *types.LaunchTestConfig) []types.ValidationCheck {
+	checks := append([]types.ValidationCheck{}, lt.Checks...)
+	for _, command := range lt.Commands {
+		checks = append(checks, types.ValidationCheck{Name: command, Command: command})
+	}
+	if len(checks) == 0 {
+		return defaultValidationChecks
+	}
+	return checks
+}
+
+// runChecks executes every check, recording a result for each rather than stopping at the first failure
+func runChecks(sshClient Shell, checks []types.ValidationCheck) ([]manifest.CheckResult, error) {
+	results := make([]manifest.CheckResult, 0, len(checks))
+	failed := 0
+
+	for _, check := range checks {
+		slog.Info("Launch test: running check", "check", check.Name)
+		started := time.Now()
+		err := sshClient.ExecuteCommand(check.Command)
+
+		result := manifest.CheckResult{
+			Name:     check.Name,
+			Command:  check.Command,
+			Passed:   err == nil,
+			Duration: time.Since(started),
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+			slog.Warn("Launch test: check failed", "check", check.Name, "error", err)
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d validation checks failed", failed, len(checks))
+	}
+	return results, nil
+}
+
+// TestVM is a VM booted from a freshly built image for post-build testing
+type TestVM struct {
+	ID  int
+	IP  string
+	SSH Shell
+}
+
+// BootTestVM creates a labeled VM from the image on the given flavor, waits for it and connects over SSH.
+// The returned cleanup function closes the connection and tears the VM down, and is safe to call on error.
+func (b *Builder) BootTestVM(ctx context.Context, cfg *types.Config, image *types.Image, buildID, flavorName, purpose string) (*TestVM, func(), error) {
+	cleanup := func() {}
+	ttl, err := resourceTTL(cfg)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	timeouts, err := config.ResolveTimeouts(cfg)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	testCfg := *cfg
+	testCfg.VMName = fmt.Sprintf("%s-%s-%d", cfg.VMName, purpose, time.Now().Unix())
+	testCfg.BaseImageName = image.Name
+	if flavorName != "" {
+		testCfg.FlavorName = flavorName
+	}
+	testCfg.Tags = append(append([]string{}, cfg.Tags...), labels.Builder, labels.BuildID(buildID), labels.Expires(time.Now().Add(ttl)))
+	if err := resolveSSHCIDR(ctx, &testCfg); err != nil {
+		return nil, cleanup, err
+	}
+
+	slog.Info("Creating test VM", "purpose", purpose, "name", testCfg.VMName, "flavor", testCfg.FlavorName, "image_name", image.Name)
+	vmResp, err := b.API.CreateVM(ctx, testCfg)
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("failed to create %s VM: %w", purpose, err)
+	}
+	if len(vmResp.Instances) == 0 {
+		return nil, cleanup, fmt.Errorf("no %s instances created", purpose)
+	}
+
+	vm := &TestVM{ID: vmResp.Instances[0].ID}
+	cleanup = func() {
+		if vm.SSH != nil {
+			vm.SSH.Close()
+		}
+		TeardownVM(context.WithoutCancel(ctx), b.API, vm.ID)
+	}
+
+	readyCtx, cancel := context.WithTimeout(ctx, timeouts.VMReady)
+	vm.IP, err = b.API.WaitForVMReady(readyCtx, vm.ID)
+	cancel()
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("%s VM failed to become ready: %w", purpose, err)
+	}
+
+	sshClient, err := b.dialVM(ctx, cfg, vm.IP)
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("%s VM: %w", purpose, err)
+	}
+	vm.SSH = sshClient
+
+	return vm, cleanup, nil
+}
+
+// launchTestOn boots a VM from the image on one flavor, runs the validation suite and deletes the VM
+func (b *Builder) launchTestOn(ctx context.Context, cfg *types.Config, image *types.Image, buildID, flavorName, step string, artifactsDir *artifacts.Dir) ([]manifest.CheckResult, error) {
+	vm, cleanup, err := b.BootTestVM(ctx, cfg, image, buildID, flavorName, "launchtest")
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := artifactsDir.StepLog(step)
+	if err != nil {
+		return nil, err
+	}
+	defer report.Close()
+	vm.SSH.SetOutput(report)
+	vm.SSH.SetStep(step)
+
+	return runChecks(vm.SSH, validationChecks(cfg.LaunchTest))
+}
+
+// launchTest runs the validation suite in the build's region, then on every additional flavor.
+// A failure on the primary flavor fails the test; failures on additional flavors only do with require_all_flavors.
+func (b *Builder) launchTest(ctx context.Context, cfg *types.Config, image *types.Image, buildID string, artifactsDir *artifacts.Dir) ([]manifest.CheckResult, []manifest.FlavorResult, error) {
+	lt := cfg.LaunchTest
+
+	results, err := b.launchTestOn(ctx, cfg, image, buildID, lt.FlavorName, "launch-test", artifactsDir)
+	if writeErr := manifest.WriteJSON(results, artifactsDir.File("launch-test.json")); writeErr != nil {
+		slog.Warn("Failed to write launch test results", "error", writeErr)
+	}
+	if err != nil {
+		return results, nil, err
+	}
+
+	var flavorResults []manifest.FlavorResult
+	failed := 0
+	for _, flavor := range lt.Flavors {
+		slog.Info("Launch test: verifying flavor", "flavor", flavor)
+		checks, err := b.launchTestOn(ctx, cfg, image, buildID, flavor, "launch-test-"+flavor, artifactsDir)
+
+		result := manifest.FlavorResult{Flavor: flavor, Passed: err == nil, Checks: checks}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+			slog.Warn("Launch test: flavor failed", "flavor", flavor, "error", err)
+		}
+		flavorResults = append(flavorResults, result)
+	}
+	if len(flavorResults) > 0 {
+		if err := manifest.WriteJSON(flavorResults, artifactsDir.File("launch-test-flavors.json")); err != nil {
+			slog.Warn("Failed to write per-flavor launch test results", "error", err)
+		}
+	}
+	if failed > 0 && lt.RequireAllFlavors {
+		return results, flavorResults, fmt.Errorf("%d of %d additional flavors failed", failed, len(lt.Flavors))
+	}
+
+	slog.Info("Launch test passed")
+	return results, flavorResults, nil
+}
+
+// discardImage deletes an image and the snapshot it was created from
+func discardImage(ctx context.Context, hyperstackClient API, image *types.Image, snapshot *types.Snapshot) {
+	slog.Info("Deleting image", "image_name", image.Name, "image_id", image.ID)
+	if err := hyperstackClient.DeleteImage(ctx, image.ID); err != nil {
+		slog.Warn("Failed to delete image", "image_id", image.ID, "error", err)
+	}
+
+	slog.Info("Deleting snapshot", "snapshot_name", snapshot.Name, "snapshot_id", snapshot.ID)
+	if err := hyperstackClient.DeleteSnapshot(ctx, snapshot.ID); err != nil {
+		slog.Warn("Failed to delete snapshot", "snapshot_id", snapshot.ID, "error", err)
+	}
+}
+
+// writeJUnit writes the launch and join test results as a JUnit XML report for CI test report UIs
+func writeJUnit(artifactsDir *artifacts.Dir, imageName string, checks []manifest.CheckResult, flavors []manifest.FlavorResult, join *manifest.JoinTestResult) {
+	report := junit.NewReport(imageName)
+	if len(checks) > 0 {
+		report.AddChecks("launch-test", checks)
+	}
+	for _, f := range flavors {
+		if len(f.Checks) > 0 {
+			report.AddChecks("launch-test."+f.Flavor, f.Checks)
+		} else {
+			report.AddCase("launch-test."+f.Flavor, "boot", 0, f.Error)
+		}
+	}
+	if join != nil {
+		report.AddCase("join-test", "node-ready", join.Duration, join.Error)
+	}
+	if len(report.Suites) == 0 {
+		return
+	}
+
+	path := artifactsDir.File("junit.xml")
+	if err := report.Write(path); err != nil {
+		slog.Warn("Failed to write JUnit report", "error", err)
+		return
+	}
+	slog.Info("Wrote JUnit report", "path", path)
+}
@@ -0,0 +1,115 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// Version is the builder version, set at build time with
+// -ldflags "-X github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder.Version=..."
+var Version = ""
+
+// builderVersion returns the release version, falling back to the module build info
+func builderVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "dev-" + setting.Value[:12]
+		}
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// sourceCommit returns the git commit of the repository holding the provisioning scripts and whether it has local changes
+func sourceCommit(dir string) (string, bool) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--", ".").Output()
+	dirty := err == nil && len(strings.TrimSpace(string(status))) > 0
+	return strings.TrimSpace(string(out)), dirty
+}
+
+// contentHash hashes the provisioning scripts and deployed files, in execution order
+func (b *Builder) contentHash(scripts []string, files []FileDeployment) (string, error) {
+	h := sha256.New()
+
+	add := func(kind, path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s %d\n", kind, filepath.Base(path), len(data))
+		h.Write(data)
+		return nil
+	}
+
+	for _, script := range scripts {
+		if err := add("script", filepath.Join(b.ScriptDir, script)); err != nil {
+			return "", err
+		}
+	}
+	for _, deployment := range files {
+		if err := add("file", filepath.Join(b.FilesDir, deployment.LocalPath)); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "dest %s\n", deployment.RemotePath)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inputDigest hashes every provisioning input that determines the image contents: the scripts and files
+// (via their content hash), and the base image
+func inputDigest(contentHash string, baseImageID int, baseImageName string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "content %s\nbase_image_id %d\nbase_image_name %s\n", contentHash, baseImageID, baseImageName)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rootfsDigest hashes the collected rootfs manifest, or returns "" if it was not collected
+func rootfsDigest(artifactsDir *artifacts.Dir) string {
+	data, err := os.ReadFile(artifacts.CollectedPath(artifactsDir.Path, "rootfs-manifest.txt"))
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// computeLineage gathers the facts that trace an image back to what produced it
+func (b *Builder) computeLineage(baseImageID int, baseImageName string, scripts []string, files []FileDeployment) (*manifest.Lineage, error) {
+	hash, err := b.contentHash(scripts, files)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, dirty := sourceCommit(b.ScriptDir)
+	return &manifest.Lineage{
+		BaseImageID:    baseImageID,
+		BuilderVersion: builderVersion(),
+		SourceCommit:   commit,
+		SourceDirty:    dirty,
+		ContentHash:    hash,
+		InputDigest:    inputDigest(hash, baseImageID, baseImageName),
+	}, nil
+}
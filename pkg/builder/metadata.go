@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metadata"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// buildMetadata gathers the structured metadata stamped onto a built image
+func buildMetadata(cfg *types.Config, buildID, contentHash string, sw *manifest.Software) *metadata.Metadata {
+	// Shortened like the lineage label to stay within label length limits
+	if len(contentHash) > 16 {
+		contentHash = contentHash[:16]
+	}
+	return &metadata.Metadata{
+		Schema:            metadata.SchemaVersion,
+		BuildID:           buildID,
+		ImageName:         cfg.ImageName,
+		ImageVersion:      cfg.ImageVersion,
+		ContentHash:       contentHash,
+		DriverVersion:     sw.NvidiaDriver,
+		CUDAVersion:       sw.CUDA,
+		ContainerdVersion: sw.Containerd,
+		KubernetesVersion: sw.Kubernetes,
+		Region:            cfg.Region,
+		BuiltAt:           time.Now().UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/hints"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/notify"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// newEvent returns an event of the build so far
+func newEvent(eventType, buildID string, cfg *types.Config, startedAt time.Time) *notify.Event {
+	return &notify.Event{
+		Type:         eventType,
+		BuildID:      buildID,
+		ImageName:    cfg.ImageName,
+		ImageVersion: cfg.ImageVersion,
+		Region:       cfg.Region,
+		Duration:     time.Since(startedAt),
+		Cost:         history.EstimateCost(cfg.HourlyCost, time.Since(startedAt)),
+	}
+}
+
+// notifyStep sends a lifecycle event of a running build, such as notify.EventStarted, to the notifiers
+// subscribed to it. imageID is only set for notify.EventImageCreated.
+func notifyStep(eventType, buildID string, cfg *types.Config, startedAt time.Time, imageID int) {
+	event := newEvent(eventType, buildID, cfg, startedAt)
+	event.ImageID = imageID
+	send(notify.FromConfig(cfg.Notifications, eventType), event)
+}
+
+// notifyBuild sends the outcome of a build to the configured notifiers. Delivery failures are logged, not returned.
+func notifyBuild(buildID string, cfg *types.Config, startedAt time.Time, buildErr error) {
+	event := newEvent(notify.EventSucceeded, buildID, cfg, startedAt)
+	if buildErr != nil {
+		event.Type = notify.EventFailed
+		event.Error = buildErr.Error()
+		if hint := hints.Classify(buildErr); hint != nil {
+			event.Hint = hint.Message + " " + hint.Remedy
+		}
+	}
+
+	notifiers := notify.FromConfig(cfg.Notifications, event.Type)
+	if len(notifiers) == 0 {
+		return
+	}
+
+	event.Artifacts = artifacts.PathFor(ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+	if buildErr == nil {
+		m, err := manifest.Read(filepath.Join(event.Artifacts, "manifest.json"))
+		if err != nil {
+			slog.Warn("Failed to read manifest for notifications", "error", err)
+		}
+		event.Manifest = m
+		if m != nil {
+			event.ImageID = m.ImageID
+		}
+	}
+	send(notifiers, event)
+}
+
+// send delivers the event to every notifier, logging failures
+func send(notifiers []notify.Notifier, event *notify.Event) {
+	for _, n := range notifiers {
+		if err := n.Notify(event); err != nil {
+			slog.Warn("Failed to send notification", "notifier", n.Name(), "error", err)
+			continue
+		}
+		slog.Info("Sent notification", "notifier", n.Name(), "event", event.Type)
+	}
+}
@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/buildstate"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/logging"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metrics"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// phaseTimer tracks the current build phase for log records, the phase duration metric and the timing summary
+type phaseTimer struct {
+	phase     string
+	startedAt time.Time
+	span      *tracing.Span
+	completed []manifest.Phase
+	// steps are the provisioning scripts, timed individually within the provision phase
+	steps []manifest.Phase
+	// state, if set, is kept up to date for the status command
+	state *buildstate.File
+}
+
+// start ends the current phase, if any, and begins the next one
+func (p *phaseTimer) start(phase string) {
+	p.end(manifest.PhaseSucceeded)
+	p.phase = phase
+	p.startedAt = time.Now()
+	p.span = tracing.StartCurrent(phase)
+	logging.SetPhase(phase)
+	p.updateState(func(s *buildstate.State) {
+		s.Phase = phase
+		s.PhaseStartedAt = p.startedAt.UTC()
+	})
+}
+
+// updateState records progress in the build's state file, if there is one
+func (p *phaseTimer) updateState(fn func(*buildstate.State)) {
+	if p.state == nil {
+		return
+	}
+	if err := p.state.Update(fn); err != nil {
+		slog.Warn("Failed to update build state", "error", err)
+	}
+}
+
+// end records the current phase with the given status
+func (p *phaseTimer) end(status string) {
+	if p.phase == "" {
+		return
+	}
+	d := time.Since(p.startedAt)
+	metrics.PhaseDuration.Observe(d.Seconds(), p.phase)
+	p.span.End(nil)
+	p.span = nil
+	p.completed = append(p.completed, manifest.Phase{
+		Name:      p.phase,
+		StartedAt: p.startedAt.UTC(),
+		Duration:  d,
+		Status:    status,
+	})
+	p.phase = ""
+}
+
+// step records how long a provisioning script took
+func (p *phaseTimer) step(script string, startedAt time.Time, err error) {
+	status := manifest.PhaseSucceeded
+	if err != nil {
+		status = manifest.PhaseFailed
+	}
+	d := time.Since(startedAt)
+	metrics.StepDuration.Observe(d.Seconds(), script)
+	p.steps = append(p.steps, manifest.Phase{
+		Name:      script,
+		StartedAt: startedAt.UTC(),
+		Duration:  d,
+		Status:    status,
+	})
+}
+
+// finish ends the last phase, marking it failed if the build failed
+func (p *phaseTimer) finish(buildErr error) {
+	if buildErr != nil {
+		// The phase's span carries the error; ending it again in end is a no-op
+		p.span.End(buildErr)
+		p.end(manifest.PhaseFailed)
+	} else {
+		p.end(manifest.PhaseSucceeded)
+	}
+}
+
+// durations totals the completed phases by name for build history
+func (p *phaseTimer) durations() map[string]time.Duration {
+	if len(p.completed) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(p.completed))
+	for _, phase := range p.completed {
+		durations[phase.Name] += phase.Duration
+	}
+	return durations
+}
+
+// stepDurations returns how long each provisioning script took for build history
+func (p *phaseTimer) stepDurations() map[string]time.Duration {
+	if len(p.steps) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(p.steps))
+	for _, step := range p.steps {
+		durations[step.Name] += step.Duration
+	}
+	return durations
+}
+
+// writeSummary prints a table of the completed phases, with the provisioning scripts indented under provision
+func (p *phaseTimer) writeSummary(w io.Writer) {
+	if len(p.completed) == 0 {
+		return
+	}
+	var total time.Duration
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tSTART\tDURATION\tSTATUS")
+	for _, phase := range p.completed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", phase.Name, phase.StartedAt.Local().Format("15:04:05"), phase.Duration.Round(time.Second), phase.Status)
+		total += phase.Duration
+		if phase.Name != "provision" {
+			continue
+		}
+		for _, step := range p.steps {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", step.Name, step.StartedAt.Local().Format("15:04:05"), step.Duration.Round(time.Second), step.Status)
+		}
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\n", total.Round(time.Second))
+	tw.Flush()
+}
+
+// typicalPhaseDuration returns how long the phase usually takes for this image according to build history, or 0
+func typicalPhaseDuration(cfg *types.Config, phase string) time.Duration {
+	records, err := history.Default().List()
+	if err != nil {
+		return 0
+	}
+	return history.TypicalPhaseDuration(records, cfg.ImageName, phase)
+}
@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// vmStopTimeout bounds the wait for the build VM to shut down before its snapshot
+const vmStopTimeout = 10 * time.Minute
+
+// stopVM shuts the build VM down before its snapshot, so nothing is writing to its filesystems
+func stopVM(ctx context.Context, api API, vmID int) error {
+	slog.Info("Stopping VM before the snapshot", "vm_id", vmID)
+	if err := api.StopVM(ctx, vmID); err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, vmStopTimeout)
+	defer cancel()
+	if err := api.WaitForVMStatus(waitCtx, vmID, "SHUTOFF"); err != nil {
+		return fmt.Errorf("VM failed to stop: %w", err)
+	}
+	return nil
+}
+
+// rebootIfUnreachable hard-reboots a VM that SSH can't connect to, such as one wedged while booting, and
+// waits for it to come back up. Nothing has run on it yet, so provisioning then starts as usual.
+func (b *Builder) rebootIfUnreachable(ctx context.Context, cfg *types.Config, vmID int, vmIP string, timeout time.Duration) error {
+	sshClient, err := b.dialVM(ctx, cfg, vmIP)
+	if err == nil {
+		sshClient.Close()
+		return nil
+	}
+	if !errors.Is(err, ErrVMUnreachable) || ctx.Err() != nil {
+		return err
+	}
+
+	slog.Warn("VM is unreachable over SSH, hard-rebooting it", "vm_id", vmID, "error", err)
+	if err := b.API.HardRebootVM(ctx, vmID); err != nil {
+		return fmt.Errorf("failed to hard-reboot unreachable VM: %w", err)
+	}
+	// Provisioning retries the connection while the VM boots, should it still be ACTIVE from before
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := b.API.WaitForVMReady(waitCtx, vmID); err != nil {
+		return fmt.Errorf("VM failed to come back after a hard reboot: %w", err)
+	}
+	return nil
+}
+
+// shelveVM shelves a kept VM so it isn't billed for its GPUs, reporting whether it was
+func shelveVM(ctx context.Context, api API, vmID int) bool {
+	slog.Info("Shelving kept VM", "vm_id", vmID)
+	if err := api.ShelveVM(ctx, vmID); err != nil {
+		slog.Warn("Failed to shelve kept VM", "vm_id", vmID, "error", err)
+		return false
+	}
+	return true
+}
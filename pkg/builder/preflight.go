@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// maxListed caps the names a preflight problem lists as alternatives
+const maxListed = 15
+
+// Preflight looks up the base image, flavor, keypair and environment of a config, so a mistake in one fails
+// the build with the alternatives listed instead of a bare API error once it is under way. A lookup that
+// fails is skipped with a warning rather than failing the build. When they all exist, the GPU stock of the
+// region is checked for room for the flavor, and the organization's quotas for room for the build.
+func Preflight(ctx context.Context, api API, cfg *types.Config) error {
+	var problems []string
+	var flavor *types.Flavor
+	environment := environmentName(cfg)
+
+	if images, err := api.ListImages(ctx); err != nil {
+		slog.Warn("Skipping base image preflight check", "error", err)
+	} else {
+		var inRegion, elsewhere []string
+		found := false
+		for _, img := range images {
+			switch {
+			case img.RegionName == cfg.Region && img.Name == cfg.BaseImageName:
+				found = true
+			case img.RegionName == cfg.Region:
+				inRegion = append(inRegion, img.Name)
+			case img.Name == cfg.BaseImageName:
+				elsewhere = append(elsewhere, img.RegionName)
+			}
+		}
+		if !found {
+			problem := fmt.Sprintf("base image %q not available in %s", cfg.BaseImageName, cfg.Region)
+			if len(elsewhere) > 0 {
+				problem += fmt.Sprintf(" (it is in %s)", listNames(elsewhere))
+			}
+			problems = append(problems, problem+"; available images: "+listNames(inRegion))
+		}
+	}
+
+	if flavors, err := api.ListFlavors(ctx); err != nil {
+		slog.Warn("Skipping flavor preflight check", "error", err)
+	} else {
+		var gpuFlavors []string
+		for i := range flavors {
+			if flavors[i].RegionName != cfg.Region {
+				continue
+			}
+			if flavors[i].Name == cfg.FlavorName {
+				flavor = &flavors[i]
+			}
+			if flavors[i].GPUCount > 0 {
+				gpuFlavors = append(gpuFlavors, flavors[i].Name)
+			}
+		}
+		if flavor == nil {
+			problems = append(problems, fmt.Sprintf("flavor %s not available in %s; available GPU flavors: %s", cfg.FlavorName, cfg.Region, listNames(gpuFlavors)))
+		}
+	}
+
+	environments, err := api.ListEnvironments(ctx)
+	if err != nil {
+		slog.Warn("Skipping environment preflight check", "error", err)
+	} else {
+		var names []string
+		var env *types.Environment
+		for i := range environments {
+			names = append(names, environments[i].Name)
+			if environments[i].Name == environment {
+				env = &environments[i]
+			}
+		}
+		switch {
+		case env == nil && cfg.EnsureEnvironment:
+			// Created by the build
+		case env == nil:
+			problems = append(problems, fmt.Sprintf("environment %s not found; available environments: %s", environment, listNames(names)))
+		case env.Region != "" && env.Region != cfg.Region:
+			problems = append(problems, fmt.Sprintf("environment %s is in %s, not %s", env.Name, env.Region, cfg.Region))
+		}
+	}
+
+	if keypairs, err := api.ListKeypairs(ctx); err != nil {
+		slog.Warn("Skipping keypair preflight check", "error", err)
+	} else {
+		var inEnvironment []string
+		var otherEnvironment string
+		found := false
+		for _, kp := range keypairs {
+			switch {
+			case kp.Environment.Name == environment && kp.Name == cfg.KeypairName:
+				found = true
+			case kp.Environment.Name == environment:
+				inEnvironment = append(inEnvironment, kp.Name)
+			case kp.Name == cfg.KeypairName:
+				otherEnvironment = kp.Environment.Name
+			}
+		}
+		switch {
+		// A missing keypair is imported from public_key_path by the build
+		case found || cfg.PublicKeyPath != "":
+		case otherEnvironment != "":
+			problems = append(problems, fmt.Sprintf("keypair %s is in environment %s, not %s", cfg.KeypairName, otherEnvironment, environment))
+		default:
+			problems = append(problems, fmt.Sprintf("keypair %s not found in environment %s; available keypairs: %s", cfg.KeypairName, environment, listNames(inEnvironment)))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrPreflight, strings.Join(problems, ". "))
+	}
+	if flavor == nil {
+		flavor = &types.Flavor{Name: cfg.FlavorName}
+	} else if err := checkStock(ctx, api, cfg, *flavor); err != nil {
+		return err
+	}
+	return checkBuildQuotas(ctx, api, cfg, *flavor)
+}
+
+// listNames lists names sorted and without repeats, cut short after maxListed
+func listNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	var unique []string
+	for i, name := range sorted {
+		if i == 0 || name != sorted[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	if len(unique) > maxListed {
+		return fmt.Sprintf("%s and %d more", strings.Join(unique[:maxListed], ", "), len(unique)-maxListed)
+	}
+	return strings.Join(unique, ", ")
+}
@@ -0,0 +1,276 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// FileDeployment represents a file to be copied to a specific destination
+type FileDeployment struct {
+	LocalPath  string
+	RemotePath string
+}
+
+// Scripts returns the scripts of the enabled provisioners, in order
+func Scripts(provisioners []types.Provisioner) []string {
+	scripts := []string{}
+	for _, p := range provisioners {
+		if !p.Disabled {
+			scripts = append(scripts, p.Script)
+		}
+	}
+	return scripts
+}
+
+// Deployments returns the deployments of the enabled files, in order
+func Deployments(files []types.FileConfig) []FileDeployment {
+	deployments := []FileDeployment{}
+	for _, f := range files {
+		if !f.Disabled {
+			deployments = append(deployments, FileDeployment{LocalPath: f.Source, RemotePath: f.Destination})
+		}
+	}
+	return deployments
+}
+
+// files returns the files a config deploys: its own files section, or the builder's defaults
+func (b *Builder) files(cfg *types.Config) []FileDeployment {
+	if cfg.Files != nil {
+		return Deployments(cfg.Files)
+	}
+	return b.Files
+}
+
+// defaultCollect lists the files always collected from the VM into the artifacts directory
+var defaultCollect = []types.CollectSpec{
+	{
+		Name:    "packages.txt",
+		Command: `dpkg-query -W -f='${Package}\t${Version}\n'`,
+	},
+	{
+		Name:    "kernel.txt",
+		Command: "uname -r",
+	},
+	{
+		Name:    "nvidia-driver.txt",
+		Command: "nvidia-smi --query-gpu=driver_version --format=csv,noheader | head -n1",
+	},
+	{
+		// The installed toolkit's version, falling back to the highest version the driver supports
+		Name:    "cuda.txt",
+		Command: `{ $(command -v nvcc || echo /usr/local/cuda/bin/nvcc) --version 2>/dev/null | sed -n 's/.*release \([0-9.]*\).*/\1/p'; nvidia-smi | sed -n 's/.*CUDA Version: *\([0-9.]*\).*/\1/p'; } | head -n1`,
+	},
+	{
+		// Path, size and mode of every file on the root filesystem, skipping volatile directories.
+		// Its digest lets two builds be compared for drift.
+		Name:    "rootfs-manifest.txt",
+		Command: `sudo find / -xdev \( -path /proc -o -path /sys -o -path /dev -o -path /run -o -path /tmp -o -path /var/tmp -o -path /var/log -o -path /var/cache -o -path /var/lib/cloud -o -path /home \) -prune -o -type f -printf '%p %s %m\n' | LC_ALL=C sort`,
+	},
+	{
+		Name:    "containerd.txt",
+		Command: "containerd --version | awk '{print $3}'",
+	},
+	{
+		Name:    "kubernetes.txt",
+		Command: "kubelet --version | awk '{print $2}'",
+	},
+}
+
+func executeScripts(sshClient Shell, scripts []string, scriptDir, remoteScriptDir string, artifactsDir *artifacts.Dir, phases *phaseTimer) error {
+	// Create remote directory
+	slog.Info("Creating remote script directory", "dir", remoteScriptDir)
+	if err := sshClient.ExecuteCommand(fmt.Sprintf("mkdir -p %s", remoteScriptDir)); err != nil {
+		return fmt.Errorf("failed to create remote script directory: %w", err)
+	}
+
+	// Copy and execute each script
+	for i, script := range scripts {
+		localPath := filepath.Join(scriptDir, script)
+		remotePath := filepath.Join(remoteScriptDir, script)
+
+		slog.Info("Copying script to VM", "step", i+1, "script", script)
+
+		// Check if local script exists
+		if _, err := os.Stat(localPath); os.IsNotExist(err) {
+			return fmt.Errorf("local script not found: %s", localPath)
+		}
+
+		// Copy script to VM
+		if err := sshClient.CopyFile(localPath, remotePath); err != nil {
+			return fmt.Errorf("failed to copy script %s: %w", script, err)
+		}
+
+		// Execute script, mirroring its output into the step log
+		slog.Info("Executing script", "step", i+1, "script", script)
+		stepLog, err := artifactsDir.StepLog(script)
+		if err != nil {
+			return err
+		}
+		sshClient.SetOutput(stepLog)
+		sshClient.SetStep(script)
+		stepStartedAt := time.Now()
+		span := tracing.StartCurrent("script "+script, tracing.String("script", script), tracing.Int("step", i+1))
+		err = sshClient.ExecuteScript(remotePath)
+		span.End(err)
+		phases.step(script, stepStartedAt, err)
+		sshClient.SetStep("")
+		sshClient.SetOutput(nil)
+		stepLog.Close()
+		if err != nil {
+			return fmt.Errorf("failed to execute script %s: %w", script, err)
+		}
+
+		slog.Info("Successfully executed script", "step", i+1, "script", script)
+	}
+
+	return nil
+}
+
+func deployFiles(sshClient Shell, deployments []FileDeployment, filesDir string) error {
+	slog.Info("Deploying configuration files")
+
+	for _, deployment := range deployments {
+		localPath := filepath.Join(filesDir, deployment.LocalPath)
+
+		// Check if local file exists
+		if _, err := os.Stat(localPath); os.IsNotExist(err) {
+			return fmt.Errorf("local file not found: %s", localPath)
+		}
+
+		// Create remote directory if needed
+		remoteDir := filepath.Dir(deployment.RemotePath)
+		if err := sshClient.ExecuteCommand(fmt.Sprintf("sudo mkdir -p %s", remoteDir)); err != nil {
+			return fmt.Errorf("failed to create remote directory %s: %w", remoteDir, err)
+		}
+
+		// Copy file to temp location first
+		tempPath := fmt.Sprintf("/tmp/%s", filepath.Base(deployment.LocalPath))
+		if err := sshClient.CopyFile(localPath, tempPath); err != nil {
+			return fmt.Errorf("failed to copy file %s: %w", deployment.LocalPath, err)
+		}
+
+		// Move to final location with sudo
+		if err := sshClient.ExecuteCommand(fmt.Sprintf("sudo mv %s %s", tempPath, deployment.RemotePath)); err != nil {
+			return fmt.Errorf("failed to move file to %s: %w", deployment.RemotePath, err)
+		}
+
+		slog.Info("Successfully deployed file", "local", deployment.LocalPath, "remote", deployment.RemotePath)
+	}
+
+	return nil
+}
+
+// collectArtifacts runs each collection command on the VM and stores its output in the artifacts directory
+func collectArtifacts(sshClient Shell, specs []types.CollectSpec, artifactsDir *artifacts.Dir) {
+	slog.Info("Collecting build artifacts from VM")
+
+	for _, spec := range specs {
+		output, err := sshClient.CommandOutput(spec.Command)
+		if err != nil {
+			slog.Warn("Failed to collect artifact", "name", spec.Name, "error", err)
+			continue
+		}
+		if err := artifactsDir.WriteCollected(spec.Name, output); err != nil {
+			slog.Warn("Failed to save artifact", "name", spec.Name, "error", err)
+			continue
+		}
+		slog.Info("Collected artifact", "name", spec.Name)
+	}
+}
+
+// dialVM connects to a VM as ubuntu, retrying within ctx for up to the SSH timeout
+func (b *Builder) dialVM(ctx context.Context, cfg *types.Config, host string) (Shell, error) {
+	timeouts, err := config.ResolveTimeouts(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sshClient, err := b.Dial(cfg.PrivateKeyPath, "ubuntu")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, timeouts.SSH)
+	defer cancel()
+	if err := sshClient.Connect(connectCtx, host); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVMUnreachable, err)
+	}
+	return sshClient, nil
+}
+
+// Provision runs the scripts, deploys files and collects artifacts on an existing host, such as a long-lived
+// dev VM, without calling the API. Logs and collected files go to artifacts/provision-<host>.
+func (b *Builder) Provision(ctx context.Context, cfg *types.Config, host string, scripts []string) error {
+	collect := defaultCollect
+	if cfg.Artifacts != nil {
+		collect = append(append([]types.CollectSpec{}, defaultCollect...), cfg.Artifacts.Collect...)
+	}
+	artifactsDir, err := artifacts.New(ArtifactsRoot(cfg), "provision", host)
+	if err != nil {
+		return err
+	}
+	slog.Info("Writing provisioning artifacts", "dir", artifactsDir.Path)
+
+	phases := &phaseTimer{}
+	phases.start("provision")
+	err = b.provision(ctx, cfg, host, scripts, collect, nil, artifactsDir, phases)
+	phases.finish(err)
+	phases.writeSummary(os.Stderr)
+	if err != nil {
+		return &PhaseError{Phase: "provision", Err: fmt.Errorf("provisioning failed: %w", err)}
+	}
+	return nil
+}
+
+// provision connects to the build VM, runs the scripts, deploys files and collects artifacts
+func (b *Builder) provision(ctx context.Context, cfg *types.Config, vmIP string, scripts []string, collect []types.CollectSpec, release *imageRelease, artifactsDir *artifacts.Dir, phases *phaseTimer) error {
+	slog.Info("Starting provisioning scripts execution via SSH")
+
+	// Connect to VM
+	slog.Info("Connecting to VM", "ip", vmIP)
+	sshClient, err := b.dialVM(ctx, cfg, vmIP)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	// Closing the connection aborts the running script once the build's deadline passes
+	defer context.AfterFunc(ctx, func() { sshClient.Close() })()
+	sshClient.SetEnv(cfg.ScriptEnv)
+
+	remoteScriptDir := "/tmp/provisioning-scripts"
+
+	// Execute scripts
+	if err := executeScripts(sshClient, scripts, b.ScriptDir, remoteScriptDir, artifactsDir, phases); err != nil {
+		return fmt.Errorf("failed to execute scripts: %w", err)
+	}
+
+	// Deploy configuration files
+	if err := deployFiles(sshClient, b.files(cfg), b.FilesDir); err != nil {
+		return fmt.Errorf("failed to deploy files: %w", err)
+	}
+
+	collectArtifacts(sshClient, collect, artifactsDir)
+
+	// Written after collection so it can include the installed versions. There is none outside a build.
+	if release != nil {
+		if err := writeImageRelease(sshClient, release, artifactsDir); err != nil {
+			return err
+		}
+	}
+
+	// Clean up remote scripts
+	slog.Info("Cleaning up remote scripts")
+	if err := sshClient.ExecuteCommand(fmt.Sprintf("rm -rf %s", remoteScriptDir)); err != nil {
+		slog.Warn("Failed to clean up remote scripts", "error", err)
+	}
+
+	slog.Info("Provisioning scripts execution completed successfully")
+	return nil
+}
@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/lock"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// vmSlotPool is the host-wide pool of build VM slots limited by max_parallel
+const vmSlotPool = "vm"
+
+// lockPollInterval is how often WaitForLock checks whether another build still holds the image name
+const lockPollInterval = 30 * time.Second
+
+// quotaRetryInterval is how long a queued build waits before retrying a VM creation refused for quota
+const quotaRetryInterval = time.Minute
+
+// acquireVMSlot waits for one of the host's max_parallel build VM slots. The returned function frees it.
+func acquireVMSlot(ctx context.Context, maxParallel int) (func(), error) {
+	slot, err := lock.AcquireSlot(ctx, vmSlotPool, maxParallel)
+	if err != nil {
+		return nil, fmt.Errorf("queued build did not start: %w", err)
+	}
+	return func() {
+		if err := slot.Release(); err != nil {
+			slog.Warn("Failed to release VM slot", "error", err)
+		}
+	}, nil
+}
+
+// createQueuedVM creates the build VM, and while the account's quota refuses it, waits for other builds to
+// free some up until ctx is done
+func (b *Builder) createQueuedVM(ctx context.Context, cfg types.Config) (*types.VMCreateResponse, error) {
+	for {
+		resp, err := b.API.CreateVM(ctx, cfg)
+		if !errors.Is(err, client.ErrQuotaExceeded) {
+			return resp, err
+		}
+		slog.Warn("VM quota reached, waiting for other builds to finish", "retry_in", quotaRetryInterval, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (gave up waiting for quota: %w)", err, context.Cause(ctx))
+		case <-time.After(quotaRetryInterval):
+		}
+	}
+}
+
+// WaitForLock waits until no build on this host holds the lock on the config's image name and region, and
+// no VM holds its API claim, or ctx is done. It doesn't take the lock itself, so a build started after it
+// returns can still find the image name busy if another one got there first.
+func WaitForLock(ctx context.Context, hyperstackClient API, cfg *types.Config) error {
+	name := claimName(cfg)
+	for {
+		var busy string
+		if holder := lock.Holder(name); holder != nil {
+			busy = fmt.Sprintf("pid %d on %s", holder.PID, holder.Hostname)
+		} else {
+			claims, err := findClaims(ctx, hyperstackClient, name)
+			if err != nil {
+				return fmt.Errorf("failed to check build claims: %w", err)
+			}
+			if len(claims) > 0 {
+				busy = fmt.Sprintf("VM %s (ID: %d)", claims[0].Name, claims[0].ID)
+			}
+		}
+		if busy == "" {
+			return nil
+		}
+
+		slog.Info("Waiting for another build of the image to finish", "image_name", cfg.ImageName, "region", cfg.Region, "held_by", busy, "retry_in", lockPollInterval)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: image %s in %s is still being built by %s", ErrBuildInProgress, cfg.ImageName, cfg.Region, busy)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// quotaUse is how much of a resource a build takes while it runs
+type quotaUse struct {
+	resource string
+	model    string
+	region   string
+	amount   int
+}
+
+// buildQuotaUse lists what a build takes of the quotas: its VM, the GPUs of its flavor and its scratch
+// volume, in each region it builds in. flavors finds the flavor of a region.
+func buildQuotaUse(cfg *types.Config, flavors func(region string) (types.Flavor, bool)) []quotaUse {
+	regions := cfg.Regions
+	if len(regions) == 0 {
+		regions = []string{cfg.Region}
+	}
+	var uses []quotaUse
+	for _, region := range regions {
+		uses = append(uses, quotaUse{resource: "vm", region: region, amount: 1})
+		if flavor, ok := flavors(region); ok && flavor.GPUCount > 0 {
+			uses = append(uses, quotaUse{resource: "gpu", model: flavor.GPU, region: region, amount: flavor.GPUCount})
+		}
+		if cfg.ScratchVolume != nil {
+			uses = append(uses,
+				quotaUse{resource: "volume", region: region, amount: 1},
+				quotaUse{resource: "volume_size", region: region, amount: cfg.ScratchVolume.SizeGB})
+		}
+	}
+	return uses
+}
+
+// counts reports whether a quota counts a use; quotas without a region or model count all of them
+func (u quotaUse) counts(q types.Quota) bool {
+	return q.Resource == u.resource &&
+		(q.Region == "" || q.Region == u.region) &&
+		(q.Model == "" || strings.EqualFold(q.Model, u.model))
+}
+
+// describeQuota names a quota for a problem message, e.g. "gpu quota for H100-80G-PCIe in CANADA-1"
+func describeQuota(q types.Quota) string {
+	name := q.Resource + " quota"
+	if q.Model != "" {
+		name += " for " + q.Model
+	}
+	if q.Region != "" {
+		name += " in " + q.Region
+	}
+	return name
+}
+
+// checkQuotas fails with client.ErrQuotaExceeded, naming each quota, when concurrent of the builds at once
+// would take more than is left of a quota. Queued builds wait for others to free quota up, so for them
+// only a quota too small for any one of the builds even when nothing else uses it fails, and the rest is
+// logged.
+func checkQuotas(quotas []types.Quota, builds [][]quotaUse, concurrent int, queued bool) error {
+	var problems []string
+	for _, q := range quotas {
+		if q.Limit < 0 {
+			continue
+		}
+		// The builds that take most of the quota may run at the same time
+		var needs []int
+		for _, uses := range builds {
+			need := 0
+			for _, u := range uses {
+				if u.counts(q) {
+					need += u.amount
+				}
+			}
+			if need > 0 {
+				needs = append(needs, need)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(needs)))
+		need := 0
+		for _, n := range needs[:min(concurrent, len(needs))] {
+			need += n
+		}
+		if need == 0 || q.Used+need <= q.Limit {
+			continue
+		}
+
+		problem := fmt.Sprintf("%s: %d of %d in use, %d needed", describeQuota(q), q.Used, q.Limit, need)
+		if queued && needs[0] <= q.Limit {
+			slog.Warn("Quota is in use by other builds, waiting for it when creating VMs", "quota", problem)
+			continue
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", client.ErrQuotaExceeded, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkBuildQuotas checks that the quotas have room for a build with a VM of flavor. A failure to list
+// the quotas is logged and skipped.
+func checkBuildQuotas(ctx context.Context, api API, cfg *types.Config, flavor types.Flavor) error {
+	quotas, err := api.ListQuotas(ctx)
+	if err != nil {
+		slog.Warn("Skipping quota preflight check", "error", err)
+		return nil
+	}
+	uses := buildQuotaUse(cfg, func(string) (types.Flavor, bool) { return flavor, true })
+	return checkQuotas(quotas, [][]quotaUse{uses}, 1, cfg.MaxParallel > 0)
+}
+
+// CheckMatrixQuotas checks, before a matrix fans out, that the quotas have room for concurrency of its
+// builds at once, taking the builds that need the most. A failure to list the quotas or flavors is logged
+// and skipped, leaving each build to check its own.
+func CheckMatrixQuotas(ctx context.Context, api API, configs []*types.Config, concurrency int, queued bool) error {
+	quotas, err := api.ListQuotas(ctx)
+	if err != nil {
+		slog.Warn("Skipping matrix quota check", "error", err)
+		return nil
+	}
+	flavors, err := api.ListFlavors(ctx)
+	if err != nil {
+		slog.Warn("Skipping matrix quota check", "error", err)
+		return nil
+	}
+
+	builds := make([][]quotaUse, len(configs))
+	for i, cfg := range configs {
+		builds[i] = buildQuotaUse(cfg, func(region string) (types.Flavor, bool) {
+			// A build that picks its region has a flavor of the same name, and GPUs, everywhere
+			for _, flavor := range flavors {
+				if flavor.Name == cfg.FlavorName && (region == "" || flavor.RegionName == region) {
+					return flavor, true
+				}
+			}
+			return types.Flavor{}, false
+		})
+	}
+	return checkQuotas(quotas, builds, concurrency, queued)
+}
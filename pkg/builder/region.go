@@ -0,0 +1,78 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// SelectRegion picks the region to build in for a config that leaves region empty: the first region, in the
+// order the API lists them, where the flavor is in stock and the base image is available
+func SelectRegion(ctx context.Context, api API, cfg *types.Config) (string, error) {
+	regions, err := api.ListRegions(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list regions: %w", err)
+	}
+	flavors, err := api.ListFlavors(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list flavors: %w", err)
+	}
+	images, err := api.ListImages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list images: %w", err)
+	}
+	stocks, err := api.ListStocks(ctx)
+	if err != nil {
+		slog.Warn("Selecting a region without the GPU stock", "error", err)
+	}
+
+	hasImage := make(map[string]bool)
+	for _, img := range images {
+		if img.Name == cfg.BaseImageName {
+			hasImage[img.RegionName] = true
+		}
+	}
+	inStock := make(map[string]bool)
+	var outOfStock []string
+	for _, flavor := range flavors {
+		if flavor.Name != cfg.FlavorName {
+			continue
+		}
+		// Regions that don't report stock are assumed to have it. The stock endpoint is more current than
+		// the flavor list.
+		available := flavor.StockAvailable == nil || *flavor.StockAvailable
+		if vms, ok := flavorStock(stocks, flavor.RegionName, flavor); ok {
+			available = vms > 0
+		}
+		if available {
+			inStock[flavor.RegionName] = true
+		} else {
+			outOfStock = append(outOfStock, flavor.RegionName)
+		}
+	}
+
+	var withoutImage []string
+	for _, region := range regions {
+		if !inStock[region.Name] {
+			continue
+		}
+		if !hasImage[region.Name] {
+			withoutImage = append(withoutImage, region.Name)
+			continue
+		}
+		slog.Info("Selected region", "region", region.Name, "flavor", cfg.FlavorName)
+		return region.Name, nil
+	}
+
+	msg := fmt.Sprintf("failed to select a region: no region has flavor %s in stock and base image %q", cfg.FlavorName, cfg.BaseImageName)
+	if len(withoutImage) > 0 {
+		msg += fmt.Sprintf("; the flavor is in stock in %s, without the base image", listNames(withoutImage))
+	}
+	if len(outOfStock) > 0 {
+		msg += fmt.Sprintf("; it is out of stock in %s", listNames(outOfStock))
+	}
+	return "", errors.New(msg)
+}
@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// defaultResourceTTL is used when the config does not set resource_ttl
+const defaultResourceTTL = 12 * time.Hour
+
+// resourceTTL returns the configured lifetime of temporary build resources
+func resourceTTL(cfg *types.Config) (time.Duration, error) {
+	if cfg.ResourceTTL == "" {
+		return defaultResourceTTL, nil
+	}
+	ttl, err := time.ParseDuration(cfg.ResourceTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resource_ttl %q: %w", cfg.ResourceTTL, err)
+	}
+	return ttl, nil
+}
+
+// buildBudget returns how long a build may run under max_build_minutes and max_build_cost, whichever is
+// stricter, with the limit that sets it, or 0 if there is no budget
+func buildBudget(cfg *types.Config) (time.Duration, string, error) {
+	if cfg.MaxBuildMinutes < 0 {
+		return 0, "", fmt.Errorf("max_build_minutes must not be negative")
+	}
+	if cfg.MaxBuildCost < 0 {
+		return 0, "", fmt.Errorf("max_build_cost must not be negative")
+	}
+	var budget time.Duration
+	var limit string
+	if cfg.MaxBuildMinutes > 0 {
+		budget = time.Duration(cfg.MaxBuildMinutes) * time.Minute
+		limit = fmt.Sprintf("max_build_minutes of %d", cfg.MaxBuildMinutes)
+	}
+	if cfg.MaxBuildCost > 0 {
+		if cfg.HourlyCost <= 0 {
+			return 0, "", fmt.Errorf("max_build_cost needs hourly_cost to be set")
+		}
+		byCost := time.Duration(cfg.MaxBuildCost / cfg.HourlyCost * float64(time.Hour))
+		if budget == 0 || byCost < budget {
+			budget = byCost
+			limit = fmt.Sprintf("max_build_cost of %.2f at %.2f an hour", cfg.MaxBuildCost, cfg.HourlyCost)
+		}
+	}
+	return budget, limit, nil
+}
+
+// TeardownVM releases the VM's floating IP and deletes it, returning an error only if the VM could not be deleted
+func TeardownVM(ctx context.Context, hyperstackClient API, vmID int) error {
+	vm, err := hyperstackClient.GetVMDetails(ctx, vmID)
+	if err != nil {
+		slog.Warn("Failed to get VM details before teardown", "vm_id", vmID, "error", err)
+	} else if vm.FloatingIP != "" {
+		slog.Info("Releasing floating IP", "vm_id", vmID, "floating_ip", vm.FloatingIP)
+		if err := hyperstackClient.DetachFloatingIP(ctx, vmID); err != nil {
+			slog.Warn("Failed to release floating IP", "vm_id", vmID, "floating_ip", vm.FloatingIP, "error", err)
+		}
+	}
+
+	slog.Info("Cleaning up VM", "vm_id", vmID)
+	// A VM that is already gone needs no cleaning up
+	if err := hyperstackClient.DeleteVM(ctx, vmID); err != nil && !errors.Is(err, client.ErrNotFound) {
+		slog.Warn("Failed to delete VM", "vm_id", vmID, "error", err)
+		return fmt.Errorf("failed to delete VM %d: %w", vmID, err)
+	}
+	return nil
+}
+
+// keptVM looks up the address of a VM kept after a failed build, preferring its floating IP
+func keptVM(ctx context.Context, hyperstackClient API, vm types.VMInstance, privateKeyPath string) *KeptVM {
+	kept := &KeptVM{ID: vm.ID, Name: vm.Name, IP: vm.FloatingIP, PrivateKeyPath: privateKeyPath}
+	details, err := hyperstackClient.GetVMDetails(ctx, vm.ID)
+	if err != nil {
+		slog.Warn("Failed to get details of kept VM", "vm_id", vm.ID, "error", err)
+		return kept
+	}
+	kept.IP = details.FloatingIP
+	if kept.IP == "" {
+		kept.IP = details.FixedIP
+	}
+	return kept
+}
+
+// claimName is what a build claims: its image name in its region, as images are regional
+func claimName(cfg *types.Config) string {
+	return cfg.ImageName + "@" + cfg.Region
+}
+
+// findClaims returns live VMs carrying the claim label for an image name and region
+func findClaims(ctx context.Context, hyperstackClient API, name string) ([]types.VMInstance, error) {
+	vms, err := hyperstackClient.ListVMs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	label := labels.Claim(name)
+	var claims []types.VMInstance
+	for _, vm := range vms {
+		if vm.Status == "DELETING" || vm.Status == "DELETED" || vm.Status == "ERROR" {
+			continue
+		}
+		for _, l := range vm.Labels {
+			if l == label {
+				claims = append(claims, vm)
+				break
+			}
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,46 @@
+package builder
+
+import (
+	"os"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+)
+
+// firstLine returns the first line of a collected artifact, or "" if it was not collected
+func firstLine(artifactsDir *artifacts.Dir, name string) string {
+	data, err := os.ReadFile(artifacts.CollectedPath(artifactsDir.Path, name))
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line)
+}
+
+// installedSoftware reads the versions queried from the VM after provisioning out of the collected artifacts
+func installedSoftware(artifactsDir *artifacts.Dir) *manifest.Software {
+	return &manifest.Software{
+		Kernel:       firstLine(artifactsDir, "kernel.txt"),
+		NvidiaDriver: firstLine(artifactsDir, "nvidia-driver.txt"),
+		CUDA:         firstLine(artifactsDir, "cuda.txt"),
+		Containerd:   firstLine(artifactsDir, "containerd.txt"),
+		Kubernetes:   firstLine(artifactsDir, "kubernetes.txt"),
+	}
+}
+
+// softwareLabels returns image labels recording the installed versions; versions that could not be queried are left out
+func softwareLabels(sw *manifest.Software) []string {
+	var labels []string
+	for _, l := range []struct{ key, value string }{
+		{"nvidia.com/driver.version", sw.NvidiaDriver},
+		{"nvidia.com/cuda.version", sw.CUDA},
+		{"containerd.version", sw.Containerd},
+		{"kubernetes.io/kubelet.version", sw.Kubernetes},
+	} {
+		if l.value != "" {
+			labels = append(labels, l.key+"="+l.value)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// defaultIPURL answers with the public IP address of the caller
+const defaultIPURL = "https://checkip.amazonaws.com"
+
+// resolveSSHCIDR replaces an ssh_cidr of "auto" with the CIDR of this host's public IP
+func resolveSSHCIDR(ctx context.Context, cfg *types.Config) error {
+	if cfg.SSHCIDR != config.SSHCIDRAuto {
+		return nil
+	}
+	cidr, err := detectSSHCIDR(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Restricting SSH to the builder's public IP", "ssh_cidr", cidr)
+	cfg.SSHCIDR = cidr
+	return nil
+}
+
+// detectSSHCIDR returns the public IP of this host as a single-address CIDR, asking the service at
+// HYPERSTACK_BUILDER_IP_URL or checkip.amazonaws.com
+func detectSSHCIDR(ctx context.Context) (string, error) {
+	url := os.Getenv("HYPERSTACK_BUILDER_IP_URL")
+	if url == "" {
+		url = defaultIPURL
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the public IP for ssh_cidr auto: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to detect the public IP for ssh_cidr auto: %s returned %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the public IP for ssh_cidr auto: %s answered %q", url, strings.TrimSpace(string(body)))
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+}
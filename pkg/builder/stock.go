@@ -0,0 +1,75 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// flavorStock returns how many VMs of a flavor the GPU stock of a region has room for, and whether the
+// stock lists the flavor's GPU in the region at all
+func flavorStock(stocks []types.Stock, region string, flavor types.Flavor) (int, bool) {
+	if flavor.GPUCount == 0 {
+		return 0, false
+	}
+	for _, stock := range stocks {
+		if stock.Region != region {
+			continue
+		}
+		for _, model := range stock.Models {
+			if !strings.EqualFold(model.Model, flavor.GPU) {
+				continue
+			}
+			if vms, ok := model.Configurations[fmt.Sprintf("%dx", flavor.GPUCount)]; ok {
+				return vms, true
+			}
+			available, err := model.Available.Int64()
+			if err != nil {
+				return 0, false
+			}
+			return int(available) / flavor.GPUCount, true
+		}
+	}
+	return 0, false
+}
+
+// checkStock fails with client.ErrFlavorOutOfStock when the GPU stock of the region has no room for a VM
+// of the flavor, naming the regions that do. The stock of every region is logged. A flavor without GPUs,
+// or whose GPU the stock doesn't list, passes.
+func checkStock(ctx context.Context, api API, cfg *types.Config, flavor types.Flavor) error {
+	stocks, err := api.ListStocks(ctx)
+	if err != nil {
+		slog.Warn("Skipping GPU stock preflight check", "error", err)
+		return nil
+	}
+
+	var regions []string
+	for _, stock := range stocks {
+		regions = append(regions, stock.Region)
+	}
+	sort.Strings(regions)
+	var inStock []string
+	for i, region := range regions {
+		if i > 0 && region == regions[i-1] {
+			continue
+		}
+		vms, ok := flavorStock(stocks, region, flavor)
+		if !ok {
+			continue
+		}
+		slog.Info("GPU stock", "region", region, "flavor", flavor.Name, "gpu", flavor.GPU, "vms", vms)
+		if vms > 0 && region != cfg.Region {
+			inStock = append(inStock, fmt.Sprintf("%s (%d)", region, vms))
+		}
+	}
+
+	if vms, ok := flavorStock(stocks, cfg.Region, flavor); !ok || vms > 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: no capacity for %s in %s; it is in stock in %s", client.ErrFlavorOutOfStock, cfg.FlavorName, cfg.Region, listNames(inStock))
+}
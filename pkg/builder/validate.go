@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/notify"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/policy"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/versioning"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Validate checks a single-image config for mistakes that would otherwise only surface once a build is under way
+func Validate(cfg *types.Config) error {
+	if err := config.CheckFields(cfg); err != nil {
+		return err
+	}
+
+	if _, err := resourceTTL(cfg); err != nil {
+		return err
+	}
+	if _, err := config.ResolveTimeouts(cfg); err != nil {
+		return err
+	}
+	if _, _, err := buildBudget(cfg); err != nil {
+		return err
+	}
+	if cfg.MaxParallel < 0 {
+		return fmt.Errorf("max_parallel must not be negative")
+	}
+	if err := notify.CheckConfig(cfg.Notifications); err != nil {
+		return err
+	}
+	if r := cfg.Retention; r != nil {
+		if r.Keep < 1 {
+			return fmt.Errorf("retention keep must be at least 1")
+		}
+		for name, keep := range r.Families {
+			if keep < 1 {
+				return fmt.Errorf("retention keep for %s must be at least 1", name)
+			}
+		}
+	}
+
+	// An "auto" version is only known once the published images have been listed
+	if cfg.ImageVersion != versioning.Auto {
+		imageName := fmt.Sprintf("%s_%s", cfg.ImageName, cfg.ImageVersion)
+		if err := policy.Precheck(cfg.Naming, imageName, cfg.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// ScratchDirEnv is the variable scripts find the mount point of the scratch volume in
+const ScratchDirEnv = "SCRATCH_DIR"
+
+const (
+	defaultScratchVolumeType = "Cloud-SSD"
+	defaultScratchMountPoint = "/mnt/scratch"
+	// volumeTimeout bounds each wait for a scratch volume to be created, attached or detached
+	volumeTimeout = 10 * time.Minute
+)
+
+// mountScratchCommand formats and mounts the first disk without a filesystem or partitions, waiting for
+// the attached volume to show up as one
+const mountScratchCommand = `for i in $(seq 60); do
+  for dev in $(lsblk -dnpo NAME,TYPE | awk '$2 == "disk" {print $1}'); do
+    if [ -z "$(lsblk -no FSTYPE,MOUNTPOINT "$dev" | tr -d ' \n')" ]; then
+      sudo mkfs.ext4 -q "$dev" && sudo mkdir -p %[1]s && sudo mount "$dev" %[1]s && sudo chmod 1777 %[1]s
+      exit $?
+    fi
+  done
+  sleep 5
+done
+echo "the scratch volume did not show up as a disk" >&2
+exit 1`
+
+// scratchVolume is a volume attached to the build VM for the scripts to use
+type scratchVolume struct {
+	id         int
+	vmID       int
+	mountPoint string
+}
+
+// attachScratchVolume creates the scratch volume of a config, attaches it to the VM, mounts it and passes
+// its mount point to the scripts. The volume is returned as soon as it exists, so that it is removed when
+// a later step fails.
+func (b *Builder) attachScratchVolume(ctx context.Context, cfg *types.Config, vm types.VMInstance, vmIP string) (*scratchVolume, error) {
+	volumeType := cfg.ScratchVolume.VolumeType
+	if volumeType == "" {
+		volumeType = defaultScratchVolumeType
+	}
+	mountPoint := cfg.ScratchVolume.MountPoint
+	if mountPoint == "" {
+		mountPoint = defaultScratchMountPoint
+	}
+
+	slog.Info("Creating scratch volume", "size_gb", cfg.ScratchVolume.SizeGB, "volume_type", volumeType)
+	volume, err := b.API.CreateVolume(ctx, vm.Name+"-scratch", cfg.EnvironmentName, cfg.ScratchVolume.SizeGB, volumeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch volume: %w", err)
+	}
+	scratch := &scratchVolume{id: volume.ID, vmID: vm.ID, mountPoint: mountPoint}
+
+	waitCtx, cancel := context.WithTimeout(ctx, volumeTimeout)
+	defer cancel()
+	if err := b.API.WaitForVolumeStatus(waitCtx, volume.ID, "available"); err != nil {
+		return scratch, fmt.Errorf("scratch volume failed to become available: %w", err)
+	}
+	if err := b.API.AttachVolume(ctx, vm.ID, volume.ID); err != nil {
+		return scratch, err
+	}
+	if err := b.API.WaitForVolumeStatus(waitCtx, volume.ID, "in-use"); err != nil {
+		return scratch, fmt.Errorf("scratch volume failed to attach: %w", err)
+	}
+
+	sshClient, err := b.dialVM(ctx, cfg, vmIP)
+	if err != nil {
+		return scratch, err
+	}
+	defer sshClient.Close()
+	if err := sshClient.ExecuteCommand(fmt.Sprintf(mountScratchCommand, mountPoint)); err != nil {
+		return scratch, fmt.Errorf("failed to mount scratch volume: %w", err)
+	}
+
+	env := maps.Clone(cfg.ScriptEnv)
+	if env == nil {
+		env = make(map[string]string, 1)
+	}
+	env[ScratchDirEnv] = mountPoint
+	cfg.ScriptEnv = env
+	slog.Info("Mounted scratch volume", "volume_id", volume.ID, "mount_point", mountPoint)
+	return scratch, nil
+}
+
+// removeScratchVolume detaches and deletes a scratch volume, unmounting it first when vmIP is set. Without
+// it the volume is pulled from under a VM that is about to be deleted.
+func (b *Builder) removeScratchVolume(ctx context.Context, cfg *types.Config, scratch *scratchVolume, vmIP string) error {
+	if vmIP != "" {
+		sshClient, err := b.dialVM(ctx, cfg, vmIP)
+		if err != nil {
+			return err
+		}
+		err = sshClient.ExecuteCommand(fmt.Sprintf("sync && sudo umount %[1]s && sudo rmdir %[1]s", scratch.mountPoint))
+		sshClient.Close()
+		if err != nil {
+			return fmt.Errorf("failed to unmount scratch volume: %w", err)
+		}
+	}
+
+	slog.Info("Removing scratch volume", "volume_id", scratch.id)
+	if err := b.API.DetachVolume(ctx, scratch.vmID, scratch.id); err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, volumeTimeout)
+	defer cancel()
+	if err := b.API.WaitForVolumeStatus(waitCtx, scratch.id, "available"); err != nil {
+		return fmt.Errorf("scratch volume failed to detach: %w", err)
+	}
+	if err := b.API.DeleteVolume(ctx, scratch.id); err != nil {
+		return fmt.Errorf("failed to delete scratch volume %d: %w", scratch.id, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxDebugBody caps how much of a request or response body --debug-http logs
+const maxDebugBody = 64 << 10
+
+// Logging of every API call, for bug reports against the API
+var (
+	debugHTTP   bool
+	debugBodies bool
+)
+
+// SetDebugHTTP logs the method, URL, headers, status and latency of every API call, and with bodies their
+// request and response bodies too. The API key is never logged.
+func SetDebugHTTP(enabled, bodies bool) {
+	debugHTTP, debugBodies = enabled || bodies, bodies
+}
+
+// parseDebugHTTP reads HYPERSTACK_BUILDER_DEBUG_HTTP: 1 or true to log API calls, bodies to include their
+// bodies, and empty, 0 or false not to
+func parseDebugHTTP(value string) error {
+	switch strings.ToLower(value) {
+	case "", "0", "false":
+		SetDebugHTTP(false, false)
+	case "1", "true":
+		SetDebugHTTP(true, false)
+	case "bodies":
+		SetDebugHTTP(true, true)
+	default:
+		return fmt.Errorf("HYPERSTACK_BUILDER_DEBUG_HTTP must be 1, bodies or 0, got %q", value)
+	}
+	return nil
+}
+
+// logCall logs an API call. The response body is read to log it and handed back in a copy.
+func logCall(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	attrs := []any{
+		"method", req.Method,
+		"url", req.URL.String(),
+		"duration_ms", elapsed.Milliseconds(),
+		"request_headers", debugHeaders(req.Header),
+	}
+	if debugBodies && req.GetBody != nil {
+		if body, bodyErr := req.GetBody(); bodyErr == nil {
+			data, _ := io.ReadAll(body)
+			attrs = append(attrs, "request_body", debugBody(data))
+		}
+	}
+	if err != nil {
+		slog.Info("HTTP call failed", append(attrs, "error", err)...)
+		return
+	}
+	attrs = append(attrs, "status", resp.StatusCode, "response_headers", debugHeaders(resp.Header))
+	if debugBodies {
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr == nil {
+			attrs = append(attrs, "response_body", debugBody(data))
+		}
+	}
+	slog.Info("HTTP call", attrs...)
+}
+
+// debugHeaders formats headers for the log with the API key and cookies redacted
+func debugHeaders(header http.Header) string {
+	var lines []string
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		switch strings.ToLower(name) {
+		case "api_key", "authorization", "cookie", "set-cookie":
+			value = "[REDACTED]"
+		}
+		lines = append(lines, name+": "+value)
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "; ")
+}
+
+// debugBody cuts a body short for the log
+func debugBody(data []byte) string {
+	if len(data) > maxDebugBody {
+		return string(data[:maxDebugBody]) + fmt.Sprintf("... (%d bytes)", len(data))
+	}
+	return string(data)
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Kinds of API failure, matched with errors.Is against the *APIError the client returns
+var (
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrNotFound         = errors.New("not found")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrFlavorOutOfStock = errors.New("flavor out of stock")
+)
+
+// The API tells quota and capacity failures apart only in its messages
+var (
+	quotaPhrases = []string{"quota", "limit exceeded"}
+	stockPhrases = []string{"out of stock", "insufficient capacity", "not enough capacity", "no available", "insufficient resources"}
+)
+
+// APIError is returned when the API refuses a request, with a non-success HTTP status or a response
+// whose status is false
+type APIError struct {
+	StatusCode int
+	Code       string // The API's reason for the error, if it gave one
+	Message    string
+	Body       string
+}
+
+// Error shows the API's message when the body carries one, rather than the raw body
+func (e *APIError) Error() string {
+	switch {
+	case e.StatusCode < 300 && e.Message != "":
+		return fmt.Sprintf("API returned error: %s", e.Message)
+	case e.Message != "":
+		return fmt.Sprintf("API request failed: status %d: %s", e.StatusCode, e.Message)
+	default:
+		return fmt.Sprintf("API request failed: status %d, body: %s", e.StatusCode, e.Body)
+	}
+}
+
+// Is matches the error against the kinds of failure above
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrQuotaExceeded:
+		return e.mentions(quotaPhrases...)
+	case ErrFlavorOutOfStock:
+		return e.mentions(stockPhrases...)
+	}
+	return false
+}
+
+func (e *APIError) mentions(phrases ...string) bool {
+	text := strings.ToLower(e.Code + " " + e.Message + " " + e.Body)
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIError reads the error out of a response the API refused
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	return apiErrorFrom(resp.StatusCode, body)
+}
+
+func apiErrorFrom(statusCode int, body []byte) *APIError {
+	e := &APIError{StatusCode: statusCode, Body: string(body)}
+	var fields struct {
+		Message     string `json:"message"`
+		ErrorReason string `json:"error_reason"`
+		Code        string `json:"code"`
+	}
+	if json.Unmarshal(body, &fields) == nil {
+		e.Message = fields.Message
+		e.Code = fields.ErrorReason
+		if e.Code == "" {
+			e.Code = fields.Code
+		}
+	}
+	return e
+}
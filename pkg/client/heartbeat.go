@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// heartbeatInterval is how often a wait reports progress while its status is unchanged
+const heartbeatInterval = time.Minute
+
+type expectedDurationKey struct{}
+
+// WithExpectedDuration annotates a wait with how long it typically takes, used to report an ETA
+func WithExpectedDuration(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, expectedDurationKey{}, d)
+}
+
+// heartbeat reports the progress of a long wait: elapsed time, remaining budget and an ETA.
+// It logs when the polled status changes and otherwise at most once per heartbeatInterval.
+type heartbeat struct {
+	msg       string
+	startedAt time.Time
+	expected  time.Duration
+	status    string
+	loggedAt  time.Time
+}
+
+func newHeartbeat(ctx context.Context, msg string) *heartbeat {
+	expected, _ := ctx.Value(expectedDurationKey{}).(time.Duration)
+	return &heartbeat{msg: msg, startedAt: time.Now(), expected: expected}
+}
+
+// tick logs progress if the status changed or the heartbeat interval has passed
+func (h *heartbeat) tick(ctx context.Context, status string, args ...any) {
+	now := time.Now()
+	if status == h.status && now.Sub(h.loggedAt) < heartbeatInterval {
+		return
+	}
+	h.status = status
+	h.loggedAt = now
+
+	elapsed := now.Sub(h.startedAt)
+	attrs := append([]any{"status", status, "elapsed", elapsed.Round(time.Second)}, args...)
+	if deadline, ok := ctx.Deadline(); ok {
+		attrs = append(attrs, "remaining", time.Until(deadline).Round(time.Second))
+	}
+	switch {
+	case h.expected == 0:
+		attrs = append(attrs, "eta", "unknown")
+	case elapsed < h.expected:
+		attrs = append(attrs, "eta", (h.expected - elapsed).Round(time.Second))
+	default:
+		attrs = append(attrs, "eta", "overdue", "typical", h.expected.Round(time.Second))
+	}
+	slog.Info(h.msg, attrs...)
+}
@@ -0,0 +1,971 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/audit"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metrics"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+const (
+	HyperstackAPIBase = "https://infrahub-api.nexgencloud.com/v1"
+	CanadaRegionID    = 2
+)
+
+// HyperstackClient wraps the Hyperstack API client
+type HyperstackClient struct {
+	APIKey  string
+	BaseURL string // HyperstackAPIBase by default
+	Client  *http.Client
+	// Audit, if set, records every API call
+	Audit *audit.Log
+}
+
+// New creates a new Hyperstack API client
+func New(apiKey string) *HyperstackClient {
+	return &HyperstackClient{
+		APIKey:  apiKey,
+		BaseURL: HyperstackAPIBase,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// makeRequest calls the API, waiting for the rate limiter first. A call the API throttles with 429 is
+// retried once the wait its Retry-After asks for has passed.
+func (c *HyperstackClient) makeRequest(ctx context.Context, method, endpoint string, body any) (*http.Response, error) {
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := rateLimitBackoff
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(jsonBody)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL()+endpoint, reqBody)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.send(req, method, endpoint)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, err
+		}
+		delay := retryAfter(resp, backoff)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		slog.Warn("API rate limit hit, backing off", "method", method, "endpoint", endpoint, "retry_in", delay)
+		limiter.pause(delay)
+		backoff = nextBackoff(backoff)
+	}
+}
+
+func (c *HyperstackClient) baseURL() string {
+	if c.BaseURL == "" {
+		return HyperstackAPIBase
+	}
+	return c.BaseURL
+}
+
+// send makes one API call, recording it in metrics, traces and the audit log, and logging it with --debug-http
+func (c *HyperstackClient) send(req *http.Request, method, endpoint string) (*http.Response, error) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", c.APIKey)
+
+	path := metricsEndpoint(endpoint)
+	span := tracing.Start(method+" "+path, tracing.String("http.request.method", method), tracing.String("url.path", endpoint))
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+	if err == nil {
+		span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.End(fmt.Errorf("status %d", resp.StatusCode))
+		}
+	}
+	span.End(err)
+	metrics.APIRequestDuration.Observe(time.Since(start).Seconds(), method, path)
+	if err != nil {
+		metrics.APIErrors.Inc(method, path, "network")
+	} else if resp.StatusCode >= 400 {
+		metrics.APIErrors.Inc(method, path, strconv.Itoa(resp.StatusCode))
+	}
+	if c.Audit != nil {
+		c.audit(method, endpoint, start, resp, err)
+	}
+	if debugHTTP {
+		logCall(req, resp, err, time.Since(start))
+	}
+	return resp, err
+}
+
+// audit records an API call, including the IDs of resources it touched
+func (c *HyperstackClient) audit(method, endpoint string, start time.Time, resp *http.Response, err error) {
+	entry := audit.Entry{
+		Time:       start.UTC(),
+		Method:     method,
+		Endpoint:   endpoint,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	for _, segment := range strings.Split(strings.SplitN(endpoint, "?", 2)[0], "/") {
+		if id, convErr := strconv.Atoi(segment); convErr == nil {
+			entry.ResourceIDs = append(entry.ResourceIDs, id)
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = resp.StatusCode
+		// Created resources are only known from the response, so buffer it and hand back a copy
+		if method != http.MethodGet {
+			body, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			if readErr == nil {
+				entry.ResourceIDs = append(entry.ResourceIDs, audit.ResponseIDs(body)...)
+			}
+		}
+	}
+	if err := c.Audit.Record(entry); err != nil {
+		slog.Warn("Failed to record API call in audit log", "error", err)
+	}
+}
+
+// metricsEndpoint drops the query and replaces numeric IDs so API metrics have a bounded set of endpoints
+func metricsEndpoint(endpoint string) string {
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint = endpoint[:i]
+	}
+	segments := strings.Split(endpoint, "/")
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// parseAPIResponse parses a generic Hyperstack API response
+func parseAPIResponse[T any](resp *http.Response, target *T) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return newAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// First check the status/message wrapper
+	var apiResp struct {
+		Status bool `json:"status"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse API response wrapper: %w", err)
+	}
+
+	if !apiResp.Status {
+		return apiErrorFrom(resp.StatusCode, body)
+	}
+
+	// Then unmarshal into the target structure
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("failed to parse response data: %w", err)
+	}
+
+	return nil
+}
+
+// CreateVM creates a new virtual machine
+func (c *HyperstackClient) CreateVM(ctx context.Context, config types.Config) (*types.VMCreateResponse, error) {
+	// Create SSH security rule, open to ssh_cidr or else anywhere
+	sshPort := 22
+	sshCIDR := config.SSHCIDR
+	if sshCIDR == "" {
+		sshCIDR = "0.0.0.0/0"
+	}
+	sshRule := types.SecurityRule{
+		Direction:      "ingress",
+		Protocol:       "tcp",
+		EtherType:      etherType(sshCIDR),
+		RemoteIPPrefix: sshCIDR,
+		PortRangeMin:   &sshPort,
+		PortRangeMax:   &sshPort,
+	}
+	rules := []types.SecurityRule{sshRule}
+	for _, rule := range config.SecurityRules {
+		if rule.Direction == "" {
+			rule.Direction = "ingress"
+		}
+		if rule.EtherType == "" {
+			rule.EtherType = etherType(rule.RemoteIPPrefix)
+		}
+		rules = append(rules, rule)
+	}
+
+	vmReq := types.VMCreateRequest{
+		Name:             config.VMName,
+		ImageName:        config.BaseImageName,
+		FlavorName:       config.FlavorName,
+		KeyName:          config.KeypairName,
+		EnvironmentName:  config.EnvironmentName,
+		Count:            1,
+		Labels:           config.Tags,
+		AssignFloatingIP: true,
+		SecurityRules:    rules,
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", "/core/virtual-machines", vmReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	var data types.VMCreateData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return &types.VMCreateResponse{Instances: data.Instances}, nil
+}
+
+// etherType returns the ether type of rules for a CIDR
+func etherType(cidr string) string {
+	if strings.Contains(cidr, ":") {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// WaitForVMReady waits until ctx is done for a VM to become ready and have a floating IP.
+// Transient API failures (5xx, maintenance) are logged and retried with backoff until the deadline.
+func (c *HyperstackClient) WaitForVMReady(ctx context.Context, vmID int) (string, error) {
+	delay := pollInterval
+	hb := newHeartbeat(ctx, "Waiting for VM")
+
+	for {
+		vm, err := c.GetVMDetails(ctx, vmID)
+		if err != nil {
+			if !isTransient(err) {
+				return "", err
+			}
+			slog.Warn("API degraded while waiting for VM, retrying", "vm_id", vmID, "retry_in", delay, "error", err)
+			if err := sleep(ctx, delay); err != nil {
+				return "", fmt.Errorf("VM did not become ready with floating IP within timeout: %w", err)
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		delay = pollInterval
+
+		// Check for ACTIVE status and floating IP attached
+		if vm.Status == "ACTIVE" && vm.FloatingIP != "" && vm.FloatingIPStatus == "ATTACHED" {
+			slog.Info("VM is ready", "vm_id", vmID, "floating_ip", vm.FloatingIP)
+			return vm.FloatingIP, nil
+		}
+
+		status := vm.Status
+		if vm.FloatingIPStatus != "" {
+			status += ", floating IP " + vm.FloatingIPStatus
+		}
+		hb.tick(ctx, status, "vm_id", vmID, "floating_ip", vm.FloatingIP)
+		if err := sleep(ctx, delay); err != nil {
+			return "", fmt.Errorf("VM did not become ready with floating IP within timeout: %w", err)
+		}
+	}
+}
+
+// GetVMDetails gets detailed information about a VM including IP address
+func (c *HyperstackClient) GetVMDetails(ctx context.Context, vmID int) (*types.VMInstance, error) {
+	resp, err := c.makeRequest(ctx, "GET", fmt.Sprintf("/core/virtual-machines/%d", vmID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM details: %w", err)
+	}
+
+	var data types.VMDetailData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return &data.Instance, nil
+}
+
+// WaitForVMStatus waits until ctx is done for a VM to reach status, such as SHUTOFF after StopVM.
+// Transient API failures are logged and retried with backoff until the deadline.
+func (c *HyperstackClient) WaitForVMStatus(ctx context.Context, vmID int, status string) error {
+	delay := pollInterval
+	hb := newHeartbeat(ctx, "Waiting for VM")
+
+	for {
+		vm, err := c.GetVMDetails(ctx, vmID)
+		if err != nil {
+			if !isTransient(err) {
+				return err
+			}
+			slog.Warn("API degraded while waiting for VM, retrying", "vm_id", vmID, "retry_in", delay, "error", err)
+			if err := sleep(ctx, delay); err != nil {
+				return fmt.Errorf("VM did not become %s within timeout: %w", status, err)
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		delay = pollInterval
+
+		switch vm.Status {
+		case status:
+			return nil
+		case "ERROR":
+			return fmt.Errorf("VM %d is in ERROR state", vmID)
+		}
+
+		hb.tick(ctx, vm.Status, "vm_id", vmID)
+		if err := sleep(ctx, delay); err != nil {
+			return fmt.Errorf("VM did not become %s within timeout: %w", status, err)
+		}
+	}
+}
+
+// StopVM shuts a virtual machine down
+func (c *HyperstackClient) StopVM(ctx context.Context, vmID int) error {
+	return c.vmAction(ctx, vmID, "stop")
+}
+
+// StartVM starts a stopped virtual machine
+func (c *HyperstackClient) StartVM(ctx context.Context, vmID int) error {
+	return c.vmAction(ctx, vmID, "start")
+}
+
+// HardRebootVM power-cycles a virtual machine, for one that no longer responds
+func (c *HyperstackClient) HardRebootVM(ctx context.Context, vmID int) error {
+	return c.vmAction(ctx, vmID, "hard-reboot")
+}
+
+// ShelveVM shelves a virtual machine, which Hyperstack calls hibernating: its GPUs are released, so it is
+// no longer billed for them, and its disk is kept until it is unshelved
+func (c *HyperstackClient) ShelveVM(ctx context.Context, vmID int) error {
+	return c.vmAction(ctx, vmID, "hibernate")
+}
+
+// UnshelveVM restores a shelved virtual machine
+func (c *HyperstackClient) UnshelveVM(ctx context.Context, vmID int) error {
+	return c.vmAction(ctx, vmID, "hibernate-restore")
+}
+
+// vmAction runs a power action, such as stop or hard-reboot, on a virtual machine
+func (c *HyperstackClient) vmAction(ctx context.Context, vmID int, action string) error {
+	resp, err := c.makeRequest(ctx, "GET", fmt.Sprintf("/core/virtual-machines/%d/%s", vmID, action), nil)
+	if err != nil {
+		return fmt.Errorf("failed to %s VM: %w", action, err)
+	}
+
+	var data struct{}
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return fmt.Errorf("failed to %s VM: %w", action, err)
+	}
+
+	return nil
+}
+
+// DetachFloatingIP releases the floating IP attached to a virtual machine
+func (c *HyperstackClient) DetachFloatingIP(ctx context.Context, vmID int) error {
+	resp, err := c.makeRequest(ctx, "POST", fmt.Sprintf("/core/virtual-machines/%d/detach-floatingip", vmID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to detach floating IP: %w", err)
+	}
+
+	var data struct{}
+	return parseAPIResponse(resp, &data)
+}
+
+// ListVMs lists virtual machines in the account
+func (c *HyperstackClient) ListVMs(ctx context.Context) ([]types.VMInstance, error) {
+	return listPages(ctx, c, "VMs", "/core/virtual-machines", nil, func(data *types.VMListData) []types.VMInstance {
+		return data.Instances
+	}, func(vm types.VMInstance) string { return strconv.Itoa(vm.ID) })
+}
+
+// CreateSnapshot creates a snapshot of a VM
+func (c *HyperstackClient) CreateSnapshot(ctx context.Context, vmID int, snapshotName string, labels []string) (*types.Snapshot, error) {
+	snapReq := types.SnapshotCreateRequest{
+		Name:        snapshotName,
+		Description: fmt.Sprintf("Snapshot of VM %d for image building", vmID),
+		Labels:      labels,
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", fmt.Sprintf("/core/virtual-machines/%d/snapshots", vmID), snapReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create snapshot: %w", newAPIError(resp))
+	}
+
+	var snapshotResp types.SnapshotCreateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&snapshotResp); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot response: %w", err)
+	}
+
+	return &snapshotResp.Snapshot, nil
+}
+
+// GetSnapshot fetches the current state of a snapshot
+func (c *HyperstackClient) GetSnapshot(ctx context.Context, snapshotID int) (*types.Snapshot, error) {
+	resp, err := c.makeRequest(ctx, "GET", fmt.Sprintf("/core/snapshots/%d", snapshotID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var snapshotResp types.SnapshotDetailResponse
+	if err := json.NewDecoder(resp.Body).Decode(&snapshotResp); err != nil {
+		return nil, err
+	}
+
+	return &snapshotResp.Snapshot, nil
+}
+
+// WaitForSnapshotReady waits until ctx is done for a snapshot to become ready.
+// Transient API failures (5xx, maintenance) are logged and retried with backoff until the deadline.
+func (c *HyperstackClient) WaitForSnapshotReady(ctx context.Context, snapshotID int) error {
+	delay := pollInterval
+	hb := newHeartbeat(ctx, "Waiting for snapshot")
+
+	for {
+		snapshot, err := c.GetSnapshot(ctx, snapshotID)
+		if err != nil {
+			if !isTransient(err) {
+				return err
+			}
+			slog.Warn("API degraded while waiting for snapshot, retrying", "snapshot_id", snapshotID, "retry_in", delay, "error", err)
+			if err := sleep(ctx, delay); err != nil {
+				return fmt.Errorf("snapshot did not become ready within timeout: %w", err)
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		delay = pollInterval
+
+		if snapshot.Status == "SUCCESS" {
+			return nil
+		}
+
+		hb.tick(ctx, snapshot.Status, "snapshot_id", snapshotID)
+		if err := sleep(ctx, delay); err != nil {
+			return fmt.Errorf("snapshot did not become ready within timeout: %w", err)
+		}
+	}
+}
+
+// ListSnapshots lists snapshots in the account
+func (c *HyperstackClient) ListSnapshots(ctx context.Context) ([]types.Snapshot, error) {
+	return listPages(ctx, c, "snapshots", "/core/snapshots", nil, func(data *types.SnapshotListResponse) []types.Snapshot {
+		return data.Snapshots
+	}, func(snapshot types.Snapshot) string { return strconv.Itoa(snapshot.ID) })
+}
+
+// CreateImageFromSnapshot creates an image from a snapshot
+func (c *HyperstackClient) CreateImageFromSnapshot(ctx context.Context, snapshotID int, imageName string, labels []string) (*types.Image, error) {
+	imgReq := types.ImageCreateRequest{
+		Name:   imageName,
+		Labels: labels,
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", fmt.Sprintf("/core/snapshots/%d/image", snapshotID), imgReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+
+	var imageResp types.ImageDetailData
+	if err := parseAPIResponse(resp, &imageResp); err != nil {
+		return nil, err
+	}
+
+	return &imageResp.Image, nil
+}
+
+// DeleteVM deletes a virtual machine
+func (c *HyperstackClient) DeleteVM(ctx context.Context, vmID int) error {
+	resp, err := c.makeRequest(ctx, "DELETE", fmt.Sprintf("/core/virtual-machines/%d", vmID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete VM: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// GetImage finds an image by ID
+func (c *HyperstackClient) GetImage(ctx context.Context, imageID int) (*types.Image, error) {
+	images, err := c.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		if images[i].ID == imageID {
+			return &images[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("image %d %w", imageID, ErrNotFound)
+}
+
+// UpdateImage replaces the name and labels of an existing image
+func (c *HyperstackClient) UpdateImage(ctx context.Context, imageID int, imageName string, labels []string) (*types.Image, error) {
+	updReq := types.ImageUpdateRequest{
+		Name:   imageName,
+		Labels: labels,
+	}
+
+	resp, err := c.makeRequest(ctx, "PUT", fmt.Sprintf("/core/images/%d", imageID), updReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update image: %w", err)
+	}
+
+	var imageResp types.ImageDetailData
+	if err := parseAPIResponse(resp, &imageResp); err != nil {
+		return nil, err
+	}
+
+	return &imageResp.Image, nil
+}
+
+// WaitForImageReady waits until ctx is done for a newly created image to be listed by the API
+func (c *HyperstackClient) WaitForImageReady(ctx context.Context, imageID int) error {
+	delay := pollInterval
+	hb := newHeartbeat(ctx, "Waiting for image")
+
+	for {
+		_, err := c.GetImage(ctx, imageID)
+		if err == nil {
+			return nil
+		}
+		switch {
+		case ctx.Err() != nil:
+			return fmt.Errorf("image did not become ready within timeout: %w", ctx.Err())
+		case isTransient(err):
+			slog.Warn("API degraded while waiting for image, retrying", "image_id", imageID, "retry_in", delay, "error", err)
+			delay = nextBackoff(delay)
+		case errors.Is(err, ErrNotFound):
+			hb.tick(ctx, "not listed", "image_id", imageID)
+			delay = pollInterval
+		default:
+			// Such as a rejected API key, which waiting won't fix
+			return fmt.Errorf("failed to wait for image: %w", err)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return fmt.Errorf("image did not become ready within timeout: %w", err)
+		}
+	}
+}
+
+// DeleteImage deletes an image
+func (c *HyperstackClient) DeleteImage(ctx context.Context, imageID int) error {
+	resp, err := c.makeRequest(ctx, "DELETE", fmt.Sprintf("/core/images/%d", imageID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete image: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// DeleteSnapshot deletes a snapshot
+func (c *HyperstackClient) DeleteSnapshot(ctx context.Context, snapshotID int) error {
+	resp, err := c.makeRequest(ctx, "DELETE", fmt.Sprintf("/core/snapshots/%d", snapshotID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete snapshot: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// CreateVolume creates a volume of sizeGB in an environment
+func (c *HyperstackClient) CreateVolume(ctx context.Context, name, environmentName string, sizeGB int, volumeType string) (*types.Volume, error) {
+	volReq := types.VolumeCreateRequest{
+		Name:            name,
+		EnvironmentName: environmentName,
+		Size:            sizeGB,
+		VolumeType:      volumeType,
+		Description:     "Scratch volume for image building",
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", "/core/volumes", volReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume: %w", err)
+	}
+
+	var data types.VolumeData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, fmt.Errorf("failed to create volume: %w", err)
+	}
+
+	return &data.Volume, nil
+}
+
+// GetVolume fetches the current state of a volume
+func (c *HyperstackClient) GetVolume(ctx context.Context, volumeID int) (*types.Volume, error) {
+	resp, err := c.makeRequest(ctx, "GET", fmt.Sprintf("/core/volumes/%d", volumeID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var data types.VolumeData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return &data.Volume, nil
+}
+
+// WaitForVolumeStatus waits until ctx is done for a volume to reach status, such as available or in-use.
+// Transient API failures are logged and retried with backoff until the deadline.
+func (c *HyperstackClient) WaitForVolumeStatus(ctx context.Context, volumeID int, status string) error {
+	delay := pollInterval
+	hb := newHeartbeat(ctx, "Waiting for volume")
+
+	for {
+		volume, err := c.GetVolume(ctx, volumeID)
+		if err != nil {
+			if !isTransient(err) {
+				return err
+			}
+			slog.Warn("API degraded while waiting for volume, retrying", "volume_id", volumeID, "retry_in", delay, "error", err)
+			if err := sleep(ctx, delay); err != nil {
+				return fmt.Errorf("volume did not become %s within timeout: %w", status, err)
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		delay = pollInterval
+
+		switch strings.ToLower(volume.Status) {
+		case status:
+			return nil
+		case "error", "error_deleting", "error_extending":
+			return fmt.Errorf("volume %d is %s", volumeID, volume.Status)
+		}
+
+		hb.tick(ctx, volume.Status, "volume_id", volumeID)
+		if err := sleep(ctx, delay); err != nil {
+			return fmt.Errorf("volume did not become %s within timeout: %w", status, err)
+		}
+	}
+}
+
+// AttachVolume attaches a volume to a virtual machine
+func (c *HyperstackClient) AttachVolume(ctx context.Context, vmID, volumeID int) error {
+	attachReq := types.VolumeAttachRequest{VolumeIDs: []int{volumeID}}
+
+	resp, err := c.makeRequest(ctx, "POST", fmt.Sprintf("/core/virtual-machines/%d/attach-volumes", vmID), attachReq)
+	if err != nil {
+		return fmt.Errorf("failed to attach volume: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to attach volume: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// DetachVolume detaches a volume from a virtual machine
+func (c *HyperstackClient) DetachVolume(ctx context.Context, vmID, volumeID int) error {
+	detachReq := types.VolumeAttachRequest{VolumeIDs: []int{volumeID}}
+
+	resp, err := c.makeRequest(ctx, "POST", fmt.Sprintf("/core/virtual-machines/%d/detach-volumes", vmID), detachReq)
+	if err != nil {
+		return fmt.Errorf("failed to detach volume: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to detach volume: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// DeleteVolume deletes a volume, which must not be attached
+func (c *HyperstackClient) DeleteVolume(ctx context.Context, volumeID int) error {
+	resp, err := c.makeRequest(ctx, "DELETE", fmt.Sprintf("/core/volumes/%d", volumeID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete volume: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// ListImages lists available images
+func (c *HyperstackClient) ListImages(ctx context.Context) ([]types.Image, error) {
+	return c.ListImagesInRegion(ctx, "")
+}
+
+// ListImagesInRegion lists the images available in a region, or in every region if region is empty
+func (c *HyperstackClient) ListImagesInRegion(ctx context.Context, region string) ([]types.Image, error) {
+	// Flatten the grouped images into a single array
+	images, err := listPages(ctx, c, "images", "/core/images", regionQuery(region), func(data *types.ImagesData) []types.Image {
+		var images []types.Image
+		for _, group := range data.Images {
+			images = append(images, group.Images...)
+		}
+		return images
+	}, func(image types.Image) string { return strconv.Itoa(image.ID) })
+	if err != nil || region == "" {
+		return images, err
+	}
+	// The filter is checked here too, in case the API ignored it
+	var inRegion []types.Image
+	for _, image := range images {
+		if image.RegionName == region {
+			inRegion = append(inRegion, image)
+		}
+	}
+	return inRegion, nil
+}
+
+// ListRegions lists available regions
+func (c *HyperstackClient) ListRegions(ctx context.Context) ([]types.Region, error) {
+	resp, err := c.makeRequest(ctx, "GET", "/core/regions", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list regions: %w", err)
+	}
+
+	var data types.RegionsData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Regions, nil
+}
+
+// ListFlavors lists available VM flavors
+func (c *HyperstackClient) ListFlavors(ctx context.Context) ([]types.Flavor, error) {
+	return c.ListFlavorsInRegion(ctx, "")
+}
+
+// ListFlavorsInRegion lists the flavors available in a region, or in every region if region is empty
+func (c *HyperstackClient) ListFlavorsInRegion(ctx context.Context, region string) ([]types.Flavor, error) {
+	// Flatten the grouped flavors into a single array
+	flavors, err := listPages(ctx, c, "flavors", "/core/flavors", regionQuery(region), func(data *types.FlavorsData) []types.Flavor {
+		var flavors []types.Flavor
+		for _, group := range data.Data {
+			flavors = append(flavors, group.Flavors...)
+		}
+		return flavors
+	}, func(flavor types.Flavor) string { return flavor.RegionName + "/" + flavor.Name })
+	if err != nil || region == "" {
+		return flavors, err
+	}
+	// The filter is checked here too, in case the API ignored it
+	var inRegion []types.Flavor
+	for _, flavor := range flavors {
+		if flavor.RegionName == region {
+			inRegion = append(inRegion, flavor)
+		}
+	}
+	return inRegion, nil
+}
+
+// ListKeypairs lists available SSH keypairs
+func (c *HyperstackClient) ListKeypairs(ctx context.Context) ([]types.Keypair, error) {
+	return listPages(ctx, c, "keypairs", "/core/keypairs", nil, func(data *types.KeypairsData) []types.Keypair {
+		return data.Keypairs
+	}, func(keypair types.Keypair) string { return strconv.Itoa(keypair.ID) })
+}
+
+// ImportKeypair imports an SSH public key as a keypair in an environment
+func (c *HyperstackClient) ImportKeypair(ctx context.Context, name, environmentName, publicKey string) (*types.Keypair, error) {
+	keyReq := types.KeypairImportRequest{
+		Name:            name,
+		EnvironmentName: environmentName,
+		PublicKey:       publicKey,
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", "/core/keypairs", keyReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import keypair: %w", err)
+	}
+
+	var data types.KeypairData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, fmt.Errorf("failed to import keypair: %w", err)
+	}
+
+	return &data.Keypair, nil
+}
+
+// DeleteKeypair deletes a keypair
+func (c *HyperstackClient) DeleteKeypair(ctx context.Context, keypairID int) error {
+	resp, err := c.makeRequest(ctx, "DELETE", fmt.Sprintf("/core/keypairs/%d", keypairID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete keypair: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// ListStocks lists the GPU capacity of each region
+func (c *HyperstackClient) ListStocks(ctx context.Context) ([]types.Stock, error) {
+	resp, err := c.makeRequest(ctx, "GET", "/core/stocks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock: %w", err)
+	}
+
+	var data types.StocksData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Stocks, nil
+}
+
+// ListQuotas lists the quotas of the organization with their usage
+func (c *HyperstackClient) ListQuotas(ctx context.Context) ([]types.Quota, error) {
+	resp, err := c.makeRequest(ctx, "GET", "/core/organizations/quotas", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quotas: %w", err)
+	}
+
+	var data types.QuotasData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Quotas, nil
+}
+
+// ListEnvironments lists available environments
+func (c *HyperstackClient) ListEnvironments(ctx context.Context) ([]types.Environment, error) {
+	resp, err := c.makeRequest(ctx, "GET", "/core/environments", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	var data types.EnvironmentsData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Environments, nil
+}
+
+// CreateEnvironment creates an environment in a region
+func (c *HyperstackClient) CreateEnvironment(ctx context.Context, name, region string) (*types.Environment, error) {
+	envReq := types.EnvironmentCreateRequest{
+		Name:   name,
+		Region: region,
+	}
+
+	resp, err := c.makeRequest(ctx, "POST", "/core/environments", envReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	var data types.EnvironmentData
+	if err := parseAPIResponse(resp, &data); err != nil {
+		return nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	return &data.Environment, nil
+}
+
+// pageSize is how many items a list call asks the API for at a time
+const pageSize = 100
+
+// listPages fetches every page of a list endpoint. items reads the items out of one page and key tells
+// them apart. Listing stops at a short page, or at a page with nothing new on it, as endpoints that don't
+// page return everything every time.
+func listPages[D, T any](ctx context.Context, c *HyperstackClient, what, endpoint string, query url.Values, items func(*D) []T, key func(T) string) ([]T, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	seen := make(map[string]bool)
+	var all []T
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("pageSize", strconv.Itoa(pageSize))
+		resp, err := c.makeRequest(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", what, err)
+		}
+
+		var data D
+		if err := parseAPIResponse(resp, &data); err != nil {
+			return nil, err
+		}
+		pageItems := items(&data)
+		added := 0
+		for _, item := range pageItems {
+			if k := key(item); !seen[k] {
+				seen[k] = true
+				all = append(all, item)
+				added++
+			}
+		}
+		if len(pageItems) < pageSize || added == 0 {
+			return all, nil
+		}
+	}
+}
+
+// regionQuery filters a list call to a region, if one is given
+func regionQuery(region string) url.Values {
+	query := url.Values{}
+	if region != "" {
+		query.Set("region", region)
+	}
+	return query
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimit is how many API calls a second a builder process makes at most
+	DefaultRateLimit = 5.0
+
+	// maxRateLimitRetries is how often a call the API throttled with 429 is retried before giving up
+	maxRateLimitRetries = 6
+	// rateLimitBackoff is the first wait after a 429 without Retry-After; it doubles with every retry
+	rateLimitBackoff = 2 * time.Second
+	// maxRetryAfter caps the wait a Retry-After header asks for
+	maxRetryAfter = 5 * time.Minute
+)
+
+// The API throttles per account, so all clients of the process share one limiter
+var limiter = newRateLimiter(DefaultRateLimit)
+
+// SetupFromEnv sets the rate limit from HYPERSTACK_BUILDER_API_RATE, in calls per second (0 turns it off),
+// and the logging of API calls from HYPERSTACK_BUILDER_DEBUG_HTTP
+func SetupFromEnv() error {
+	if err := parseDebugHTTP(os.Getenv("HYPERSTACK_BUILDER_DEBUG_HTTP")); err != nil {
+		return err
+	}
+	value := os.Getenv("HYPERSTACK_BUILDER_API_RATE")
+	if value == "" {
+		return nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return fmt.Errorf("HYPERSTACK_BUILDER_API_RATE must be a number of calls per second, got %q", value)
+	}
+	SetRateLimit(rate)
+	return nil
+}
+
+// SetRateLimit sets how many API calls a second the process makes at most; 0 turns limiting off
+func SetRateLimit(perSecond float64) {
+	limiter.set(perSecond)
+}
+
+// RateLimit returns the API calls a second the process makes at most, 0 if unlimited
+func RateLimit() float64 {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return limiter.rate
+}
+
+// rateLimiter spaces calls evenly at its rate, letting up to a second's worth through at once after a
+// quiet spell
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	interval time.Duration
+	burst    int
+	next     time.Time // When the next call may be made
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	l := &rateLimiter{}
+	l.set(perSecond)
+	return l
+}
+
+func (l *rateLimiter) set(perSecond float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.interval, l.burst = perSecond, 0, 1
+	if perSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+		l.burst = max(1, int(perSecond))
+	}
+}
+
+// wait blocks until a call may be made, or until ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.interval == 0 && !l.next.After(now) {
+		l.mu.Unlock()
+		return nil
+	}
+	// Slots left unused while calls were quiet make up the burst
+	if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		return sleep(ctx, d)
+	}
+	return nil
+}
+
+// pause holds back every call for d, after the API throttled one
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); l.next.Before(until) {
+		l.next = until
+	}
+}
+
+// retryAfter returns how long a 429 response asks to wait, in seconds or as a date, or fallback if it
+// doesn't say
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return fallback
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		d = time.Until(at)
+	} else {
+		return fallback
+	}
+	return min(max(d, 0), maxRetryAfter)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	pollInterval   = 10 * time.Second
+	maxPollBackoff = 2 * time.Minute
+)
+
+// isTransient reports whether a polling error is likely to clear on its own,
+// such as 5xx responses, throttling, maintenance pages or network failures
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || errors.Is(apiErr, ErrRateLimited) || apiErr.mentions("maintenance")
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "maintenance")
+}
+
+// nextBackoff doubles the polling delay while the API is degraded, capped at maxPollBackoff
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > maxPollBackoff {
+		return maxPollBackoff
+	}
+	return next
+}
+
+// sleep waits for d or until ctx is done, returning the context error in the latter case
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
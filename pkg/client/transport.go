@@ -0,0 +1,62 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Configure sets how the client reaches the API: its base URL, the timeout of each request, a proxy and
+// a CA bundle trusted on top of the system's. Empty fields keep the defaults, under which proxies come
+// from HTTPS_PROXY and NO_PROXY.
+func (c *HyperstackClient) Configure(api types.APIConfig) error {
+	if api.BaseURL != "" {
+		u, err := url.Parse(api.BaseURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid API base URL %q: must be an http or https URL", api.BaseURL)
+		}
+		c.BaseURL = strings.TrimSuffix(api.BaseURL, "/")
+	}
+	if api.Timeout != "" {
+		d, err := time.ParseDuration(api.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid API timeout %q: must be a positive duration such as 60s", api.Timeout)
+		}
+		c.Client.Timeout = d
+	}
+	if api.Proxy == "" && api.CABundle == "" {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if api.Proxy != "" {
+		proxy, err := url.Parse(api.Proxy)
+		if err != nil || proxy.Host == "" {
+			return fmt.Errorf("invalid API proxy %q: must be a URL such as http://proxy.example.com:3128", api.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if api.CABundle != "" {
+		pem, err := os.ReadFile(api.CABundle)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA bundle %s holds no PEM certificates", api.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	c.Client.Transport = transport
+	return nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// AgeSuffix ends the name of a config encrypted as a whole with age, e.g. config.yaml.age
+const AgeSuffix = ".age"
+
+// ageHeaders start an age-encrypted file, in binary or armored form
+var ageHeaders = [][]byte{[]byte("age-encryption.org/v1\n"), []byte("-----BEGIN AGE ENCRYPTED FILE-----")}
+
+// readConfigFile reads a config file, decrypting it in memory if it is encrypted with SOPS or age
+func readConfigFile(filename, format string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isAge(data):
+		return decryptAge(filename)
+	case isSOPS(data, format):
+		return decryptSOPS(filename, format)
+	}
+	return data, nil
+}
+
+// Encrypted reports whether a config file is encrypted with SOPS or age
+func Encrypted(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	return isAge(data) || isSOPS(data, FormatOf(filename)), nil
+}
+
+func isAge(data []byte) bool {
+	for _, header := range ageHeaders {
+		if bytes.HasPrefix(bytes.TrimSpace(data), header) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSOPS reports whether a document carries the sops metadata SOPS adds when it encrypts a file
+func isSOPS(data []byte, format string) bool {
+	data, err := toJSON(data, format)
+	if err != nil {
+		return false
+	}
+	var doc struct {
+		SOPS *struct {
+			MAC string `json:"mac"`
+		} `json:"sops"`
+	}
+	return json.Unmarshal(data, &doc) == nil && doc.SOPS != nil && doc.SOPS.MAC != ""
+}
+
+// decryptSOPS decrypts a config with the sops CLI, which finds its keys (age, PGP or a cloud KMS) the usual way
+func decryptSOPS(filename, format string) ([]byte, error) {
+	return runDecrypt(filename, "sops", "--decrypt", "--input-type", format, "--output-type", format, filename)
+}
+
+// decryptAge decrypts a config with the age CLI, using the identity file in HYPERSTACK_AGE_IDENTITY, or
+// SOPS_AGE_KEY_FILE, or the one SOPS uses by default
+func decryptAge(filename string) ([]byte, error) {
+	identity := os.Getenv("HYPERSTACK_AGE_IDENTITY")
+	if identity == "" {
+		identity = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+	if identity == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("no age identity for %s, set HYPERSTACK_AGE_IDENTITY: %w", filename, err)
+		}
+		identity = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	return runDecrypt(filename, "age", "--decrypt", "--identity", identity, filename)
+}
+
+// runDecrypt runs a decryption command and returns what it prints, without writing the plaintext anywhere
+func runDecrypt(filename, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if cmd.Err != nil {
+		return nil, fmt.Errorf("%s is encrypted, but %s was not found in PATH: %w", filename, name, cmd.Err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s with %s: %w: %s", filename, name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
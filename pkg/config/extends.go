@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProfilesDir is the directory, beside a config, that an extends value without a file extension names a
+// profile in
+const ProfilesDir = "profiles"
+
+// readDocument reads a config file as a JSON document, with the config it extends, and so on up the chain,
+// laid under it. chain lists the files already being read, to catch a config that ends up extending itself.
+func readDocument(filename, format string, chain []string) (map[string]any, error) {
+	data, err := readConfigFile(filename, format)
+	if err != nil {
+		return nil, err
+	}
+	data, err = toJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	value, ok := doc["extends"]
+	if !ok {
+		return doc, nil
+	}
+	name, ok := value.(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("extends must name a config file or profile")
+	}
+	base, err := extendsPath(filename, name)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, _ := filepath.Abs(filename)
+	chain = append(chain, abs)
+	if baseAbs, _ := filepath.Abs(base); contains(chain, baseAbs) {
+		return nil, fmt.Errorf("extends cycle: %s -> %s", strings.Join(chain, " -> "), baseAbs)
+	}
+	baseDoc, err := readDocument(base, FormatOf(base), chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s, extended by %s: %w", base, filename, err)
+	}
+
+	delete(doc, "extends")
+	return overlay(baseDoc, doc), nil
+}
+
+// extendsPath resolves the extends value of the config at filename. A path is relative to the config; a
+// bare name such as "gpu-node" is a profile in the profiles directory beside it, in YAML or JSON; a URL is
+// fetched.
+func extendsPath(filename, name string) (string, error) {
+	if IsRemote(name) {
+		return Fetch(name)
+	}
+	dir := filepath.Dir(filename)
+	if filepath.Ext(name) != "" || strings.ContainsRune(name, filepath.Separator) {
+		if filepath.IsAbs(name) {
+			return name, nil
+		}
+		return filepath.Join(dir, name), nil
+	}
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		path := filepath.Join(dir, ProfilesDir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("profile %s not found in %s", name, filepath.Join(dir, ProfilesDir))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
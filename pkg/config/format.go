@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Config file formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// FormatOf returns the format of a config file from its extension: YAML for .yaml and .yml, JSON otherwise.
+// An .age suffix is ignored.
+func FormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, AgeSuffix))) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+// CheckFormat rejects a format other than FormatJSON and FormatYAML
+func CheckFormat(format string) error {
+	if format != FormatJSON && format != FormatYAML {
+		return fmt.Errorf("unknown config format %q, expected %s or %s", format, FormatJSON, FormatYAML)
+	}
+	return nil
+}
+
+// Decode parses a config in the given format. YAML is converted to JSON first, so both formats use the same
+// field names.
+func Decode(data []byte, format string) (*types.Config, error) {
+	data, err := toJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var config types.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// toJSON converts a config document in the given format to JSON
+func toJSON(data []byte, format string) ([]byte, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	if format == FormatJSON {
+		return data, nil
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("config is empty")
+	}
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("config is not a mapping of strings: %w", err)
+	}
+	return converted, nil
+}
+
+// Encode writes a config in the given format. YAML keeps the JSON field order and explains each top-level
+// field in a comment, so a generated config can be read without the README.
+func Encode(config *types.Config, format string) ([]byte, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil || format == FormatJSON {
+		return data, err
+	}
+
+	// JSON is valid YAML, so decoding it into a node keeps the field order
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	resetStyle(&doc)
+	if len(doc.Content) > 0 {
+		root := doc.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if comment, ok := fieldComments[root.Content[i].Value]; ok {
+				root.Content[i].HeadComment = comment
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resetStyle drops the flow style and quoting that nodes decoded from JSON carry, so they are written as
+// block YAML
+func resetStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		resetStyle(child)
+	}
+}
+
+// fieldComments explain the top-level config fields in generated YAML
+var fieldComments = map[string]string{
+	"config_version":     "Schema version of this file; upgrade older files with `config migrate`",
+	"region":             "Hyperstack region to build in, e.g. CANADA-1",
+	"image_name":         "Image family; images are named <image_name>_<image_version>",
+	"image_version":      "Version of this build, or \"auto\" for the next one (see version_scheme)",
+	"base_image_name":    "Image the build VM boots from",
+	"vm_name":            "Name prefix of the temporary build VM",
+	"flavor_name":        "VM flavor (GPU instance type) to build on",
+	"keypair_name":       "Hyperstack SSH keypair the build VM is created with",
+	"private_key_path":   "Private key of that keypair, used to provision the VM over SSH",
+	"public_key_path":    "Public key imported as keypair_name when the environment has no such keypair",
+	"environment_name":   "Hyperstack environment the build VM is created in",
+	"ensure_environment": "Create environment_name, or default-<REGION> when it is left out, if it doesn't exist",
+	"tags":               "Labels added to the build VM and the image",
+	"hourly_cost":        "Price of the flavor per hour, for cost estimates and max_build_cost",
+	"max_build_minutes":  "Abort the build and delete its VM after this many minutes",
+	"max_build_cost":     "Abort once the build VM has cost this much at hourly_cost",
+	"resource_ttl":       "Lifetime stamped on build VMs and snapshots, e.g. 12h",
+	"version_scheme":     "Scheme for \"auto\" versions: calver, semver or counter",
+	"keep_vm_on_failure": "Leave the build VM running when the build fails",
+	"shelve_kept_vm":     "Shelve the kept VM so it isn't billed for its GPUs",
+	"skip_snapshot":      "Stop after provisioning without creating a snapshot or image",
+	"stop_for_snapshot":  "Shut the build VM down before the snapshot so its filesystems are consistent",
+	"reboot_unreachable": "Hard-reboot the build VM once if SSH can't reach it for provisioning",
+	"max_parallel":       "Build VMs this host runs at once; the rest are queued",
+	"ssh_cidr":           "CIDR allowed to SSH to build VMs, or auto for the builder's public IP; anywhere by default",
+	"security_rules":     "Further firewall rules of build VMs",
+	"api":                "How the Hyperstack API is reached: base URL, request timeout, proxy and CA bundle",
+	"scratch_volume":     "Volume mounted on the build VM for the scripts, removed before the snapshot",
+	"launch_test":        "Boot a VM from the new image and validate it",
+	"join_test":          "Join a VM from the new image to a Kubernetes cluster",
+	"stages":             "Pipeline stages, each building on the previous stage's image",
+	"timeouts":           "Deadlines of the build and its phases",
+	"regions":            "Build the image in each of these regions at once",
+	"replicas":           "Per-region overrides for replicas and regional builds",
+	"matrix":             "Build every combination of these base images, flavors and driver versions",
+	"naming_policy":      "Rules image names and tags must follow",
+	"retention":          "How many versions of each image name to keep",
+	"notifications":      "Where build outcomes and lifecycle events are sent",
+	"compliance":         "Benchmark run on the build VM after provisioning",
+	"script_env":         "Environment variables set for every provisioning script",
+	"provisioners":       "Scripts from the scripts directory, run in order; disabled ones are skipped",
+	"files":              "Files from the files directory copied onto the VM after the scripts",
+}
@@ -2,27 +2,29 @@ package config
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/client"
-	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/types"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
 )
 
+// stdin is shared by prompts, so input read ahead by one is left for the next
+var stdin = bufio.NewReader(os.Stdin)
+
 // PromptUser prompts the user for input with an optional default value
 func PromptUser(prompt string, defaultValue string) string {
-	reader := bufio.NewReader(os.Stdin)
 	if defaultValue != "" {
 		fmt.Printf("%s [%s]: ", prompt, defaultValue)
 	} else {
 		fmt.Printf("%s: ", prompt)
 	}
 
-	input, _ := reader.ReadString('\n')
+	input, _ := stdin.ReadString('\n')
 	input = strings.TrimSpace(input)
 
 	if input == "" && defaultValue != "" {
@@ -32,38 +34,26 @@ func PromptUser(prompt string, defaultValue string) string {
 }
 
 // GenerateWithAPI creates a new configuration interactively using API data
-func GenerateWithAPI(apiKey string) (*types.Config, error) {
+func GenerateWithAPI(ctx context.Context, hyperstackClient *client.HyperstackClient) (*types.Config, error) {
 	fmt.Println("=== Hyperstack Image Builder Configuration ===")
 	fmt.Println("This will generate a config.json file for building Kubernetes GPU images.")
 	fmt.Println("Fetching available options from Hyperstack API...")
 	fmt.Println()
 
-	hyperstackClient := client.New(apiKey)
 	config := &types.Config{}
 
-	// Fetch available resources
-	images, err := hyperstackClient.ListImages()
-	if err != nil {
-		fmt.Printf("Warning: Could not fetch images: %v\n", err)
-		fmt.Println("Using default values...")
-	}
-
-	regions, err := hyperstackClient.ListRegions()
+	// Fetch available resources; images and flavors once the region is known
+	regions, err := hyperstackClient.ListRegions(ctx)
 	if err != nil {
 		fmt.Printf("Warning: Could not fetch regions: %v\n", err)
 	}
 
-	flavors, err := hyperstackClient.ListFlavors()
-	if err != nil {
-		fmt.Printf("Warning: Could not fetch flavors: %v\n", err)
-	}
-
-	keypairs, err := hyperstackClient.ListKeypairs()
+	keypairs, err := hyperstackClient.ListKeypairs(ctx)
 	if err != nil {
 		fmt.Printf("Warning: Could not fetch keypairs: %v\n", err)
 	}
 
-	environments, err := hyperstackClient.ListEnvironments()
+	environments, err := hyperstackClient.ListEnvironments(ctx)
 	if err != nil {
 		fmt.Printf("Warning: Could not fetch environments: %v\n", err)
 	}
@@ -99,9 +89,20 @@ func GenerateWithAPI(apiKey string) (*types.Config, error) {
 	// Set the selected region in config
 	config.Region = selectedRegion
 
+	images, err := hyperstackClient.ListImagesInRegion(ctx, selectedRegion)
+	if err != nil {
+		fmt.Printf("Warning: Could not fetch images: %v\n", err)
+		fmt.Println("Using default values...")
+	}
+
+	flavors, err := hyperstackClient.ListFlavorsInRegion(ctx, selectedRegion)
+	if err != nil {
+		fmt.Printf("Warning: Could not fetch flavors: %v\n", err)
+	}
+
 	// Image configuration
 	config.ImageName = PromptUser("Output image name", "kubernetes_gpu_cuda")
-	config.ImageVersion = PromptUser("Output image version", fmt.Sprintf("202508.%02d.0", time.Now().Day()))
+	config.ImageVersion = PromptUser("Output image version", DefaultImageVersion)
 
 	// Show available base images filtered by selected region and k8s label
 	if len(images) > 0 {
@@ -135,23 +136,12 @@ func GenerateWithAPI(apiKey string) (*types.Config, error) {
 			}
 		}
 		
-		ubuntuImages := k8sImages // Rename for consistency with rest of code
-		
-		for i, img := range ubuntuImages {
-			if i >= 10 { // Limit display to first 10
-				fmt.Println("  ... (showing first 10)")
-				break
-			}
-			fmt.Printf("  %d. %s (Size: %.1fGB, Public: %v)\n", i+1, img.Name, float64(img.Size)/1024/1024/1024, img.IsPublic)
-		}
-		
-		if len(ubuntuImages) > 0 {
-			choice := PromptUser(fmt.Sprintf("Select base image (1-%d) or enter custom name", len(ubuntuImages)), "1")
-			if num, err := strconv.Atoi(choice); err == nil && num > 0 && num <= len(ubuntuImages) {
-				config.BaseImageName = ubuntuImages[num-1].Name
-			} else {
-				config.BaseImageName = choice
+		if len(k8sImages) > 0 {
+			choices := make([]choice, len(k8sImages))
+			for i, img := range k8sImages {
+				choices[i] = choice{img.Name, fmt.Sprintf("%s (Size: %.1fGB, Public: %v)", img.Name, float64(img.Size)/1024/1024/1024, img.IsPublic)}
 			}
+			config.BaseImageName = pick("base image", choices, k8sImages[0].Name, true)
 		} else {
 			config.BaseImageName = PromptUser("Base image name", "Ubuntu Server 22.04 LTS R535 CUDA 12.2 with Docker")
 		}
@@ -172,22 +162,12 @@ func GenerateWithAPI(apiKey string) (*types.Config, error) {
 			}
 		}
 		
-		for i, flavor := range gpuFlavors {
-			if i >= 10 { // Limit display to first 10
-				fmt.Println("  ... (showing first 10 GPU flavors)")
-				break
-			}
-			fmt.Printf("  %d. %s (CPU: %d, RAM: %.0fGB, GPU: %d %s)\n", 
-				i+1, flavor.Name, flavor.CPU, flavor.RAM, flavor.GPUCount, flavor.GPU)
-		}
-		
 		if len(gpuFlavors) > 0 {
-			choice := PromptUser(fmt.Sprintf("Select flavor (1-%d) or enter custom name", len(gpuFlavors)), "1")
-			if num, err := strconv.Atoi(choice); err == nil && num > 0 && num <= len(gpuFlavors) {
-				config.FlavorName = gpuFlavors[num-1].Name
-			} else {
-				config.FlavorName = choice
+			choices := make([]choice, len(gpuFlavors))
+			for i, flavor := range gpuFlavors {
+				choices[i] = choice{flavor.Name, fmt.Sprintf("%s (CPU: %d, RAM: %.0fGB, GPU: %d %s)", flavor.Name, flavor.CPU, flavor.RAM, flavor.GPUCount, flavor.GPU)}
 			}
+			config.FlavorName = pick("flavor", choices, gpuFlavors[0].Name, true)
 		} else {
 			config.FlavorName = PromptUser("VM flavor (GPU instance type)", "n1-A100x1")
 		}
@@ -198,22 +178,11 @@ func GenerateWithAPI(apiKey string) (*types.Config, error) {
 	// Show available keypairs
 	if len(keypairs) > 0 {
 		fmt.Println("\nAvailable SSH keypairs:")
+		choices := make([]choice, len(keypairs))
 		for i, kp := range keypairs {
-			if i >= 10 { // Limit display to first 10
-				fmt.Println("  ... (showing first 10)")
-				break
-			}
-			fmt.Printf("  %d. %s (Environment: %s)\n", i+1, kp.Name, kp.Environment.Name)
-		}
-		
-		choice := PromptUser(fmt.Sprintf("Select keypair (1-%d) or enter custom name", len(keypairs)), "")
-		if choice != "" {
-			if num, err := strconv.Atoi(choice); err == nil && num > 0 && num <= len(keypairs) {
-				config.KeypairName = keypairs[num-1].Name
-			} else {
-				config.KeypairName = choice
-			}
+			choices[i] = choice{kp.Name, fmt.Sprintf("%s (Environment: %s)", kp.Name, kp.Environment.Name)}
 		}
+		config.KeypairName = pick("keypair", choices, "", true)
 	} else {
 		config.KeypairName = PromptUser("SSH keypair name", "")
 	}
@@ -233,16 +202,11 @@ func GenerateWithAPI(apiKey string) (*types.Config, error) {
 		}
 		
 		if len(regionEnvironments) > 0 {
+			choices := make([]choice, len(regionEnvironments))
 			for i, env := range regionEnvironments {
-				fmt.Printf("  %d. %s (ID: %d)\n", i+1, env.Name, env.ID)
-			}
-			
-			choice := PromptUser(fmt.Sprintf("Select environment (1-%d) or enter custom name", len(regionEnvironments)), "1")
-			if num, err := strconv.Atoi(choice); err == nil && num > 0 && num <= len(regionEnvironments) {
-				config.EnvironmentName = regionEnvironments[num-1].Name
-			} else {
-				config.EnvironmentName = choice
+				choices[i] = choice{env.Name, fmt.Sprintf("%s (ID: %d)", env.Name, env.ID)}
 			}
+			config.EnvironmentName = pick("environment", choices, regionEnvironments[0].Name, true)
 		} else {
 			fmt.Println("No environments found for this region, using default pattern")
 			config.EnvironmentName = fmt.Sprintf("default-%s", selectedRegion)
@@ -282,7 +246,7 @@ func Generate() (*types.Config, error) {
 
 	// Image configuration
 	config.ImageName = PromptUser("Image name", "kubernetes_gpu_cuda")
-	config.ImageVersion = PromptUser("Image version", fmt.Sprintf("202508.%02d.0", time.Now().Day()))
+	config.ImageVersion = PromptUser("Image version", DefaultImageVersion)
 	config.BaseImageName = PromptUser("Base image name", "Ubuntu Server 22.04 LTS R535 CUDA 12.2 with Docker")
 
 	// VM configuration
@@ -312,9 +276,48 @@ func Generate() (*types.Config, error) {
 	return config, nil
 }
 
+// GenerateFrom creates a new configuration without prompting, from the fields set in values and the
+// defaults the interactive generator offers for the rest. The k8s tag is always included.
+func GenerateFrom(values *types.Config) *types.Config {
+	config := *values
+	defaults := []struct {
+		field *string
+		value string
+	}{
+		{&config.Region, "CANADA-1"},
+		{&config.ImageName, "kubernetes_gpu_cuda"},
+		{&config.ImageVersion, DefaultImageVersion},
+		{&config.BaseImageName, DefaultBaseImageName},
+		{&config.VMName, "thunder-build-vm"},
+		{&config.FlavorName, DefaultFlavorName},
+		{&config.PrivateKeyPath, "~/.ssh/id_rsa"},
+	}
+	for _, d := range defaults {
+		if *d.field == "" {
+			*d.field = d.value
+		}
+	}
+	if config.EnvironmentName == "" {
+		config.EnvironmentName = fmt.Sprintf("default-%s", config.Region)
+	}
+
+	config.Tags = defaultTags()
+	for _, tag := range values.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "k8s" {
+			config.Tags = append(config.Tags, tag)
+		}
+	}
+	return &config
+}
+
 // Save writes the configuration to a file
 func Save(config *types.Config, filename string) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	return SaveAs(config, filename, FormatOf(filename))
+}
+
+// SaveAs saves the configuration to a file in the given format
+func SaveAs(config *types.Config, filename, format string) error {
+	data, err := Encode(config, format)
 	if err != nil {
 		return err
 	}
@@ -322,28 +325,61 @@ func Save(config *types.Config, filename string) error {
 	return os.WriteFile(filename, data, 0644)
 }
 
-// Load reads the configuration from a file
+// Load reads the configuration from a file, as YAML if it ends in .yaml or .yml and as JSON otherwise
 func Load(filename string) (*types.Config, error) {
-	data, err := os.ReadFile(filename)
+	return LoadAs(filename, FormatOf(filename))
+}
+
+// LoadAs reads the configuration from a file in the given format
+func LoadAs(filename, format string) (*types.Config, error) {
+	return loadTarget(filename, format, "")
+}
+
+// LoadTarget reads the configuration of a named target from a file: its fields laid over the shared ones
+func LoadTarget(filename, target string) (*types.Config, error) {
+	return loadTarget(filename, FormatOf(filename), target)
+}
+
+func loadTarget(filename, format, target string) (*types.Config, error) {
+	doc, err := readDocument(filename, format, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(doc); err != nil {
+		return nil, err
+	}
+	if target != "" {
+		if doc, err = selectTarget(doc, target); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(doc)
 	if err != nil {
 		return nil, err
 	}
 
-	var config types.Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Type errors are reported with the paths of their fields rather than as opaque decoding errors
+	if err := CheckSchema(data, FormatJSON); err != nil {
+		return nil, err
+	}
+	config, err := Decode(data, FormatJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := Render(config); err != nil {
 		return nil, err
 	}
 
 	// Set defaults if not specified
 	if config.FlavorName == "" {
-		config.FlavorName = "n1-A100x1"
+		config.FlavorName = DefaultFlavorName
 	}
 	if config.BaseImageName == "" {
-		config.BaseImageName = "Ubuntu Server 22.04 LTS R535 CUDA 12.2 with Docker"
+		config.BaseImageName = DefaultBaseImageName
 	}
 	if config.Tags == nil {
-		config.Tags = []string{"k8s"}
+		config.Tags = defaultTags()
 	}
 
-	return &config, nil
+	return config, nil
 }
\ No newline at end of file
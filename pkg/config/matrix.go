@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// DriverVersionEnv is the script environment variable holding a matrix build's driver version
+const DriverVersionEnv = "NVIDIA_DRIVER_VERSION"
+
+// MatrixBuild is one combination of a build matrix
+type MatrixBuild struct {
+	Keys   []string // Axis keys of the combination, in base image, flavor and driver version order
+	Config *types.Config
+}
+
+// matrixAxis is one dimension of a matrix and how its value is applied to a config
+type matrixAxis struct {
+	name   string
+	values map[string]string
+	apply  func(cfg *types.Config, value string)
+}
+
+// ExpandMatrix returns a config for every combination of the matrix axes. Each is named
+// <image_name>-<key>-<key>..., taking keys in base image, flavor and driver version order.
+func ExpandMatrix(cfg *types.Config) ([]MatrixBuild, error) {
+	m := cfg.Matrix
+	if m == nil {
+		return nil, fmt.Errorf("config has no matrix")
+	}
+
+	axes := []matrixAxis{
+		{"base_image_name", m.BaseImageNames, func(c *types.Config, value string) { c.BaseImageName = value }},
+		{"flavor_name", m.FlavorNames, func(c *types.Config, value string) { c.FlavorName = value }},
+		{"driver_version", m.DriverVersions, func(c *types.Config, value string) {
+			env := make(map[string]string, len(c.ScriptEnv)+1)
+			for k, v := range c.ScriptEnv {
+				env[k] = v
+			}
+			env[DriverVersionEnv] = value
+			c.ScriptEnv = env
+		}},
+	}
+
+	base := *cfg
+	base.Matrix = nil
+	builds := []MatrixBuild{{Config: &base}}
+	for _, axis := range axes {
+		if len(axis.values) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(axis.values))
+		for key := range axis.values {
+			if err := checkMatrixKey(key); err != nil {
+				return nil, fmt.Errorf("matrix %s: %w", axis.name, err)
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var next []MatrixBuild
+		for _, build := range builds {
+			for _, key := range keys {
+				c := *build.Config
+				axis.apply(&c, axis.values[key])
+				next = append(next, MatrixBuild{Keys: append(append([]string{}, build.Keys...), key), Config: &c})
+			}
+		}
+		builds = next
+	}
+	if len(builds[0].Keys) == 0 {
+		return nil, fmt.Errorf("matrix has no base_image_name, flavor_name or driver_version entries")
+	}
+
+	for _, build := range builds {
+		suffix := strings.Join(build.Keys, "-")
+		build.Config.ImageName = cfg.ImageName + "-" + suffix
+		build.Config.VMName = cfg.VMName + "-" + suffix
+	}
+	return builds, nil
+}
+
+// checkMatrixKey rejects keys that would make awkward image and VM names
+func checkMatrixKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_') {
+			return fmt.Errorf("key %q may only contain letters, digits, '.' and '_'", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// CurrentVersion is the config_version of the schema this builder reads. Files without config_version are
+// version 1.
+const CurrentVersion = 2
+
+// Values loading gives fields a config leaves out
+const (
+	DefaultFlavorName    = "n1-A100x1"
+	DefaultBaseImageName = "Ubuntu Server 22.04 LTS R535 CUDA 12.2 with Docker"
+)
+
+func defaultTags() []string {
+	return []string{"k8s"}
+}
+
+// migration upgrades a config file from the version before it to version
+type migration struct {
+	version int
+	// renames maps old top-level field names to new ones
+	renames map[string]string
+	// fill returns values for top-level fields that older files relied on defaults for. A field is only
+	// filled when neither the file nor a config it extends sets it.
+	fill func(defaults *types.Config) map[string]any
+}
+
+var migrations = []migration{
+	{
+		// Version 1 files left the flavor, base image, tags, scripts and files to defaults of the builder,
+		// which change from release to release
+		version: 2,
+		fill: func(defaults *types.Config) map[string]any {
+			values := map[string]any{
+				"flavor_name":     DefaultFlavorName,
+				"base_image_name": DefaultBaseImageName,
+				"tags":            defaultTags(),
+			}
+			if defaults.Provisioners != nil {
+				values["provisioners"] = defaults.Provisioners
+			}
+			if defaults.Files != nil {
+				values["files"] = defaults.Files
+			}
+			return values
+		},
+	},
+}
+
+// Migration is the result of upgrading a config file
+type Migration struct {
+	From    int
+	To      int
+	Changes []string // What was changed, in order
+	Data    []byte   // The upgraded file, in its own format
+}
+
+// checkVersion rejects a config written for a newer schema than this builder reads
+func checkVersion(doc map[string]any) error {
+	value, ok := doc["config_version"]
+	if !ok {
+		return nil
+	}
+	version, err := strconv.Atoi(fmt.Sprint(value))
+	if err != nil || version < 1 {
+		return fmt.Errorf("config_version must be a positive whole number, got %v", value)
+	}
+	if version > CurrentVersion {
+		return fmt.Errorf("config_version %d is newer than this builder supports (%d), upgrade the builder", version, CurrentVersion)
+	}
+	return nil
+}
+
+// Migrate upgrades the config file at filename to CurrentVersion, renaming fields and writing out the
+// defaults it relied on. defaults holds the provisioners and files builds ran for configs without any.
+// The comments and field order of the file are kept.
+func Migrate(filename string, defaults *types.Config) (*Migration, error) {
+	if defaults == nil {
+		defaults = &types.Config{}
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	format := FormatOf(filename)
+	if isAge(data) || isSOPS(data, format) {
+		return nil, fmt.Errorf("%s is encrypted, decrypt it, migrate the plaintext and encrypt it again", filename)
+	}
+	// JSON is YAML, so both formats are edited as YAML nodes
+	var file yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	if len(file.Content) == 0 || file.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a config object", filename)
+	}
+	root := file.Content[0]
+
+	// Fields set by configs this one extends are not filled in
+	resolved, err := readDocument(filename, format, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(resolved); err != nil {
+		return nil, err
+	}
+
+	m := &Migration{From: 1, To: CurrentVersion}
+	if node := mappingValue(root, "config_version"); node != nil {
+		m.From, _ = strconv.Atoi(node.Value)
+	}
+	for _, step := range migrations {
+		if step.version <= m.From {
+			continue
+		}
+		if err := step.apply(root, resolved, defaults, &m.Changes); err != nil {
+			return nil, fmt.Errorf("failed to migrate to config_version %d: %w", step.version, err)
+		}
+	}
+	if m.From == m.To {
+		m.Data = data
+		return m, nil
+	}
+
+	version := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(CurrentVersion)}
+	if node := mappingValue(root, "config_version"); node != nil {
+		*node = *version
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "config_version"}
+		// A comment at the top of the file stays there
+		if len(root.Content) > 0 {
+			key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{key, version}, root.Content...)
+	}
+	m.Changes = append(m.Changes, fmt.Sprintf("set config_version to %d", CurrentVersion))
+
+	if format == FormatJSON {
+		var buf bytes.Buffer
+		writeJSON(&buf, root, "")
+		buf.WriteByte('\n')
+		m.Data = buf.Bytes()
+		return m, nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&file); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	m.Data = buf.Bytes()
+	return m, nil
+}
+
+// apply makes the changes of a migration to the top-level mapping of a file
+func (step migration) apply(root *yaml.Node, resolved map[string]any, defaults *types.Config, changes *[]string) error {
+	olds := make([]string, 0, len(step.renames))
+	for old := range step.renames {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		renamed := step.renames[old]
+		key := mappingKey(root, old)
+		if key == nil {
+			continue
+		}
+		if mappingKey(root, renamed) != nil {
+			return fmt.Errorf("both %s and its new name %s are set", old, renamed)
+		}
+		key.Value = renamed
+		*changes = append(*changes, fmt.Sprintf("renamed %s to %s", old, renamed))
+	}
+
+	if step.fill == nil {
+		return nil
+	}
+	values := step.fill(defaults)
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if _, ok := resolved[field]; ok || mappingKey(root, field) != nil {
+			continue
+		}
+		value, err := valueNode(values[field])
+		if err != nil {
+			return err
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field}
+		root.Content = append(root.Content, key, value)
+		*changes = append(*changes, fmt.Sprintf("set %s to the default it relied on", field))
+	}
+	return nil
+}
+
+// mappingKey returns the key node of a field in a mapping node, or nil
+func mappingKey(n *yaml.Node, field string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == field {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node of a field in a mapping node, or nil
+func mappingValue(n *yaml.Node, field string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == field {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// valueNode converts a value to a YAML node through JSON, so fields get their json names
+func valueNode(v any) (*yaml.Node, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	resetStyle(doc.Content[0])
+	return doc.Content[0], nil
+}
+
+// writeJSON writes a node parsed from JSON back out as indented JSON, keeping the order of its fields
+func writeJSON(buf *bytes.Buffer, n *yaml.Node, indent string) {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		opening, closing, step := "[", "]", 1
+		if n.Kind == yaml.MappingNode {
+			opening, closing, step = "{", "}", 2
+		}
+		if len(n.Content) == 0 {
+			buf.WriteString(opening + closing)
+			return
+		}
+		buf.WriteString(opening + "\n")
+		for i := 0; i < len(n.Content); i += step {
+			buf.WriteString(indent + "  ")
+			if step == 2 {
+				writeJSONString(buf, n.Content[i].Value)
+				buf.WriteString(": ")
+			}
+			writeJSON(buf, n.Content[i+step-1], indent+"  ")
+			if i+step < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + closing)
+	case yaml.AliasNode:
+		writeJSON(buf, n.Alias, indent)
+	default:
+		switch n.ShortTag() {
+		case "!!str":
+			writeJSONString(buf, n.Value)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			buf.WriteString(n.Value)
+		}
+	}
+}
+
+// writeJSONString writes s as a JSON string, leaving <, > and & as they are
+func writeJSONString(buf *bytes.Buffer, s string) {
+	var quoted bytes.Buffer
+	enc := json.NewEncoder(&quoted)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Write(bytes.TrimSuffix(quoted.Bytes(), []byte("\n")))
+}
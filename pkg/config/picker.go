@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// choice is an option of a picker: the value it picks and how it is listed
+type choice struct {
+	value string
+	label string
+}
+
+// pick lets the user choose from a list that can be narrowed with a fuzzy search: a number picks the
+// option listed under it, other text filters the options by it, and an empty answer picks def. With
+// custom set, text matching no option is used as the value itself.
+func pick(what string, choices []choice, def string, custom bool) string {
+	shown := choices
+	for {
+		for i, c := range shown {
+			fmt.Printf("  %d. %s\n", i+1, c.label)
+		}
+		prompt := fmt.Sprintf("Select %s (1-%d, or type to search)", what, len(shown))
+		answer := PromptUser(prompt, def)
+		if answer == "" {
+			return ""
+		}
+		if num, err := strconv.Atoi(answer); err == nil && num > 0 && num <= len(shown) {
+			return shown[num-1].value
+		}
+		if answer == def {
+			return def
+		}
+
+		for _, c := range choices {
+			if strings.EqualFold(c.value, answer) {
+				return c.value
+			}
+		}
+		matches := fuzzyFilter(choices, answer)
+		switch {
+		case len(matches) == 1:
+			fmt.Printf("Matched %s\n", matches[0].value)
+			return matches[0].value
+		case len(matches) == 0 && custom:
+			fmt.Printf("No %s matches %q, using it as the name\n", what, answer)
+			return answer
+		case len(matches) == 0:
+			fmt.Printf("No %s matches %q\n", what, answer)
+			shown = choices
+		default:
+			fmt.Printf("%d matches for %q:\n", len(matches), answer)
+			shown = matches
+		}
+	}
+}
+
+// fuzzyFilter returns the choices whose value contains the letters of query in order, best matches first
+func fuzzyFilter(choices []choice, query string) []choice {
+	type scored struct {
+		choice
+		score int
+	}
+	var matches []scored
+	for _, c := range choices {
+		if score, ok := fuzzyScore(c.value, query); ok {
+			matches = append(matches, scored{c, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	filtered := make([]choice, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.choice
+	}
+	return filtered
+}
+
+// fuzzyScore matches query against s ignoring case and spaces in the query. Consecutive letters, letters
+// at the start of a word and an early first match score higher.
+func fuzzyScore(s, query string) (int, bool) {
+	s = strings.ToLower(s)
+	query = strings.ToLower(strings.ReplaceAll(query, " ", ""))
+	score, last, first := 0, -1, -1
+	for _, r := range query {
+		i := strings.IndexRune(s[last+1:], r)
+		if i < 0 {
+			return 0, false
+		}
+		pos := last + 1 + i
+		if first < 0 {
+			first = pos
+		}
+		score++
+		if pos == last+1 && last >= 0 {
+			score += 3
+		}
+		if pos == 0 || strings.ContainsRune(" -_./", rune(s[pos-1])) {
+			score += 2
+		}
+		last = pos
+	}
+	return score*10 - first, true
+}
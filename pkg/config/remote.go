@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/publish"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// IsRemote reports whether a config path is a URL to fetch: https://, s3:// or gs://
+func IsRemote(name string) bool {
+	for _, scheme := range []string{"https://", "s3://", "gs://"} {
+		if strings.HasPrefix(name, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheDir is where remote configs are cached, under the user cache directory
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hyperstack-builder", "configs"), nil
+}
+
+// Fetch downloads a remote config into the cache and returns the path of the local copy. When the
+// download fails, a copy cached by an earlier fetch is used instead, with a warning.
+func Fetch(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid config URL %s: %w", uri, err)
+	}
+	dir, err := CacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the config cache: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// The cached copy keeps the extension of the URL, which decides its format, and an .age suffix
+	base, suffix := path.Base(u.Path), ""
+	if strings.HasSuffix(base, AgeSuffix) {
+		base, suffix = strings.TrimSuffix(base, AgeSuffix), AgeSuffix
+	}
+	ext := path.Ext(base)
+	if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+		ext = ".json"
+	}
+	sum := sha256.Sum256([]byte(uri))
+	cached := filepath.Join(dir, strings.TrimSuffix(base, path.Ext(base))+"-"+hex.EncodeToString(sum[:6])+ext+suffix)
+
+	tmp, err := os.CreateTemp(dir, ".fetch-*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if u.Scheme == "https" {
+		err = download(uri, tmp.Name())
+	} else {
+		err = publish.DownloadFile(uri, tmp.Name())
+	}
+	if err != nil {
+		if _, statErr := os.Stat(cached); statErr == nil {
+			slog.Warn("Failed to fetch the config, using the cached copy", "url", uri, "cached", cached, "error", err)
+			return cached, nil
+		}
+		return "", fmt.Errorf("failed to fetch config %s: %w", uri, err)
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", err
+	}
+	slog.Debug("Fetched config", "url", uri, "cached", cached)
+	return cached, nil
+}
+
+// download saves an https URL to a file, sending HYPERSTACK_CONFIG_TOKEN as a bearer token if set
+func download(uri, filename string) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("HYPERSTACK_CONFIG_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", uri, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
@@ -0,0 +1,438 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/versioning"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Problem is one thing wrong with a config, at the path of the field it concerns, e.g. stages[1].image_name
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// SchemaError lists every problem found in a config, so they can all be fixed in one go
+type SchemaError struct {
+	Problems []Problem
+}
+
+func (e *SchemaError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid config: " + e.Problems[0].String()
+	}
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.String()
+	}
+	return fmt.Sprintf("invalid config, %d problems: %s", len(e.Problems), strings.Join(problems, "; "))
+}
+
+// problemsError returns a SchemaError of the problems, or nil if there are none
+func problemsError(problems []Problem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &SchemaError{Problems: problems}
+}
+
+// CheckSchema checks a config document in the given format against the fields of types.Config before it is
+// decoded, reporting unknown fields and values of the wrong type with their paths
+func CheckSchema(data []byte, format string) error {
+	data, err := toJSON(data, format)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	var problems []Problem
+	checkValue(&problems, "", doc, reflect.TypeOf(types.Config{}))
+	return problemsError(problems)
+}
+
+// checkValue checks that v, decoded from JSON, fits a value of type t
+func checkValue(problems *[]Problem, path string, v any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// null leaves the field at its zero value
+	if v == nil || t.Kind() == reflect.Interface {
+		return
+	}
+	fail := func(expected string) {
+		*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf("expected %s, got %s", expected, describe(v))})
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := v.(json.Number); ok {
+			// Unquoted versions such as 1.0 are numbers in YAML
+			fail("a string (quote it)")
+		} else if _, ok := v.(string); !ok {
+			fail("a string")
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			fail("true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(json.Number)
+		if !ok {
+			fail("a whole number")
+		} else if _, err := n.Int64(); err != nil {
+			fail("a whole number")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			fail("a number")
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := v.([]any)
+		if !ok {
+			fail("a list")
+			return
+		}
+		for i, item := range list {
+			checkValue(problems, fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok {
+			fail("a mapping")
+			return
+		}
+		for _, key := range sortedKeys(m) {
+			checkValue(problems, joinPath(path, key), m[key], t.Elem())
+		}
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			fail("a mapping")
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(m) {
+			field, ok := fields[key]
+			if !ok {
+				message := "unknown field"
+				if suggestion := closestField(key, fields); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %s?", suggestion)
+				}
+				*problems = append(*problems, Problem{Path: joinPath(path, key), Message: message})
+				continue
+			}
+			checkValue(problems, joinPath(path, key), m[key], field)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of a struct's fields, including those of embedded structs, to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n, ft := range jsonFields(f.Type) {
+				fields[n] = ft
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// closestField returns the known field a misspelled one most likely meant, or "" if none is close
+func closestField(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// describe names the JSON type of v for error messages
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case json.Number:
+		return "number " + v.String()
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "a mapping"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// namePattern is what image and VM names and image versions may contain
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// CheckFields checks the values of a decoded config: required fields, the characters of names, the image
+// version format, and the provisioners and files. Every problem is reported at once as a SchemaError.
+func CheckFields(cfg *types.Config) error {
+	var problems []Problem
+	required := []struct{ field, value string }{
+		{"image_name", cfg.ImageName},
+		{"image_version", cfg.ImageVersion},
+		{"base_image_name", cfg.BaseImageName},
+		{"vm_name", cfg.VMName},
+		{"flavor_name", cfg.FlavorName},
+		{"keypair_name", cfg.KeypairName},
+	}
+	// Without a region, one is picked when building and its default environment used. ensure_environment
+	// creates default-<REGION> when environment_name is left out.
+	switch {
+	case cfg.Region == "":
+		if cfg.EnvironmentName != "" {
+			problems = append(problems, Problem{Path: "environment_name", Message: "belongs to a single region, leave it out when region is left empty"})
+		}
+		if len(cfg.Replicas) > 0 {
+			problems = append(problems, Problem{Path: "replicas", Message: "need a region to replicate from, set region"})
+		}
+	case !cfg.EnsureEnvironment:
+		required = append(required, struct{ field, value string }{"environment_name", cfg.EnvironmentName})
+	}
+	// The private key may come from a command or Vault instead of a file
+	if cfg.PrivateKeyCommand == "" && cfg.PrivateKeyVault == "" {
+		required = append(required, struct{ field, value string }{"private_key_path", cfg.PrivateKeyPath})
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			problems = append(problems, Problem{Path: r.field, Message: "is required"})
+		}
+	}
+
+	sources := []struct {
+		fields []string
+		values []string
+	}{
+		{[]string{"api_key_file", "api_key_command", "api_key_vault"}, []string{cfg.APIKeyFile, cfg.APIKeyCommand, cfg.APIKeyVault}},
+		{[]string{"private_key_command", "private_key_vault"}, []string{cfg.PrivateKeyCommand, cfg.PrivateKeyVault}},
+	}
+	for _, source := range sources {
+		var set []string
+		for i, value := range source.values {
+			if value != "" {
+				set = append(set, source.fields[i])
+			}
+		}
+		if len(set) > 1 {
+			problems = append(problems, Problem{Path: set[1], Message: fmt.Sprintf("cannot be combined with %s, set only one of %s", set[0], strings.Join(source.fields, ", "))})
+		}
+	}
+	for _, field := range []struct{ name, value string }{{"api_key_vault", cfg.APIKeyVault}, {"private_key_vault", cfg.PrivateKeyVault}} {
+		if path, key, ok := strings.Cut(field.value, "#"); field.value != "" && (!ok || path == "" || key == "") {
+			problems = append(problems, Problem{Path: field.name, Message: fmt.Sprintf("%q must be a Vault secret as <path>#<field>", field.value)})
+		}
+	}
+
+	names := []struct{ field, value string }{
+		{"image_name", cfg.ImageName},
+		{"vm_name", cfg.VMName},
+	}
+	for _, n := range names {
+		if n.value != "" && !namePattern.MatchString(n.value) {
+			problems = append(problems, Problem{Path: n.field, Message: fmt.Sprintf("%q may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit", n.value)})
+		}
+	}
+	if v := cfg.ImageVersion; v != "" && v != versioning.Auto && !namePattern.MatchString(v) {
+		problems = append(problems, Problem{Path: "image_version", Message: fmt.Sprintf("%q must be %q or a version of letters, digits, '.', '_' and '-', e.g. 1.4.0 or 2026.10.1", v, versioning.Auto)})
+	}
+	for i, p := range cfg.Provisioners {
+		if strings.TrimSpace(p.Script) == "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("provisioners[%d].script", i), Message: "is required"})
+		}
+	}
+	for i, f := range cfg.Files {
+		if strings.TrimSpace(f.Source) == "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("files[%d].source", i), Message: "is required"})
+		}
+		if !strings.HasPrefix(f.Destination, "/") {
+			problems = append(problems, Problem{Path: fmt.Sprintf("files[%d].destination", i), Message: fmt.Sprintf("%q must be an absolute path on the VM", f.Destination)})
+		}
+	}
+	for i, tag := range cfg.Tags {
+		if strings.TrimSpace(tag) == "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("tags[%d]", i), Message: "must not be empty"})
+		}
+	}
+	if c := cfg.SSHCIDR; c != "" && c != SSHCIDRAuto {
+		if _, err := netip.ParsePrefix(c); err != nil {
+			problems = append(problems, Problem{Path: "ssh_cidr", Message: fmt.Sprintf("%q must be %q or a CIDR such as 203.0.113.7/32", c, SSHCIDRAuto)})
+		}
+	}
+	for i, rule := range cfg.SecurityRules {
+		problems = append(problems, checkSecurityRule(fmt.Sprintf("security_rules[%d]", i), rule)...)
+	}
+	if cfg.API != nil {
+		problems = append(problems, checkAPI(cfg.API)...)
+	}
+	if v := cfg.ScratchVolume; v != nil {
+		if v.SizeGB <= 0 {
+			problems = append(problems, Problem{Path: "scratch_volume.size_gb", Message: "must be a positive number of GB"})
+		}
+		if v.MountPoint != "" && (!strings.HasPrefix(v.MountPoint, "/") || v.MountPoint == "/" || strings.ContainsAny(v.MountPoint, " \t'\"")) {
+			problems = append(problems, Problem{Path: "scratch_volume.mount_point", Message: fmt.Sprintf("%q must be an absolute path on the VM, without spaces or quotes", v.MountPoint)})
+		}
+	}
+	return problemsError(problems)
+}
+
+// CheckStages checks the stages of a pipeline config, which each build an image of their own name rather
+// than inheriting it. Every problem is reported at once as a SchemaError.
+func CheckStages(cfg *types.Config) error {
+	var problems []Problem
+	for i, stage := range cfg.Stages {
+		path := fmt.Sprintf("stages[%d]", i)
+		if strings.TrimSpace(stage.Name) == "" {
+			problems = append(problems, Problem{Path: path + ".name", Message: "is required"})
+		}
+		switch {
+		case strings.TrimSpace(stage.ImageName) == "":
+			problems = append(problems, Problem{Path: path + ".image_name", Message: "is required"})
+		case !namePattern.MatchString(stage.ImageName):
+			problems = append(problems, Problem{Path: path + ".image_name", Message: fmt.Sprintf("%q may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit", stage.ImageName)})
+		}
+		if v := stage.ImageVersion; v != "" && v != versioning.Auto && !namePattern.MatchString(v) {
+			problems = append(problems, Problem{Path: path + ".image_version", Message: fmt.Sprintf("%q must be %q or a version of letters, digits, '.', '_' and '-', e.g. 1.4.0 or 2026.10.1", v, versioning.Auto)})
+		}
+	}
+	return problemsError(problems)
+}
+
+// checkAPI checks the api section; the CA bundle is only read when a client is created
+func checkAPI(api *types.APIConfig) []Problem {
+	var problems []Problem
+	if api.BaseURL != "" {
+		if u, err := url.Parse(api.BaseURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problems = append(problems, Problem{Path: "api.base_url", Message: fmt.Sprintf("%q must be an http or https URL", api.BaseURL)})
+		}
+	}
+	if api.Timeout != "" {
+		if d, err := time.ParseDuration(api.Timeout); err != nil || d <= 0 {
+			problems = append(problems, Problem{Path: "api.timeout", Message: fmt.Sprintf("%q must be a positive duration such as 60s", api.Timeout)})
+		}
+	}
+	if api.Proxy != "" {
+		if u, err := url.Parse(api.Proxy); err != nil || u.Host == "" {
+			problems = append(problems, Problem{Path: "api.proxy", Message: fmt.Sprintf("%q must be a URL such as http://proxy.example.com:3128", api.Proxy)})
+		}
+	}
+	return problems
+}
+
+// SSHCIDRAuto as ssh_cidr restricts SSH to build VMs to the public IP of the host running the builder
+const SSHCIDRAuto = "auto"
+
+// checkSecurityRule checks a security rule; direction and ethertype may be left out
+func checkSecurityRule(path string, rule types.SecurityRule) []Problem {
+	var problems []Problem
+	if rule.Direction != "" && rule.Direction != "ingress" && rule.Direction != "egress" {
+		problems = append(problems, Problem{Path: path + ".direction", Message: fmt.Sprintf("%q must be ingress or egress", rule.Direction)})
+	}
+	switch rule.Protocol {
+	case "tcp", "udp", "icmp":
+	case "":
+		problems = append(problems, Problem{Path: path + ".protocol", Message: "is required"})
+	default:
+		problems = append(problems, Problem{Path: path + ".protocol", Message: fmt.Sprintf("%q must be tcp, udp or icmp", rule.Protocol)})
+	}
+	prefix, err := netip.ParsePrefix(rule.RemoteIPPrefix)
+	if err != nil {
+		problems = append(problems, Problem{Path: path + ".remote_ip_prefix", Message: fmt.Sprintf("%q must be a CIDR such as 10.0.0.0/8", rule.RemoteIPPrefix)})
+	}
+	if err == nil && rule.EtherType != "" {
+		want := "IPv4"
+		if prefix.Addr().Is6() {
+			want = "IPv6"
+		}
+		if rule.EtherType != want {
+			problems = append(problems, Problem{Path: path + ".ethertype", Message: fmt.Sprintf("%q does not match remote_ip_prefix %s, which is %s", rule.EtherType, rule.RemoteIPPrefix, want)})
+		}
+	}
+	for _, port := range []struct {
+		field string
+		value *int
+	}{{"port_range_min", rule.PortRangeMin}, {"port_range_max", rule.PortRangeMax}} {
+		if port.value != nil && (*port.value < 1 || *port.value > 65535) {
+			problems = append(problems, Problem{Path: path + "." + port.field, Message: fmt.Sprintf("%d is not a port between 1 and 65535", *port.value)})
+		}
+	}
+	if rule.PortRangeMin != nil && rule.PortRangeMax != nil && *rule.PortRangeMin > *rule.PortRangeMax {
+		problems = append(problems, Problem{Path: path + ".port_range_min", Message: fmt.Sprintf("%d is above port_range_max %d", *rule.PortRangeMin, *rule.PortRangeMax)})
+	}
+	return problems
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// TargetNames returns the names of a config's targets in order
+func TargetNames(cfg *types.Config) []string {
+	names := make([]string, 0, len(cfg.Targets))
+	for name := range cfg.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectTarget returns the config document of the named target: the document without its targets, with the
+// fields the target sets laid over it
+func selectTarget(doc map[string]any, name string) (map[string]any, error) {
+	targets, _ := doc["targets"].(map[string]any)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("config has no targets to select %s from", name)
+	}
+	target, ok := targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q, expected one of %s", name, strings.Join(sortedKeys(targets), ", "))
+	}
+	override, ok := target.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("target %s must be a mapping of config fields", name)
+	}
+	if _, ok := override["targets"]; ok {
+		return nil, fmt.Errorf("target %s cannot define targets of its own", name)
+	}
+
+	base := make(map[string]any, len(doc))
+	for k, v := range doc {
+		if k != "targets" {
+			base[k] = v
+		}
+	}
+	return overlay(base, override), nil
+}
+
+// overlay lays override over base: mappings are merged field by field, while any other value, lists
+// included, replaces the base's
+func overlay(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseMap, baseOK := merged[k].(map[string]any)
+		overrideMap, overrideOK := v.(map[string]any)
+		if baseOK && overrideOK {
+			merged[k] = overlay(baseMap, overrideMap)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// DefaultImageVersion is the image_version suggested by generate-config: the build date, rendered when the
+// config is loaded
+const DefaultImageVersion = `{{date "200601.02"}}.0`
+
+// templateFuncs returns the functions config values can use. They are fixed for one load, so every
+// {{timestamp}} or {{uuid}} in a config renders the same.
+func templateFuncs(now time.Time, uuid string) template.FuncMap {
+	return template.FuncMap{
+		// date formats the load time with a Go layout, e.g. {{date "200601.02"}}
+		"date":      func(layout string) string { return now.Format(layout) },
+		"timestamp": func() string { return strconv.FormatInt(now.Unix(), 10) },
+		"uuid":      func() string { return uuid },
+		// env is "" for an unset variable
+		"env": os.Getenv,
+	}
+}
+
+// Render expands the Go-template expressions in the string values of a config, e.g.
+// "{{date \"200601.02\"}}.{{env \"BUILD_NUMBER\"}}". Values without "{{" are left alone. Every value that
+// fails to render is reported at once as a SchemaError.
+func Render(cfg *types.Config) error {
+	funcs := templateFuncs(time.Now().UTC(), newUUID())
+	var problems []Problem
+	renderValue(&problems, "", reflect.ValueOf(cfg).Elem(), funcs)
+	return problemsError(problems)
+}
+
+// renderValue renders the strings in v, which must be settable
+func renderValue(problems *[]Problem, path string, v reflect.Value, funcs template.FuncMap) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			renderValue(problems, path, v.Elem(), funcs)
+		}
+	case reflect.String:
+		rendered, err := renderString(v.String(), funcs)
+		if err != nil {
+			*problems = append(*problems, Problem{Path: path, Message: err.Error()})
+			return
+		}
+		v.SetString(rendered)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			renderValue(problems, fmt.Sprintf("%s[%d]", path, i), v.Index(i), funcs)
+		}
+	case reflect.Map:
+		// Map values aren't addressable, so each is rendered in a copy and stored back
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			renderValue(problems, joinPath(path, fmt.Sprint(iter.Key())), value, funcs)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if f.Anonymous && name == "" {
+				renderValue(problems, path, v.Field(i), funcs)
+				continue
+			}
+			// Notification templates are rendered when a notification is sent, with the build's event
+			if name == "template" {
+				continue
+			}
+			if name == "" || name == "-" {
+				name = f.Name
+			}
+			renderValue(problems, joinPath(path, name), v.Field(i), funcs)
+		}
+	}
+}
+
+// renderString executes s as a template if it contains an expression
+func renderString(s string, funcs template.FuncMap) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("value").Funcs(funcs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// Default phase deadlines, deliberately generous since large images take a long time to snapshot
+const (
+	DefaultVMReadyTimeout  = 20 * time.Minute
+	DefaultSSHTimeout      = 5 * time.Minute
+	DefaultSnapshotTimeout = 90 * time.Minute
+	DefaultImageTimeout    = 30 * time.Minute
+)
+
+// Timeouts holds the resolved deadline for each build phase
+type Timeouts struct {
+	Build    time.Duration // 0 means the build as a whole has no deadline
+	VMReady  time.Duration
+	SSH      time.Duration
+	Snapshot time.Duration
+	Image    time.Duration
+}
+
+// ResolveTimeouts parses the configured phase deadlines, falling back to defaults
+func ResolveTimeouts(cfg *types.Config) (Timeouts, error) {
+	timeouts := Timeouts{
+		VMReady:  DefaultVMReadyTimeout,
+		SSH:      DefaultSSHTimeout,
+		Snapshot: DefaultSnapshotTimeout,
+		Image:    DefaultImageTimeout,
+	}
+	if cfg.Timeouts == nil {
+		return timeouts, nil
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"timeouts.build", cfg.Timeouts.Build, &timeouts.Build},
+		{"timeouts.vm_ready", cfg.Timeouts.VMReady, &timeouts.VMReady},
+		{"timeouts.ssh", cfg.Timeouts.SSH, &timeouts.SSH},
+		{"timeouts.snapshot", cfg.Timeouts.Snapshot, &timeouts.Snapshot},
+		{"timeouts.image", cfg.Timeouts.Image, &timeouts.Image},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return timeouts, fmt.Errorf("invalid %s %q: %w", f.name, f.value, err)
+		}
+		if d <= 0 {
+			return timeouts, fmt.Errorf("invalid %s %q: must be positive", f.name, f.value)
+		}
+		*f.dest = d
+	}
+
+	return timeouts, nil
+}
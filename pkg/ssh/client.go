@@ -0,0 +1,295 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/logging"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metrics"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+)
+
+// Client wraps SSH connectivity
+type Client struct {
+	config *ssh.ClientConfig
+	client *ssh.Client
+	output io.Writer
+	step   string
+	env    map[string]string
+}
+
+// New creates a new SSH client with private key authentication
+func New(privateKeyPath, username string) (*Client, error) {
+	// Expand tilde in path
+	if strings.HasPrefix(privateKeyPath, "~") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		privateKeyPath = filepath.Join(homeDir, privateKeyPath[1:])
+	}
+
+	// Read private key
+	key, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	// Parse private key
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	config := &ssh.ClientConfig{
+		User: username,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Note: In production, use proper host key verification
+		Timeout:         30 * time.Second,
+	}
+
+	return &Client{config: config}, nil
+}
+
+// Connect establishes SSH connection to the remote host, on port 22 unless host is host:port, retrying until ctx is done
+func (c *Client) Connect(ctx context.Context, host string) error {
+	addr := host
+	if _, _, splitErr := net.SplitHostPort(host); splitErr != nil {
+		addr = net.JoinHostPort(host, "22")
+	}
+
+	var err error
+	span := tracing.Start("ssh connect", tracing.String("server.address", addr))
+	// Retry every 10s while sshd comes up, until ctx is done
+	for attempt := 1; ; attempt++ {
+		c.client, err = ssh.Dial("tcp", addr, c.config)
+		if err == nil {
+			slog.Info("SSH connection established", "host", host)
+			span.SetAttributes(tracing.Int("ssh.attempts", attempt))
+			span.End(nil)
+			return nil
+		}
+
+		slog.Warn("SSH connection attempt failed, retrying in 10s", "host", host, "attempt", attempt, "error", err)
+		metrics.SSHRetries.Inc()
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("failed to connect after %d attempts: %w", attempt, err)
+			span.SetAttributes(tracing.Int("ssh.attempts", attempt))
+			span.End(err)
+			return err
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// SetOutput mirrors remote command output to w, with secrets redacted, in addition to the console; nil
+// disables mirroring
+func (c *Client) SetOutput(w io.Writer) {
+	c.output = nil
+	if w != nil {
+		c.output = logging.RedactWriter(w)
+	}
+}
+
+// SetStep names the step whose remote output follows, shown on each mirrored console line; "" clears it
+func (c *Client) SetStep(step string) {
+	c.step = step
+}
+
+// SetEnv sets environment variables for the scripts run by ExecuteScript
+func (c *Client) SetEnv(env map[string]string) {
+	c.env = env
+}
+
+// Close closes the SSH connection
+func (c *Client) Close() error {
+	if c.client != nil {
+		return c.client.Close()
+	}
+	return nil
+}
+
+// CopyFile copies a local file to the remote host via SCP
+func (c *Client) CopyFile(localPath, remotePath string) error {
+	if c.client == nil {
+		return fmt.Errorf("SSH connection not established")
+	}
+
+	// Read local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer localFile.Close()
+
+	stat, err := localFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+
+	// Create SCP session
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	// Set up SCP command
+	go func() {
+		w, _ := session.StdinPipe()
+		defer w.Close()
+		
+		fmt.Fprintf(w, "C0644 %d %s\n", stat.Size(), filepath.Base(remotePath))
+		io.Copy(w, localFile)
+		fmt.Fprint(w, "\x00")
+	}()
+
+	// Execute SCP command
+	cmd := fmt.Sprintf("scp -t %s", remotePath)
+	span := tracing.Start("ssh copy", tracing.String("file.path", remotePath), tracing.Int("file.size", int(stat.Size())))
+	err = session.Run(cmd)
+	span.End(err)
+	if err != nil {
+		return fmt.Errorf("failed to execute SCP: %w", err)
+	}
+
+	slog.Info("File copied", "local", localPath, "remote", remotePath)
+	return nil
+}
+
+// ExecuteCommand executes a command on the remote host
+func (c *Client) ExecuteCommand(command string) error {
+	if c.client == nil {
+		return fmt.Errorf("SSH connection not established")
+	}
+
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	// Set up stdout/stderr capture
+	stdout := newLineWriter(os.Stdout, "stdout", c.step)
+	stderr := newLineWriter(os.Stderr, "stderr", c.step)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if c.output != nil {
+		session.Stdout = io.MultiWriter(stdout, c.output)
+		session.Stderr = io.MultiWriter(stderr, c.output)
+	}
+
+	slog.Info("Executing command", "command", command)
+	span := tracing.Start("ssh exec", tracing.String("command", command))
+	err = session.Run(command)
+	span.End(err)
+	if err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// CommandOutput executes a command on the remote host and returns its stdout
+func (c *Client) CommandOutput(command string) ([]byte, error) {
+	if c.client == nil {
+		return nil, fmt.Errorf("SSH connection not established")
+	}
+
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	stderr := newLineWriter(os.Stderr, "stderr", c.step)
+	defer stderr.Flush()
+	session.Stderr = stderr
+
+	span := tracing.Start("ssh exec", tracing.String("command", command))
+	output, err := session.Output(command)
+	span.End(err)
+	if err != nil {
+		return nil, fmt.Errorf("command failed: %w", err)
+	}
+
+	return output, nil
+}
+
+// StreamOutput executes a command on the remote host, streaming its stdout into w
+func (c *Client) StreamOutput(command string, w io.Writer) error {
+	if c.client == nil {
+		return fmt.Errorf("SSH connection not established")
+	}
+
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	stderr := newLineWriter(os.Stderr, "stderr", c.step)
+	defer stderr.Flush()
+	session.Stdout = w
+	session.Stderr = stderr
+
+	slog.Info("Streaming output of command", "command", command)
+	span := tracing.Start("ssh exec", tracing.String("command", command))
+	err = session.Run(command)
+	span.End(err)
+	if err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteScript executes a script with proper permissions
+func (c *Client) ExecuteScript(scriptPath string) error {
+	// Make script executable
+	if err := c.ExecuteCommand(fmt.Sprintf("chmod +x %s", scriptPath)); err != nil {
+		return fmt.Errorf("failed to make script executable: %w", err)
+	}
+
+	// Execute script
+	if err := c.ExecuteCommand(envPrefix(c.env) + scriptPath); err != nil {
+		return fmt.Errorf("failed to execute script: %w", err)
+	}
+
+	return nil
+}
+
+// envPrefix returns an env invocation setting the variables, or "" if there are none
+func envPrefix(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("env")
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s='%s'", k, strings.ReplaceAll(env[k], "'", `'\''`))
+	}
+	b.WriteString(" ")
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/logging"
+)
+
+// lineWriter mirrors remote output to the console one line at a time, prefixed with the time and step,
+// and emits each line as a debug log record so structured log consumers receive it too
+type lineWriter struct {
+	w      io.Writer
+	stream string
+	step   string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newLineWriter(w io.Writer, stream, step string) *lineWriter {
+	return &lineWriter{w: w, stream: stream, step: step}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.emit(string(bytes.TrimRight(l.buf[:i], "\r")))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits a trailing line that did not end in a newline
+func (l *lineWriter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) > 0 {
+		l.emit(string(l.buf))
+		l.buf = nil
+	}
+}
+
+func (l *lineWriter) emit(line string) {
+	line = logging.Redact(line)
+	prefix := time.Now().Format("15:04:05")
+	if l.step != "" {
+		prefix += " [" + l.step + "]"
+	}
+	fmt.Fprintf(l.w, "%s %s\n", prefix, line)
+	slog.Debug("Remote output", "stream", l.stream, "line", line)
+}
@@ -0,0 +1,606 @@
+package types
+
+import "encoding/json"
+
+// Config holds the configuration for building Hyperstack images
+type Config struct {
+	ConfigVersion int `json:"config_version,omitempty"` // Schema version of the file, upgraded by config migrate
+
+	Region          string   `json:"region"`
+	ImageName       string   `json:"image_name"`
+	ImageVersion    string   `json:"image_version"`
+	BaseImageName   string   `json:"base_image_name"`
+	VMName          string   `json:"vm_name"`
+	FlavorName      string   `json:"flavor_name"`
+	KeypairName     string   `json:"keypair_name"`
+	PrivateKeyPath  string   `json:"private_key_path"`
+	PublicKeyPath   string   `json:"public_key_path,omitempty"` // Imported as keypair_name when the environment has no such keypair
+	EnvironmentName string   `json:"environment_name"`
+	Tags            []string `json:"tags"`
+	HourlyCost      float64  `json:"hourly_cost,omitempty"`
+	MaxBuildMinutes int      `json:"max_build_minutes,omitempty"`  // Abort the build and delete its VM after this long
+	MaxBuildCost    float64  `json:"max_build_cost,omitempty"`     // Abort once the build VM has cost this much at hourly_cost
+	ResourceTTL     string   `json:"resource_ttl,omitempty"`       // Lifetime stamped on build VMs and snapshots, e.g. "12h"
+	VersionScheme   string   `json:"version_scheme,omitempty"`     // Scheme used when image_version is "auto": calver, semver or counter
+	KeepVMOnFailure bool     `json:"keep_vm_on_failure,omitempty"` // Leave the build VM running when the build fails
+	SkipSnapshot    bool     `json:"skip_snapshot,omitempty"`      // Stop after provisioning without creating a snapshot or image
+	MaxParallel     int      `json:"max_parallel,omitempty"`       // Build VMs this host runs at once across matrix and regional builds; 0 is no limit
+
+	// Create environment_name, or default-<REGION> when it is left out, if the account doesn't have it
+	EnsureEnvironment bool `json:"ensure_environment,omitempty"`
+
+	// Power actions on the build VM: stop it before the snapshot so its filesystems are consistent,
+	// hard-reboot it once when SSH can't reach it for provisioning, and shelve it when it is kept
+	StopForSnapshot   bool `json:"stop_for_snapshot,omitempty"`
+	RebootUnreachable bool `json:"reboot_unreachable,omitempty"`
+	ShelveKeptVM      bool `json:"shelve_kept_vm,omitempty"`
+
+	// Where the API key comes from when HYPERSTACK_API_KEY is not set, and the SSH private key instead of
+	// private_key_path. Vault secrets are given as <path>#<field>.
+	APIKeyFile        string `json:"api_key_file,omitempty"`
+	APIKeyCommand     string `json:"api_key_command,omitempty"` // Shell command printing the key
+	APIKeyVault       string `json:"api_key_vault,omitempty"`
+	PrivateKeyCommand string `json:"private_key_command,omitempty"`
+	PrivateKeyVault   string `json:"private_key_vault,omitempty"`
+
+	// Ingress to build VMs: SSH from ssh_cidr, "auto" for the builder's public IP and anywhere by default,
+	// and any further security_rules
+	SSHCIDR       string         `json:"ssh_cidr,omitempty"`
+	SecurityRules []SecurityRule `json:"security_rules,omitempty"`
+
+	// How the Hyperstack API is reached: base URL, request timeout, proxy and CA bundle
+	API *APIConfig `json:"api,omitempty"`
+
+	// Volume attached to the build VM while it is provisioned, for space its root disk lacks
+	ScratchVolume *ScratchVolumeConfig `json:"scratch_volume,omitempty"`
+
+	LaunchTest *LaunchTestConfig `json:"launch_test,omitempty"`
+	JoinTest   *JoinTestConfig   `json:"join_test,omitempty"`
+	Stages     []Stage           `json:"stages,omitempty"`
+	Timeouts   *TimeoutsConfig   `json:"timeouts,omitempty"`
+	Artifacts  *ArtifactsConfig  `json:"artifacts,omitempty"`
+	Signing    *SigningConfig    `json:"signing,omitempty"`
+	HCPPacker  *HCPPackerConfig  `json:"hcp_packer,omitempty"`
+	Terraform  *TerraformConfig  `json:"terraform,omitempty"`
+	CAPI       *CAPIConfig       `json:"capi,omitempty"`
+	Dotenv     *DotenvConfig     `json:"dotenv,omitempty"`
+	Regions    []string          `json:"regions,omitempty"` // Built concurrently, one VM and image per region
+	Replicas   []RegionReplica   `json:"replicas,omitempty"`
+	Matrix     *Matrix           `json:"matrix,omitempty"`
+	Naming     *NamingPolicy     `json:"naming_policy,omitempty"`
+	Retention  *RetentionConfig  `json:"retention,omitempty"`
+
+	Notifications *NotificationsConfig `json:"notifications,omitempty"`
+	Compliance    *ComplianceConfig    `json:"compliance,omitempty"`
+
+	// ScriptEnv is set in the environment of every provisioning script
+	ScriptEnv map[string]string `json:"script_env,omitempty"`
+
+	// Provisioners and Files replace the builder's default scripts and file deployments when set
+	Provisioners []Provisioner `json:"provisioners,omitempty"`
+	Files        []FileConfig  `json:"files,omitempty"`
+
+	// Targets are named builds selected with --target. The fields a target sets override the ones above,
+	// which act as the defaults every target shares.
+	Targets map[string]*Config `json:"targets,omitempty"`
+}
+
+// APIConfig is how the Hyperstack API is reached, e.g. for staging endpoints or from behind a proxy
+type APIConfig struct {
+	BaseURL  string `json:"base_url,omitempty"`  // https://infrahub-api.nexgencloud.com/v1 by default
+	Timeout  string `json:"timeout,omitempty"`   // Of each request, e.g. "60s"; 30s by default
+	Proxy    string `json:"proxy,omitempty"`     // HTTP(S) proxy URL; HTTPS_PROXY and NO_PROXY apply by default
+	CABundle string `json:"ca_bundle,omitempty"` // PEM file of CAs trusted on top of the system's
+}
+
+// ScratchVolumeConfig is a volume formatted and mounted on the build VM before the scripts run, e.g. for
+// driver builds and image pre-pulls that overflow the root disk of small flavors. It is unmounted, detached
+// and deleted before the snapshot, so nothing written to it ends up in the image.
+type ScratchVolumeConfig struct {
+	SizeGB     int    `json:"size_gb"`
+	VolumeType string `json:"volume_type,omitempty"` // Defaults to Cloud-SSD
+	MountPoint string `json:"mount_point,omitempty"` // Defaults to /mnt/scratch, passed to scripts as SCRATCH_DIR
+}
+
+// Provisioner is a provisioning script from the scripts directory, run in the order listed
+type Provisioner struct {
+	Script   string `json:"script"`
+	Disabled bool   `json:"disabled,omitempty"` // Skip the script while keeping it in the list
+}
+
+// FileConfig is a file from the files directory copied onto the VM after the scripts have run
+type FileConfig struct {
+	Source      string `json:"source"`      // Relative to the files directory
+	Destination string `json:"destination"` // Absolute path on the VM
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// ComplianceConfig runs a benchmark on the build VM after provisioning and attaches a scored report
+type ComplianceConfig struct {
+	Enabled    bool    `json:"enabled"`
+	Tool       string  `json:"tool,omitempty"`       // "lynis" (default) or "oscap"
+	Profile    string  `json:"profile,omitempty"`    // oscap XCCDF profile, e.g. xccdf_org.ssgproject.content_profile_cis_level1_server
+	Datastream string  `json:"datastream,omitempty"` // oscap SCAP datastream path on the VM
+	MinScore   float64 `json:"min_score,omitempty"`  // Fail the build below this percentage
+}
+
+// NotificationsConfig lists where build outcomes and lifecycle events are sent
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+	Slack    []ChatConfig    `json:"slack,omitempty"`
+	Teams    []ChatConfig    `json:"teams,omitempty"`
+	Email    []EmailConfig   `json:"email,omitempty"`
+}
+
+// EmailConfig sends build outcomes through an SMTP server, for environments where chat webhooks aren't allowed
+type EmailConfig struct {
+	SMTPHost    string   `json:"smtp_host"`
+	SMTPPort    int      `json:"smtp_port,omitempty"` // Defaults to 587
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty"` // Environment variable holding the SMTP password
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	On          []string `json:"on,omitempty"`       // success, failure, started, provisioned, image_created; empty means success and failure
+	Template    string   `json:"template,omitempty"` // Go text/template for the body
+}
+
+// ChatConfig is a Slack or Microsoft Teams incoming webhook receiving a templated message
+type ChatConfig struct {
+	WebhookURL string   `json:"webhook_url"`
+	On         []string `json:"on,omitempty"`       // success, failure, started, provisioned, image_created; empty means success and failure
+	Template   string   `json:"template,omitempty"` // Go text/template; defaults to a summary of the build
+}
+
+// WebhookConfig is an endpoint that receives the build event as a JSON POST
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	On      []string          `json:"on,omitempty"` // success, failure, started, provisioned, image_created; empty means success and failure
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// RetentionConfig limits how many versions of each image name are kept
+type RetentionConfig struct {
+	Keep            int            `json:"keep"`                       // Newest versions of each image name to keep
+	Families        map[string]int `json:"families,omitempty"`         // Per image name overrides of keep
+	AfterBuild      bool           `json:"after_build,omitempty"`      // Prune the image name after each successful build
+	IncludeReleased bool           `json:"include_released,omitempty"` // Also delete older versions in the staging or stable channel
+}
+
+// NamingPolicy constrains the names and labels of images the builder creates. Patterns are
+// regular expressions that must match the whole value.
+type NamingPolicy struct {
+	ImageName string      `json:"image_name,omitempty"` // Pattern for the full <image_name>_<version> name
+	Labels    []LabelRule `json:"labels,omitempty"`
+}
+
+// LabelRule constrains the value of a "key=value" image label
+type LabelRule struct {
+	Key      string `json:"key"`
+	Pattern  string `json:"pattern,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// RegionReplica is an additional region the image is rebuilt in after the primary build succeeds.
+// Empty fields inherit from the top-level config; environment_name defaults to default-<REGION>.
+type RegionReplica struct {
+	Region          string `json:"region"`
+	EnvironmentName string `json:"environment_name,omitempty"`
+	FlavorName      string `json:"flavor_name,omitempty"`
+	KeypairName     string `json:"keypair_name,omitempty"`
+	BaseImageName   string `json:"base_image_name,omitempty"`
+}
+
+// Matrix expands a config into one build per combination of its axes. Each axis maps a short key, used
+// to name the image, to a value; empty axes keep the top-level value.
+type Matrix struct {
+	BaseImageNames map[string]string `json:"base_image_name,omitempty"`
+	FlavorNames    map[string]string `json:"flavor_name,omitempty"`
+	DriverVersions map[string]string `json:"driver_version,omitempty"` // Passed to scripts as NVIDIA_DRIVER_VERSION
+	Concurrency    int               `json:"concurrency,omitempty"`    // Builds run at once, defaults to 1
+}
+
+// HCPPackerConfig controls emitting HCP Packer registry metadata for each build
+type HCPPackerConfig struct {
+	Enabled      bool              `json:"enabled"`
+	BucketName   string            `json:"bucket_name,omitempty"` // Defaults to the image name
+	BucketLabels map[string]string `json:"bucket_labels,omitempty"`
+}
+
+// TerraformConfig writes the built image IDs per region as a tfvars JSON file for infrastructure code
+type TerraformConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Path     string `json:"path,omitempty"`     // Defaults to images.auto.tfvars.json in the artifacts directory
+	Variable string `json:"variable,omitempty"` // Defaults to hyperstack_image
+	Publish  string `json:"publish,omitempty"`  // s3:// or gs:// object URL the file is also uploaded to
+}
+
+// CAPIConfig generates Cluster API OpenStackMachineTemplate manifests referencing the built image
+type CAPIConfig struct {
+	Enabled    bool              `json:"enabled"`
+	Path       string            `json:"path,omitempty"` // Defaults to machine-templates.yaml in the artifacts directory
+	Name       string            `json:"name,omitempty"` // Template name prefix, defaults to the image name
+	Namespace  string            `json:"namespace,omitempty"`
+	Flavor     string            `json:"flavor,omitempty"`       // Defaults to the build flavor of each region
+	SSHKeyName string            `json:"ssh_key_name,omitempty"` // Defaults to the keypair of each region
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// DotenvConfig writes the build result as a dotenv file for GitLab's artifacts:reports:dotenv
+type DotenvConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"` // Defaults to build.env in the artifacts root
+}
+
+// SigningConfig controls cosign signing of the manifest and SBOM
+type SigningConfig struct {
+	Enabled bool   `json:"enabled"`
+	Key     string `json:"key,omitempty"` // cosign private key path or KMS URI; empty uses keyless OIDC signing
+}
+
+// ArtifactsConfig controls the per-build artifacts directory
+type ArtifactsConfig struct {
+	Dir     string        `json:"dir,omitempty"`     // Root directory, defaults to "artifacts"
+	Archive bool          `json:"archive,omitempty"` // Also write a .tar.gz of the build's directory
+	Collect []CollectSpec `json:"collect,omitempty"` // Extra files to collect from the VM after provisioning
+	Publish string        `json:"publish,omitempty"` // s3:// or gs:// prefix the directory is uploaded to after each build
+}
+
+// CollectSpec names a file in the artifacts directory and the remote command whose stdout fills it
+type CollectSpec struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// TimeoutsConfig holds per-phase deadlines as Go duration strings (e.g. "45m")
+type TimeoutsConfig struct {
+	Build    string `json:"build,omitempty"` // The whole build; unlimited by default
+	VMReady  string `json:"vm_ready,omitempty"`
+	SSH      string `json:"ssh,omitempty"` // How long to keep retrying the SSH connection
+	Snapshot string `json:"snapshot,omitempty"`
+	Image    string `json:"image,omitempty"`
+}
+
+// Stage is one step of a multi-stage pipeline. Empty fields inherit from the top-level config.
+type Stage struct {
+	Name         string   `json:"name"`
+	ImageName    string   `json:"image_name"`
+	ImageVersion string   `json:"image_version,omitempty"`
+	FlavorName   string   `json:"flavor_name,omitempty"`
+	BaseStage    string   `json:"base_stage,omitempty"` // Stage whose built image is used as the base
+	Scripts      []string `json:"scripts,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// LaunchTestConfig controls booting a VM from the built image to validate it
+type LaunchTestConfig struct {
+	Enabled    bool              `json:"enabled"`
+	FlavorName string            `json:"flavor_name,omitempty"` // Defaults to the build flavor
+	Checks     []ValidationCheck `json:"checks,omitempty"`      // Defaults to nvidia-smi, containerd and kubelet checks
+	Commands   []string          `json:"commands,omitempty"`
+
+	// Additional flavors (e.g. other GPU generations) the image is booted and checked on
+	Flavors           []string `json:"flavors,omitempty"`
+	RequireAllFlavors bool     `json:"require_all_flavors,omitempty"` // Fail the build if any additional flavor fails
+}
+
+// JoinTestConfig controls joining a VM booted from the built image to a test Kubernetes control plane
+type JoinTestConfig struct {
+	Enabled           bool   `json:"enabled"`
+	FlavorName        string `json:"flavor_name,omitempty"`   // Defaults to the build flavor
+	APIServerEndpoint string `json:"api_server_endpoint"`     // host:port reachable from the VM
+	TokenEnv          string `json:"token_env,omitempty"`     // Environment variable holding the bootstrap token, defaults to KUBEADM_JOIN_TOKEN
+	CACertHash        string `json:"ca_cert_hash"`            // sha256:<hash> for --discovery-token-ca-cert-hash
+	Kubeconfig        string `json:"kubeconfig"`              // Local kubeconfig for the test control plane
+	ReadyTimeout      string `json:"ready_timeout,omitempty"` // Defaults to 10m
+}
+
+// ValidationCheck is a named command that must exit zero on a VM booted from the image
+type ValidationCheck struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// SecurityRule represents a security rule for VM creation
+type SecurityRule struct {
+	Direction       string `json:"direction"`
+	Protocol        string `json:"protocol"`
+	EtherType       string `json:"ethertype"`
+	RemoteIPPrefix  string `json:"remote_ip_prefix"`
+	PortRangeMin    *int   `json:"port_range_min,omitempty"`
+	PortRangeMax    *int   `json:"port_range_max,omitempty"`
+}
+
+// VMCreateRequest represents a request to create a virtual machine
+type VMCreateRequest struct {
+	Name                   string          `json:"name"`
+	ImageName              string          `json:"image_name"`
+	FlavorName             string          `json:"flavor_name"`
+	KeyName                string          `json:"key_name"`
+	EnvironmentName        string          `json:"environment_name"`
+	Count                  int             `json:"count"`
+	Labels                 []string        `json:"labels"`
+	AssignFloatingIP       bool            `json:"assign_floating_ip"`
+	EnablePortRandomization *bool          `json:"enable_port_randomization,omitempty"`
+	SecurityRules          []SecurityRule  `json:"security_rules,omitempty"`
+}
+
+// VMInstance represents a virtual machine instance
+type VMInstance struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	Status           string `json:"status"`
+	FixedIP          string `json:"fixed_ip"`
+	FloatingIP       string `json:"floating_ip"`
+	FloatingIPStatus string `json:"floating_ip_status"`
+	Labels           []string `json:"labels"`
+	CreatedAt        string   `json:"created_at"`
+	Flavor    VMFlavor `json:"flavor"`
+	Image     VMImage  `json:"image"`
+}
+
+// VMFlavor represents VM flavor information
+type VMFlavor struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// VMImage represents VM image information
+type VMImage struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// VMCreateResponse represents the response from creating VMs
+type VMCreateResponse struct {
+	Instances []VMInstance `json:"instances"`
+}
+
+// SnapshotCreateRequest represents a request to create a snapshot
+type SnapshotCreateRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+// Snapshot represents a VM snapshot
+type Snapshot struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	VMID          int    `json:"vm_id"`
+	RegionID      int    `json:"region_id"`
+	Status        string `json:"status"`
+	IsImage       bool   `json:"is_image"`
+	Size          int    `json:"size"`
+	HasFloatingIP bool   `json:"has_floating_ip"`
+	Labels        []any  `json:"labels"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+type SnapshotCreateResponse struct {
+	Status   bool     `json:"status"`
+	Message  string   `json:"message"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+type ImageCreateData struct {
+	Image Image `json:"image"`
+}
+
+type SnapshotListResponse struct {
+	Status    bool       `json:"status"`
+	Message   string     `json:"message"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+type SnapshotDetailResponse struct {
+	Status   int      `json:"status"`
+	Message  string   `json:"message"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+type ImageDetailData struct {
+	Status  bool  `json:"status"`
+	Message string `json:"message"`
+	Image   Image `json:"image"`
+}
+
+// ImageCreateRequest represents a request to create an image from snapshot
+type ImageCreateRequest struct {
+	Name   string   `json:"name"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// ImageUpdateRequest represents a request to update an existing image
+type ImageUpdateRequest struct {
+	Name   string   `json:"name,omitempty"`
+	Labels []string `json:"labels"`
+}
+
+// ImageLabel represents a label on an image
+type ImageLabel struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+// Image represents a Hyperstack image
+type Image struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	RegionName string       `json:"region_name"`
+	Type       string       `json:"type"`
+	Version    string       `json:"version"`
+	Size       int64        `json:"size"`
+	IsPublic   bool         `json:"is_public"`
+	Labels     []ImageLabel `json:"labels"`
+	CreatedAt  string       `json:"created_at"`
+}
+
+// ImageGroup represents grouped images by region/type
+type ImageGroup struct {
+	RegionName string  `json:"region_name"`
+	Type       string  `json:"type"`
+	Images     []Image `json:"images"`
+}
+
+// APIResponse represents the standard Hyperstack API response wrapper
+type APIResponse[T any] struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"-"` // Will be unmarshaled separately
+}
+
+// Specific response data structures
+type ImagesData struct {
+	Images []ImageGroup `json:"images"`
+}
+
+type RegionsData struct {
+	Regions []Region `json:"regions"`
+}
+
+type FlavorsData struct {
+	Data []FlavorGroup `json:"data"`
+}
+
+type KeypairsData struct {
+	Keypairs []Keypair `json:"keypairs"`
+}
+
+type KeypairData struct {
+	Keypair Keypair `json:"keypair"`
+}
+
+// KeypairImportRequest represents a request to import an SSH public key as a keypair
+type KeypairImportRequest struct {
+	Name            string `json:"name"`
+	EnvironmentName string `json:"environment_name"`
+	PublicKey       string `json:"public_key"`
+}
+
+type EnvironmentsData struct {
+	Environments []Environment `json:"environments"`
+}
+
+type EnvironmentData struct {
+	Environment Environment `json:"environment"`
+}
+
+// EnvironmentCreateRequest represents a request to create an environment
+type EnvironmentCreateRequest struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+}
+
+type VMCreateData struct {
+	Instances []VMInstance `json:"instances"`
+}
+
+type VMListData struct {
+	Instances []VMInstance `json:"instances"`
+}
+
+type VMDetailData struct {
+	Instance VMInstance `json:"instance"`
+}
+
+// Region represents a Hyperstack region
+type Region struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Flavor represents a VM flavor/instance type
+type Flavor struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	RegionName     string  `json:"region_name"`
+	CPU            int     `json:"cpu"`
+	RAM            float64 `json:"ram"`
+	Disk           int     `json:"disk"`
+	GPU            string  `json:"gpu"`
+	GPUCount       int     `json:"gpu_count"`
+	StockAvailable *bool   `json:"stock_available,omitempty"` // Whether VMs of the flavor can be created now, if reported
+}
+
+// Stock is the GPU capacity of a region
+type Stock struct {
+	Region    string       `json:"region"`
+	StockType string       `json:"stock-type"`
+	Models    []StockModel `json:"models"`
+}
+
+// StockModel is the capacity of a region for one GPU model
+type StockModel struct {
+	Model          string         `json:"model"`
+	Available      json.Number    `json:"available"`      // GPUs free now
+	Configurations map[string]int `json:"configurations"` // VMs that fit per GPU count, keyed "1x", "2x", ...
+}
+
+type StocksData struct {
+	Stocks []Stock `json:"stocks"`
+}
+
+// Quota is a limit on the organization's resources and how much of it is in use
+type Quota struct {
+	Resource string `json:"resource"`         // vm, gpu, volume or volume_size (GB)
+	Model    string `json:"model,omitempty"`  // GPU model a gpu quota counts, empty for all of them
+	Region   string `json:"region,omitempty"` // Region the quota applies in, empty for the whole organization
+	Limit    int    `json:"limit"`            // Negative for no limit
+	Used     int    `json:"used"`
+}
+
+type QuotasData struct {
+	Quotas []Quota `json:"quotas"`
+}
+
+// FlavorGroup represents grouped flavors by GPU type and region
+type FlavorGroup struct {
+	GPU        string    `json:"gpu"`
+	RegionName string    `json:"region_name"`
+	Flavors    []Flavor  `json:"flavors"`
+}
+
+// Environment represents a Hyperstack environment
+type Environment struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+}
+
+// Volume represents a block storage volume
+type Volume struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Status      string      `json:"status"`
+	Size        int         `json:"size"`
+	VolumeType  string      `json:"volume_type"`
+	Environment Environment `json:"environment"`
+}
+
+// VolumeCreateRequest represents a request to create a volume
+type VolumeCreateRequest struct {
+	Name            string `json:"name"`
+	EnvironmentName string `json:"environment_name"`
+	Size            int    `json:"size"`
+	VolumeType      string `json:"volume_type"`
+	Description     string `json:"description"`
+}
+
+// VolumeAttachRequest represents a request to attach volumes to, or detach them from, a VM
+type VolumeAttachRequest struct {
+	VolumeIDs []int `json:"volume_ids"`
+}
+
+type VolumeData struct {
+	Volume Volume `json:"volume"`
+}
+
+// Keypair represents an SSH keypair
+type Keypair struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Environment Environment `json:"environment"`
+	Fingerprint string      `json:"fingerprint"`
+}
\ No newline at end of file
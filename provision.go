@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+const provisionUsage = "provision [config] [--target <name>] --host <ip> [--key <path>] [--scripts <a.sh,b.sh>] [--ssh-timeout <duration>]"
+
+// runProvision runs the provisioning scripts and file deployments on an existing host, so scripts can be
+// iterated on against a dev VM without building an image. The config, if given, supplies the key, script
+// environment, collected artifacts and SSH timeout.
+func runProvision(args []string) error {
+	cfg := &types.Config{}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		loaded, err := loadConfig(args, provisionUsage)
+		if err != nil {
+			return err
+		}
+		cfg, args = loaded, args[1:]
+	}
+	if len(cfg.Targets) > 0 {
+		return withExitCode(exitConfig, targetsError(cfg))
+	}
+	if cfg.Timeouts == nil {
+		cfg.Timeouts = &types.TimeoutsConfig{}
+	}
+	if err := resolvePrivateKey(cfg); err != nil {
+		return err
+	}
+	defer removePrivateKeys()
+
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	fs.String("target", "", "provision for this target of the config (read by loadConfig)")
+	host := fs.String("host", "", "address of the host to provision")
+	key := fs.String("key", cfg.PrivateKeyPath, "private key to log in as ubuntu with (private_key_path)")
+	scriptsFlag := fs.String("scripts", "", "comma-separated provisioning scripts to run instead of the defaults")
+	fs.StringVar(&cfg.Timeouts.SSH, "ssh-timeout", cfg.Timeouts.SSH, "how long to keep retrying the SSH connection (timeouts.ssh)")
+	fs.Parse(args)
+
+	if *host == "" || *key == "" {
+		return withExitCode(exitConfig, fmt.Errorf("usage: %s", provisionUsage))
+	}
+	cfg.PrivateKeyPath = *key
+	scripts := scriptsFor(cfg)
+	if *scriptsFlag != "" {
+		scripts = strings.Split(*scriptsFlag, ",")
+	}
+
+	b := builder.New(builder.Options{
+		ScriptDir: scriptDir,
+		FilesDir:  filesDir,
+		Files:     builder.Deployments(fileDeployments),
+	})
+	return b.Provision(context.Background(), cfg, *host, scripts)
+}
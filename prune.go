@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/metadata"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// timeLayouts are the timestamp formats seen in API responses
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// parseAge parses a duration that may also be given in days, e.g. "90d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q: %w", s, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// imageCreatedAt returns when an image was built, preferring the builder's metadata label over the API timestamp
+func imageCreatedAt(image *types.Image) (time.Time, bool) {
+	candidates := []string{image.CreatedAt}
+	if meta, err := metadata.FromImage(image); err == nil && meta.BuiltAt != "" {
+		candidates = append([]string{meta.BuiltAt}, candidates...)
+	}
+	for _, value := range candidates {
+		if t, ok := parseTimestamp(value); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseTimestamp parses a timestamp in any of the timeLayouts
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// labelsFlag collects repeated --label flags
+type labelsFlag []string
+
+func (l *labelsFlag) String() string     { return strings.Join(*l, ",") }
+func (l *labelsFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func runImagesPrune(args []string) error {
+	fs := flag.NewFlagSet("images prune", flag.ExitOnError)
+	olderThan := fs.String("older-than", "", "delete images built longer ago than this, e.g. 90d or 720h (required)")
+	var withLabels labelsFlag
+	fs.Var(&withLabels, "label", "only delete images with this label as well as the builder's (repeatable, all must match)")
+	includeReleased := fs.Bool("include-released", false, "also delete images currently in the staging or stable channel")
+	dryRun := fs.Bool("dry-run", false, "only list the images that would be deleted")
+	fs.Parse(args)
+
+	if *olderThan == "" {
+		return fmt.Errorf("--older-than is required")
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	return pruneImages(context.Background(), hyperstackClient, pruneOptions{
+		olderThan:       age,
+		labels:          withLabels,
+		includeReleased: *includeReleased,
+		dryRun:          *dryRun,
+	}, os.Stdout)
+}
+
+// pruneOptions select the images images prune deletes
+type pruneOptions struct {
+	olderThan       time.Duration
+	labels          []string // All must be on an image
+	includeReleased bool
+	dryRun          bool
+}
+
+// pruneImages deletes the images built by this builder that match opts, writing a preview table to out
+func pruneImages(ctx context.Context, hyperstackClient builder.API, opts pruneOptions, out io.Writer) error {
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-opts.olderThan)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tBUILT\tCHANNEL\tACTION")
+
+	// Only images this builder made are ever candidates, never ones made by hand
+	var candidates []types.Image
+	for _, image := range images {
+		if image.IsPublic || !builtByBuilder(&image) || !hasAllLabels(imageLabels(&image), opts.labels) {
+			continue
+		}
+		builtAt, ok := imageCreatedAt(&image)
+		if !ok || builtAt.After(cutoff) {
+			continue
+		}
+
+		channel := imageChannel(&image)
+		action := "delete"
+		if channel != "" && channel != labels.Channels[0] && !opts.includeReleased {
+			action = "keep (released)"
+		} else {
+			candidates = append(candidates, image)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", image.ID, image.Name, builtAt.Local().Format(time.DateOnly), orDash(channel), action)
+	}
+	w.Flush()
+
+	if opts.dryRun {
+		slog.Info("Dry run, nothing was deleted", "would_delete", len(candidates))
+		return nil
+	}
+
+	deleted, failed := 0, 0
+	for _, image := range candidates {
+		slog.Info("Deleting image", "image_name", image.Name, "image_id", image.ID)
+		if err := hyperstackClient.DeleteImage(ctx, image.ID); err != nil {
+			slog.Warn("Failed to delete image", "image_id", image.ID, "error", err)
+			failed++
+			continue
+		}
+		deleted++
+	}
+	slog.Info("Pruned images", "deleted", deleted, "candidates", len(candidates))
+	if failed > 0 {
+		return withExitCode(exitCleanup, fmt.Errorf("%d images could not be deleted", failed))
+	}
+	return nil
+}
+
+// hasAllLabels reports whether labels contain every wanted label
+func hasAllLabels(labels, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+		for _, l := range labels {
+			if l == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder/buildertest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+func TestPruneImagesDeletesBuiltImage(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{})
+	res, err := b.Build(context.Background(), cfg, []string{buildertest.Script})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	api.AddImage(types.Image{ID: 100, Name: "hand-made", RegionName: cfg.Region, CreatedAt: "2020-01-01T00:00:00Z"})
+	api.AddImage(types.Image{ID: 101, Name: "kube-node_v0.9.0", RegionName: cfg.Region, CreatedAt: "2020-01-01T00:00:00Z",
+		Labels: []types.ImageLabel{{Label: labels.Builder}, {Label: labels.Channel("stable")}}})
+
+	if err := pruneImages(context.Background(), api, pruneOptions{}, io.Discard); err != nil {
+		t.Fatalf("pruneImages() error = %v", err)
+	}
+	if !api.Called("DeleteImage " + strconv.Itoa(res.Image.ID)) {
+		t.Errorf("built image %d was not deleted, calls: %v", res.Image.ID, api.Calls())
+	}
+	for _, kept := range []string{"DeleteImage 100", "DeleteImage 101"} {
+		if api.Called(kept) {
+			t.Errorf("unexpected %s, calls: %v", kept, api.Calls())
+		}
+	}
+}
+
+func TestPruneImagesDryRunDeletesNothing(t *testing.T) {
+	cfg, api, b := buildertest.New(t, buildertest.Shell{})
+	if _, err := b.Build(context.Background(), cfg, []string{buildertest.Script}); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	if err := pruneImages(context.Background(), api, pruneOptions{dryRun: true}, io.Discard); err != nil {
+		t.Fatalf("pruneImages() error = %v", err)
+	}
+	for _, call := range api.Calls() {
+		if strings.HasPrefix(call, "DeleteImage ") {
+			t.Errorf("dry run called %s", call)
+		}
+	}
+}
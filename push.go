@@ -0,0 +1,158 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/glance"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// exportDiskCommand streams the compressed root disk of the export VM to stdout
+const exportDiskCommand = `sudo sh -c 'sync && dd if=/dev/$(lsblk -no PKNAME $(findmnt -no SOURCE /)) bs=4M status=none | gzip -1'`
+
+// exportImage boots a VM from the image, copies its root disk and converts it to qcow2 at path
+func exportImage(hyperstackClient builder.API, cfg *types.Config, image *types.Image, path string) error {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		return fmt.Errorf("qemu-img not found in PATH: %w", err)
+	}
+
+	vm, cleanup, err := builder.New(builder.Options{API: hyperstackClient}).BootTestVM(context.Background(), cfg, image, history.NewID(time.Now()), "", "export")
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	rawPath := path + ".raw"
+	raw, err := os.Create(rawPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", rawPath, err)
+	}
+	defer os.Remove(rawPath)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(vm.SSH.StreamOutput(exportDiskCommand, pw))
+	}()
+
+	slog.Info("Copying root disk", "vm_id", vm.ID, "path", rawPath)
+	gz, err := gzip.NewReader(pr)
+	if err == nil {
+		_, err = io.Copy(raw, gz)
+	}
+	pr.Close()
+	if closeErr := raw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy root disk: %w", err)
+	}
+
+	slog.Info("Converting to qcow2", "path", rawPath)
+	cmd := exec.Command("qemu-img", "convert", "-f", "raw", "-O", "qcow2", "-c", rawPath, path)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to convert disk to qcow2: %w", err)
+	}
+	return nil
+}
+
+func runImagesPush(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: images push <id> --glance <endpoint> [--config <config.json> | --qcow2 <file>] [--name <name>]")
+	}
+
+	imageID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid image ID %q: %w", args[0], err)
+	}
+
+	fs := flag.NewFlagSet("images push", flag.ExitOnError)
+	endpoint := fs.String("glance", "", "Glance image service endpoint, e.g. https://glance.example.com:9292")
+	configPath := fs.String("config", "", "build config used to boot the export VM (keypair, flavor, environment)")
+	qcow2Path := fs.String("qcow2", "", "upload an already exported qcow2 file instead of exporting the image")
+	name := fs.String("name", "", "name of the Glance image (defaults to the Hyperstack image name)")
+	keep := fs.Bool("keep", false, "keep the exported qcow2 file after uploading")
+	fs.Parse(args[1:])
+
+	if *endpoint == "" {
+		return fmt.Errorf("--glance is required")
+	}
+	if *qcow2Path == "" && *configPath == "" {
+		return fmt.Errorf("--config is required to export the image (or pass --qcow2)")
+	}
+
+	token := os.Getenv("OS_TOKEN")
+	if token == "" {
+		return fmt.Errorf("OS_TOKEN environment variable is not set (see `openstack token issue`)")
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	image, err := hyperstackClient.GetImage(ctx, imageID)
+	if err != nil {
+		return err
+	}
+
+	path := *qcow2Path
+	if path == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		path = filepath.Join(os.TempDir(), image.Name+".qcow2")
+		if err := exportImage(hyperstackClient, cfg, image, path); err != nil {
+			return err
+		}
+		if !*keep {
+			defer os.Remove(path)
+		}
+	}
+
+	glanceName := *name
+	if glanceName == "" {
+		glanceName = image.Name
+	}
+
+	properties := glance.PropertiesFromLabels(imageLabels(image))
+	properties["hsb_source_image_id"] = strconv.Itoa(image.ID)
+	properties["hsb_source_region"] = image.RegionName
+
+	glanceClient := glance.New(*endpoint, token)
+	created, err := glanceClient.CreateImage(glanceName, properties)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	slog.Info("Uploading to Glance", "path", path, "glance_image", created.Name, "glance_image_id", created.ID)
+	if err := glanceClient.Upload(created.ID, f); err != nil {
+		return err
+	}
+
+	slog.Info("Pushed image", "image_name", image.Name, "glance", *endpoint, "glance_image", created.Name, "glance_image_id", created.ID)
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/buildstate"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+)
+
+// Ways of dealing with an interrupted build of the same image
+const (
+	recoverResume  = "resume"
+	recoverCleanup = "cleanup"
+)
+
+// findInterrupted returns the interrupted builds of the given image names
+func findInterrupted(imageNames ...string) ([]buildstate.State, error) {
+	var interrupted []buildstate.State
+	for _, name := range imageNames {
+		states, err := buildstate.Interrupted(buildstate.DefaultDir(), name)
+		if err != nil {
+			return nil, err
+		}
+		interrupted = append(interrupted, states...)
+	}
+	return interrupted, nil
+}
+
+// interruptedError explains how to continue after interrupted builds were found
+func interruptedError(interrupted []buildstate.State) error {
+	var lines []string
+	for _, s := range interrupted {
+		lines = append(lines, fmt.Sprintf("build %s of %s_%s stopped in phase %s (VM %d, snapshot %d, image %d)",
+			s.BuildID, s.ImageName, s.ImageVersion, orDash(s.Phase), s.VMID, s.SnapshotID, s.ImageID))
+	}
+	return fmt.Errorf("found interrupted builds:\n  %s\nrerun with --recover resume to continue on the interrupted build's VM, or --recover cleanup to delete its resources and start over",
+		strings.Join(lines, "\n  "))
+}
+
+// cleanupInterrupted deletes the VM, snapshot and image an interrupted build left behind, and its state file
+func cleanupInterrupted(ctx context.Context, hyperstackClient builder.API, s buildstate.State) error {
+	slog.Info("Cleaning up interrupted build", "interrupted_build_id", s.BuildID, "phase", s.Phase)
+	if s.VMID != 0 {
+		if _, err := hyperstackClient.GetVMDetails(ctx, s.VMID); err == nil {
+			builder.TeardownVM(ctx, hyperstackClient, s.VMID)
+		}
+	}
+	discardPartial(ctx, hyperstackClient, s)
+	return buildstate.Delete(buildstate.DefaultDir(), s.BuildID)
+}
+
+// discardPartial deletes the snapshot and image of an interrupted build, which never finished testing
+func discardPartial(ctx context.Context, hyperstackClient builder.API, s buildstate.State) {
+	if s.ImageID != 0 {
+		slog.Info("Deleting image of interrupted build", "image_id", s.ImageID)
+		if err := hyperstackClient.DeleteImage(ctx, s.ImageID); err != nil {
+			slog.Warn("Failed to delete image", "image_id", s.ImageID, "error", err)
+		}
+	}
+	if s.SnapshotID != 0 {
+		slog.Info("Deleting snapshot of interrupted build", "snapshot_id", s.SnapshotID)
+		if err := hyperstackClient.DeleteSnapshot(ctx, s.SnapshotID); err != nil {
+			slog.Warn("Failed to delete snapshot", "snapshot_id", s.SnapshotID, "error", err)
+		}
+	}
+}
+
+// resumePointFor works out where to continue an interrupted build. Its VM is gone once the image was created,
+// so only builds that stopped before then can be resumed.
+func resumePointFor(ctx context.Context, hyperstackClient builder.API, s buildstate.State) (*builder.ResumePoint, error) {
+	if s.VMID == 0 {
+		return nil, fmt.Errorf("build %s stopped before its VM was created, use --recover cleanup", s.BuildID)
+	}
+	switch s.Phase {
+	case "launch-test", "join-test", "finalize":
+		return nil, fmt.Errorf("build %s stopped after its VM was deleted, use --recover cleanup", s.BuildID)
+	}
+	if _, err := hyperstackClient.GetVMDetails(ctx, s.VMID); err != nil {
+		return nil, fmt.Errorf("VM %d of build %s is gone, use --recover cleanup: %w", s.VMID, s.BuildID, err)
+	}
+
+	switch s.Phase {
+	case "snapshot", "image":
+		// The snapshot is retaken from the provisioned VM
+		discardPartial(ctx, hyperstackClient, s)
+		return &builder.ResumePoint{VMID: s.VMID, From: builder.ResumeFromSnapshot}, nil
+	default:
+		return &builder.ResumePoint{VMID: s.VMID, From: builder.ResumeFromProvision}, nil
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/tracing"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// checkRegions rejects a regions list that cannot be built concurrently
+func checkRegions(cfg *types.Config) error {
+	if len(cfg.Regions) == 0 {
+		return nil
+	}
+	if len(cfg.Stages) > 0 {
+		return fmt.Errorf("regions cannot be combined with stages")
+	}
+	listed := make(map[string]bool, len(cfg.Regions))
+	for _, region := range cfg.Regions {
+		if listed[region] {
+			return fmt.Errorf("region %s is listed twice in regions", region)
+		}
+		listed[region] = true
+	}
+	for _, replica := range cfg.Replicas {
+		if !listed[replica.Region] {
+			return fmt.Errorf("replica region %s is not listed in regions", replica.Region)
+		}
+	}
+	return nil
+}
+
+// regionConfig derives the build config for one of cfg.Regions. A replicas entry for the region supplies
+// its overrides, and its artifacts go under a per-region subdirectory as a replica's do.
+func regionConfig(cfg *types.Config, region string) *types.Config {
+	replica := types.RegionReplica{Region: region}
+	if region == cfg.Region {
+		replica.EnvironmentName = cfg.EnvironmentName
+	}
+	for _, r := range cfg.Replicas {
+		if r.Region == region {
+			replica = r
+		}
+	}
+	regionCfg := replicaConfig(cfg, replica)
+	regionCfg.Regions = nil
+	return regionCfg
+}
+
+// buildRegions builds the image in every region of cfg.Regions at once, each in a builder process of its
+// own with its own VM, and writes a manifest listing the per-region image IDs
+func buildRegions(ctx context.Context, cfg *types.Config, configPath string, flagArgs []string) (*manifest.RegionalManifest, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the builder executable: %w", err)
+	}
+
+	regional := &manifest.RegionalManifest{
+		ImageName:    cfg.ImageName,
+		ImageVersion: cfg.ImageVersion,
+		Regions:      make([]manifest.RegionalImage, len(cfg.Regions)),
+	}
+
+	codes := make([]int, len(cfg.Regions))
+	var wg sync.WaitGroup
+	for i, region := range cfg.Regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			regional.Regions[i], codes[i] = buildRegion(ctx, exe, cfg, region, configPath, flagArgs)
+		}(i, region)
+	}
+	wg.Wait()
+
+	path := filepath.Join(artifacts.PathFor(builder.ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion), "regions.json")
+	if err := manifest.WriteJSON(regional, path); err != nil {
+		return regional, fmt.Errorf("failed to write regional manifest: %w", err)
+	}
+	slog.Info("Wrote regional manifest", "path", path)
+
+	var failedCodes []int
+	for i, entry := range regional.Regions {
+		if entry.Error == "" {
+			slog.Info("Regional image", "region", entry.Region, "image_name", entry.ImageName, "image_id", entry.ImageID)
+		} else {
+			failedCodes = append(failedCodes, codes[i])
+			slog.Info("Regional image", "region", entry.Region, "error", entry.Error)
+		}
+	}
+	if len(failedCodes) > 0 {
+		return regional, withExitCode(commonExitCode(failedCodes), fmt.Errorf("%d of %d regions failed", len(failedCodes), len(cfg.Regions)))
+	}
+	return regional, nil
+}
+
+// buildRegion runs `build --region` for one region, prefixing its output with the region, and reads the
+// image it built from the region's manifest. The exit code is that of the failed build.
+func buildRegion(ctx context.Context, exe string, cfg *types.Config, region, configPath string, flagArgs []string) (manifest.RegionalImage, int) {
+	entry := manifest.RegionalImage{Region: region}
+	slog.Info("Starting regional build", "image_name", cfg.ImageName, "region", region)
+
+	// Later flags win, so the region and the already resolved version override anything passed through
+	args := append([]string{"build", configPath}, flagArgs...)
+	args = append(args, "--region", region, "--image-version", cfg.ImageVersion)
+
+	if err := runChild(ctx, exe, args, "["+region+"] ", len(cfg.Regions)); err != nil {
+		entry.Error = fmt.Sprintf("build failed: %v", err)
+		slog.Error("Regional build failed", "region", region, "error", err)
+		return entry, childExitCode(err)
+	}
+
+	regionCfg := regionConfig(cfg, region)
+	m, err := manifest.Read(filepath.Join(artifacts.PathFor(builder.ArtifactsRoot(regionCfg), cfg.ImageName, cfg.ImageVersion), "manifest.json"))
+	if err != nil {
+		entry.Error = fmt.Sprintf("failed to read manifest: %v", err)
+		return entry, exitFailure
+	}
+	entry.ImageID = m.ImageID
+	entry.ImageName = m.ImageName
+	return entry, 0
+}
+
+// runChild runs the builder executable with args, prefixing every line of its output. Canceling ctx
+// interrupts the child so it can tear down its build. siblings is how many children run at once.
+func runChild(ctx context.Context, exe string, args []string, prefix string, siblings int) error {
+	out := newPrefixWriter(os.Stderr, prefix)
+	defer out.Flush()
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	// In a process group of its own, a Ctrl-C reaches the child only once, through cmd.Cancel
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = childEnv(siblings)
+	return cmd.Run()
+}
+
+// childEnv is the environment of a build run by runChild. Only the parent serves metrics, as the
+// children would all try to listen on the same address, and a TRACEPARENT inherited from further up is
+// replaced by the parent's own. The children running at once split the parent's API rate limit, so
+// together they stay within it.
+func childEnv(siblings int) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "HYPERSTACK_BUILDER_METRICS_ADDR=") && !strings.HasPrefix(kv, "TRACEPARENT=") && !strings.HasPrefix(kv, "HYPERSTACK_BUILDER_API_RATE=") {
+			env = append(env, kv)
+		}
+	}
+	rate := client.RateLimit() / float64(max(siblings, 1))
+	env = append(env, "HYPERSTACK_BUILDER_API_RATE="+strconv.FormatFloat(rate, 'g', 4, 64))
+	// The child's spans continue the trace of the command that started it
+	if tp := tracing.Traceparent(); tp != "" {
+		env = append(env, "TRACEPARENT="+tp)
+	}
+	return env
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix, so concurrent builds stay readable
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a trailing line that did not end in a newline
+func (p *prefixWriter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
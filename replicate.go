@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// replicaConfig derives the build config for a replica region. Its artifacts go under a per-region
+// subdirectory so they don't overwrite the primary build's.
+func replicaConfig(cfg *types.Config, replica types.RegionReplica) *types.Config {
+	replicaCfg := *cfg
+	replicaCfg.Replicas = nil
+	replicaCfg.Region = replica.Region
+
+	replicaCfg.EnvironmentName = replica.EnvironmentName
+	if replicaCfg.EnvironmentName == "" {
+		replicaCfg.EnvironmentName = fmt.Sprintf("default-%s", replica.Region)
+	}
+	if replica.FlavorName != "" {
+		replicaCfg.FlavorName = replica.FlavorName
+	}
+	if replica.KeypairName != "" {
+		replicaCfg.KeypairName = replica.KeypairName
+	}
+	if replica.BaseImageName != "" {
+		replicaCfg.BaseImageName = replica.BaseImageName
+	}
+
+	artifactsCfg := types.ArtifactsConfig{}
+	if cfg.Artifacts != nil {
+		artifactsCfg = *cfg.Artifacts
+	}
+	artifactsCfg.Dir = filepath.Join(builder.ArtifactsRoot(cfg), replica.Region)
+	replicaCfg.Artifacts = &artifactsCfg
+
+	return &replicaCfg
+}
+
+// singleRegion returns the regional manifest of a build that has only been built in its primary region
+func singleRegion(cfg *types.Config, primary *types.Image) *manifest.RegionalManifest {
+	return &manifest.RegionalManifest{
+		ImageName:    cfg.ImageName,
+		ImageVersion: cfg.ImageVersion,
+		Regions: []manifest.RegionalImage{
+			{Region: cfg.Region, ImageID: primary.ID, ImageName: primary.Name},
+		},
+	}
+}
+
+// replicate replays the build in every replica region and writes a manifest listing the per-region image IDs
+func replicate(ctx context.Context, b *builder.Builder, cfg *types.Config, primary *types.Image, scripts []string) (*manifest.RegionalManifest, error) {
+	regional := singleRegion(cfg, primary)
+
+	var failedCodes []int
+	for _, replica := range cfg.Replicas {
+		slog.Info("Replicating image", "image_name", primary.Name, "region", replica.Region)
+		res, err := b.Build(ctx, replicaConfig(cfg, replica), scripts)
+
+		entry := manifest.RegionalImage{Region: replica.Region}
+		if err != nil {
+			entry.Error = err.Error()
+			failedCodes = append(failedCodes, exitCode(err))
+			slog.Error("Replication failed", "region", replica.Region, "error", err)
+		} else {
+			entry.ImageID = res.Image.ID
+			entry.ImageName = res.Image.Name
+		}
+		regional.Regions = append(regional.Regions, entry)
+	}
+
+	path := filepath.Join(artifacts.PathFor(builder.ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion), "regions.json")
+	if err := manifest.WriteJSON(regional, path); err != nil {
+		return regional, fmt.Errorf("failed to write regional manifest: %w", err)
+	}
+	slog.Info("Wrote regional manifest", "path", path)
+
+	for _, entry := range regional.Regions {
+		if entry.Error == "" {
+			slog.Info("Regional image", "region", entry.Region, "image_name", entry.ImageName, "image_id", entry.ImageID)
+		} else {
+			slog.Info("Regional image", "region", entry.Region, "error", entry.Error)
+		}
+	}
+
+	if len(failedCodes) > 0 {
+		return regional, withExitCode(commonExitCode(failedCodes), fmt.Errorf("%d of %d replica regions failed", len(failedCodes), len(cfg.Replicas)))
+	}
+	return regional, nil
+}
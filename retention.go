@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/labels"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+const pruneImagesUsage = "prune-images [config] [--target <name>] [--keep <n>] [--name <image_name>] [--include-released] [--dry-run]"
+
+// familyVersion is one version of an image name, with its image in every region it was built in
+type familyVersion struct {
+	name     string // <image_name>_<version>
+	builtAt  time.Time
+	released bool // Some image of the version is in a channel past the first
+	images   []types.Image
+}
+
+// retentionKeep returns how many versions of an image name the retention config keeps
+func retentionKeep(r *types.RetentionConfig, imageName string) int {
+	if keep, ok := r.Families[imageName]; ok {
+		return keep
+	}
+	return r.Keep
+}
+
+// familyVersions groups the images built under an image name by version, newest first. Images without a
+// known build time are left out, so they are never pruned.
+func familyVersions(images []types.Image, imageName string) []*familyVersion {
+	byName := make(map[string]*familyVersion)
+	var versions []*familyVersion
+	for _, image := range images {
+		if image.IsPublic || !inFamily(&image, imageName) {
+			continue
+		}
+		builtAt, ok := imageCreatedAt(&image)
+		if !ok {
+			slog.Warn("Skipping image without a build time", "image_name", image.Name, "image_id", image.ID)
+			continue
+		}
+		v := byName[image.Name]
+		if v == nil {
+			v = &familyVersion{name: image.Name}
+			byName[image.Name] = v
+			versions = append(versions, v)
+		}
+		if builtAt.After(v.builtAt) {
+			v.builtAt = builtAt
+		}
+		if channel := imageChannel(&image); channel != "" && channel != labels.Channels[0] {
+			v.released = true
+		}
+		v.images = append(v.images, image)
+	}
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].builtAt.After(versions[j].builtAt) })
+	return versions
+}
+
+// pruneFamily deletes every version of an image name but the newest keep, listing each version and what
+// happens to it in w, and returns how many images could not be deleted
+func pruneFamily(ctx context.Context, hyperstackClient builder.API, images []types.Image, imageName string, keep int, includeReleased, dryRun bool, w *tabwriter.Writer) int {
+	failed := 0
+	for i, v := range familyVersions(images, imageName) {
+		action := "delete"
+		switch {
+		case i < keep:
+			action = "keep"
+		case v.released && !includeReleased:
+			action = "keep (released)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", imageName, v.name, len(v.images), v.builtAt.Local().Format(time.DateOnly), action)
+		if action != "delete" || dryRun {
+			continue
+		}
+		for _, image := range v.images {
+			// Never delete an image of another family, whatever matched it above
+			if family := imageFamily(&image); family != imageName {
+				slog.Warn("Not deleting image of another image name", "image_name", image.Name, "image_id", image.ID, "family", family)
+				continue
+			}
+			slog.Info("Deleting image", "image_name", image.Name, "image_id", image.ID, "region", image.RegionName)
+			if err := hyperstackClient.DeleteImage(ctx, image.ID); err != nil {
+				slog.Warn("Failed to delete image", "image_id", image.ID, "error", err)
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// configFamilies returns the image names a config builds
+func configFamilies(cfg *types.Config) ([]string, error) {
+	if cfg.Matrix != nil {
+		builds, err := config.ExpandMatrix(cfg)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, build := range builds {
+			names = append(names, build.Config.ImageName)
+		}
+		return names, nil
+	}
+	if len(cfg.Stages) > 0 {
+		var names []string
+		for _, stage := range cfg.Stages {
+			names = append(names, stage.ImageName)
+		}
+		return names, nil
+	}
+	return []string{cfg.ImageName}, nil
+}
+
+// builderFamilies returns every image name the builder has built images under
+func builderFamilies(images []types.Image) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, image := range images {
+		for _, l := range image.Labels {
+			name, ok := strings.CutPrefix(l.Label, labels.ImageFamilyPrefix)
+			if ok && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runPruneImages(args []string) error {
+	var cfg *types.Config
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		loaded, err := loadConfig(args, pruneImagesUsage)
+		if err != nil {
+			return err
+		}
+		if len(loaded.Targets) > 0 {
+			return withExitCode(exitConfig, targetsError(loaded))
+		}
+		cfg, args = loaded, args[1:]
+	}
+
+	fs := flag.NewFlagSet("prune-images", flag.ExitOnError)
+	fs.String("target", "", "prune the image name of this target of the config (read by loadConfig)")
+	keep := fs.Int("keep", 0, "versions of each image name to keep, overriding retention.keep")
+	name := fs.String("name", "", "only prune this image name (default: those built by the config, or every builder image name)")
+	includeReleased := fs.Bool("include-released", false, "also delete older versions in the staging or stable channel")
+	dryRun := fs.Bool("dry-run", false, "only list the versions that would be deleted")
+	fs.Parse(args)
+
+	retention := types.RetentionConfig{}
+	var families []string
+	if cfg != nil {
+		if cfg.Retention != nil {
+			retention = *cfg.Retention
+		}
+		var err error
+		if families, err = configFamilies(cfg); err != nil {
+			return withExitCode(exitConfig, err)
+		}
+	}
+	if *name != "" {
+		families = []string{*name}
+	}
+	if *keep != 0 {
+		retention.Keep = *keep
+		retention.Families = nil
+	}
+	if *includeReleased {
+		retention.IncludeReleased = true
+	}
+	if retention.Keep < 1 {
+		return withExitCode(exitConfig, fmt.Errorf("--keep or retention.keep must be at least 1"))
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, fmt.Errorf("failed to list images: %w", err))
+	}
+	if len(families) == 0 {
+		families = builderFamilies(images)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE NAME\tVERSION\tREGIONS\tBUILT\tACTION")
+	failed := 0
+	for _, family := range families {
+		failed += pruneFamily(ctx, hyperstackClient, images, family, retentionKeep(&retention, family), retention.IncludeReleased, *dryRun, w)
+	}
+	w.Flush()
+
+	if *dryRun {
+		slog.Info("Dry run, nothing was deleted")
+	}
+	if failed > 0 {
+		return withExitCode(exitCleanup, fmt.Errorf("%d images could not be deleted", failed))
+	}
+	return nil
+}
+
+// pruneAfterBuild applies retention.after_build to the image name just built. Failures are only logged,
+// as the build itself succeeded.
+func pruneAfterBuild(ctx context.Context, hyperstackClient builder.API, cfg *types.Config) {
+	r := cfg.Retention
+	if r == nil || !r.AfterBuild {
+		return
+	}
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		slog.Warn("Failed to list images to apply retention", "error", err)
+		return
+	}
+	slog.Info("Applying retention", "image_name", cfg.ImageName, "keep", retentionKeep(r, cfg.ImageName))
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE NAME\tVERSION\tREGIONS\tBUILT\tACTION")
+	failed := pruneFamily(ctx, hyperstackClient, images, cfg.ImageName, retentionKeep(r, cfg.ImageName), r.IncludeReleased, false, w)
+	w.Flush()
+	if failed > 0 {
+		slog.Warn("Failed to delete old images", "image_name", cfg.ImageName, "count", failed)
+	}
+}
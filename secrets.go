@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/logging"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/secrets"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// apiKeySource returns where the API key is read from when HYPERSTACK_API_KEY is not set: the
+// HYPERSTACK_API_KEY_FILE, HYPERSTACK_API_KEY_COMMAND or HYPERSTACK_API_KEY_VAULT environment variable, or
+// else the config's api_key_file, api_key_command or api_key_vault
+func apiKeySource(cfg *types.Config) secrets.Source {
+	source := secrets.Source{
+		File:    os.Getenv("HYPERSTACK_API_KEY_FILE"),
+		Command: os.Getenv("HYPERSTACK_API_KEY_COMMAND"),
+		Vault:   os.Getenv("HYPERSTACK_API_KEY_VAULT"),
+	}
+	if !source.IsSet() && cfg != nil {
+		source = secrets.Source{File: cfg.APIKeyFile, Command: cfg.APIKeyCommand, Vault: cfg.APIKeyVault}
+	}
+	return source
+}
+
+// apiKey returns the Hyperstack API key, or "" if none is configured. It is redacted from the log.
+func apiKey(cfg *types.Config) (string, error) {
+	key := os.Getenv("HYPERSTACK_API_KEY")
+	if source := apiKeySource(cfg); key == "" && source.IsSet() {
+		var err error
+		if key, err = source.Read(); err != nil {
+			return "", withExitCode(exitConfig, fmt.Errorf("failed to read the API key: %w", err))
+		}
+	}
+	logging.AddSecret(key)
+	return key, nil
+}
+
+// privateKeyDirs hold the private keys written by resolvePrivateKey, until removePrivateKeys
+var privateKeyDirs []string
+
+// resolvePrivateKey writes the SSH private key from the config's private_key_command or private_key_vault
+// to a file only the current user can read, and points private_key_path at it. removePrivateKeys deletes
+// the file again.
+func resolvePrivateKey(cfg *types.Config) error {
+	source := secrets.Source{Command: cfg.PrivateKeyCommand, Vault: cfg.PrivateKeyVault}
+	if !source.IsSet() {
+		return nil
+	}
+	key, err := source.Read()
+	if err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("failed to read the SSH private key: %w", err))
+	}
+
+	dir, err := os.MkdirTemp("", "hyperstack-key-")
+	if err != nil {
+		return fmt.Errorf("failed to create private key directory: %w", err)
+	}
+	privateKeyDirs = append(privateKeyDirs, dir)
+	path := filepath.Join(dir, "id")
+	// ssh.ParsePrivateKey needs the trailing newline that Read trims
+	if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	cfg.PrivateKeyPath = path
+	return nil
+}
+
+// removePrivateKeys deletes the private keys written by resolvePrivateKey
+func removePrivateKeys() {
+	for _, dir := range privateKeyDirs {
+		os.RemoveAll(dir)
+	}
+	privateKeyDirs = nil
+}
@@ -0,0 +1,656 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/artifacts"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/history"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Job statuses
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// maxConfigSize bounds the config a build request may post
+const maxConfigSize = 1 << 20
+
+// job is a build submitted to the server, run as a `build` child process
+type job struct {
+	ID           string     `json:"id"`
+	ImageName    string     `json:"image_name"`
+	ImageVersion string     `json:"image_version"`
+	Scripts      []string   `json:"scripts,omitempty"`
+	Status       string     `json:"status"`
+	ExitCode     int        `json:"exit_code,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	SubmittedAt  time.Time  `json:"submitted_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	ArtifactsDir string     `json:"artifacts_dir"`
+	ImageID      int        `json:"image_id,omitempty"` // Set once a single-image build succeeds
+
+	dir    string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// buildServer runs submitted builds, at most concurrency at a time
+type buildServer struct {
+	exe        string
+	dataDir    string
+	token      string
+	privateKey string          // Private key every build logs in with, as posted configs can't name one
+	ctx        context.Context // Canceled when the server shuts down
+	sem        chan struct{}
+	wg         sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*job
+
+	// history is the server's own history file, which builders on other hosts append to through /history
+	history   *history.Store
+	historyMu sync.Mutex
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	insecure := fs.Bool("insecure", false, "accept unauthenticated requests when HYPERSTACK_BUILDER_SERVER_TOKEN is not set")
+	privateKey := fs.String("private-key", "~/.ssh/id_rsa", "private key of the keypair builds log in with")
+	concurrency := fs.Int("concurrency", 1, "builds to run at once; the rest wait in the queue")
+	dataDir := fs.String("data-dir", defaultServerDir(), "directory for the configs and logs of submitted builds")
+	fs.Parse(args)
+
+	if *concurrency < 1 {
+		return withExitCode(exitConfig, fmt.Errorf("--concurrency must be at least 1"))
+	}
+	// Fail now rather than on the first submission
+	if _, err := newClientFromEnv(); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the builder executable: %w", err)
+	}
+	if err := os.MkdirAll(*dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	token := os.Getenv("HYPERSTACK_BUILDER_SERVER_TOKEN")
+	if token == "" {
+		if !*insecure {
+			return withExitCode(exitConfig, fmt.Errorf("HYPERSTACK_BUILDER_SERVER_TOKEN must be set, or --insecure given to accept unauthenticated requests"))
+		}
+		slog.Warn("HYPERSTACK_BUILDER_SERVER_TOKEN is not set, the API accepts unauthenticated requests")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s := &buildServer{
+		exe:        exe,
+		dataDir:    *dataDir,
+		token:      token,
+		privateKey: *privateKey,
+		ctx:        ctx,
+		sem:        make(chan struct{}, *concurrency),
+		jobs:       make(map[string]*job),
+		// Always the local file, so a server given HYPERSTACK_BUILDER_HISTORY_URL doesn't post to itself
+		history: history.Open(history.DefaultPath()),
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: s.routes()}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	slog.Info("Serving build API", "addr", *addr, "concurrency", *concurrency, "data_dir", *dataDir)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("build API server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Running builds are interrupted so they tear down their VMs before the server exits
+	slog.Info("Shutting down, canceling running builds")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	s.wg.Wait()
+	return nil
+}
+
+// defaultServerDir is where the server keeps submitted builds unless --data-dir is given
+func defaultServerDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".hyperstack-builder", "server")
+	}
+	return filepath.Join(homeDir, ".hyperstack-builder", "server")
+}
+
+func (s *buildServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/builds", s.authenticated(http.HandlerFunc(s.handleBuilds)))
+	mux.Handle("/builds/", s.authenticated(http.HandlerFunc(s.handleBuild)))
+	mux.Handle("/history", s.authenticated(http.HandlerFunc(s.handleHistory)))
+	return mux
+}
+
+// authenticated requires the bearer token, if the server has one
+func (s *buildServer) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleBuilds serves GET /builds and POST /builds
+func (s *buildServer) handleBuilds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		jobs := make([]job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			jobs = append(jobs, *j)
+		}
+		s.mu.Unlock()
+		sort.Slice(jobs, func(i, k int) bool { return jobs[i].SubmittedAt.After(jobs[k].SubmittedAt) })
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		j, err := s.submit(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, s.snapshot(j))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed", r.Method))
+	}
+}
+
+// handleHistory serves GET /history, listing every build record, and POST /history, appending one. Records
+// can't be changed or removed through the API.
+func (s *buildServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.historyMu.Lock()
+		records, err := s.history.List()
+		s.historyMu.Unlock()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if records == nil {
+			records = []history.Record{}
+		}
+		writeJSON(w, http.StatusOK, records)
+	case http.MethodPost:
+		var rec history.Record
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxConfigSize)).Decode(&rec); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid build record: %w", err))
+			return
+		}
+		if rec.ID == "" || rec.Status == "" {
+			writeError(w, http.StatusBadRequest, errors.New("build record needs an id and a status"))
+			return
+		}
+		// Builders record redacted configs, but older ones didn't
+		rec.Config = history.Redact(&rec.Config)
+		s.historyMu.Lock()
+		err := s.history.Append(rec)
+		s.historyMu.Unlock()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		slog.Info("Recorded build", "build_id", rec.ID, "user", rec.User, "host", rec.Host, "status", rec.Status)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed", r.Method))
+	}
+}
+
+// handleBuild serves GET /builds/<id>, GET /builds/<id>/logs and POST /builds/<id>/cancel
+func (s *buildServer) handleBuild(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/builds/"), "/")
+	s.mu.Lock()
+	j := s.jobs[id]
+	s.mu.Unlock()
+	if j == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("build %s not found", id))
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.snapshot(j))
+	case action == "logs" && r.Method == http.MethodGet:
+		s.streamLog(w, r, j)
+	case action == "cancel" && r.Method == http.MethodPost:
+		s.cancel(j)
+		writeJSON(w, http.StatusAccepted, s.snapshot(j))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// submit checks the posted config and queues a build of it. The scripts query parameter replaces the
+// default provisioning scripts, and the target query parameter picks a target of the config. Builds log in
+// with the server's private key.
+func (s *buildServer) submit(r *http.Request) (*job, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if len(data) > maxConfigSize {
+		return nil, fmt.Errorf("config is larger than %d bytes", maxConfigSize)
+	}
+
+	now := time.Now()
+	j := &job{
+		ID:          history.NewID(now),
+		Status:      jobQueued,
+		SubmittedAt: now.UTC(),
+		done:        make(chan struct{}),
+	}
+	if scripts := r.URL.Query().Get("scripts"); scripts != "" {
+		j.Scripts = strings.Split(scripts, ",")
+		for _, script := range j.Scripts {
+			if !filepath.IsLocal(script) {
+				return nil, fmt.Errorf("script %q must be a name in the scripts directory", script)
+			}
+		}
+	}
+	format := config.FormatJSON
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		format = config.FormatYAML
+	}
+	if err := checkPostedConfig(data); err != nil {
+		return nil, err
+	}
+	j.dir = filepath.Join(s.dataDir, j.ID)
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %w", err)
+	}
+	fail := func(err error) (*job, error) {
+		os.RemoveAll(j.dir)
+		return nil, err
+	}
+
+	// Loading the posted config from disk applies the same defaults as the CLI. A YAML content type keeps
+	// the config in YAML.
+	configPath := filepath.Join(j.dir, "config."+format)
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return fail(fmt.Errorf("failed to write config: %w", err))
+	}
+	cfg, err := config.Load(configPath)
+	if target := r.URL.Query().Get("target"); target != "" && err == nil {
+		// The build runs the selected target on its own
+		if cfg, err = config.LoadTarget(configPath, target); err == nil {
+			err = config.Save(cfg, configPath)
+		}
+	}
+	if err != nil {
+		return fail(fmt.Errorf("invalid config: %w", err))
+	}
+	// The build loads the saved config again, which must not render anything the first load didn't
+	if err := checkRendered(cfg); err != nil {
+		return fail(err)
+	}
+	cfg.PrivateKeyPath = s.privateKey
+	if _, err := validateConfig(cfg); err != nil {
+		return fail(err)
+	}
+	// A single image's "auto" version is resolved now so the build's artifacts can be found afterwards
+	if cfg.Matrix == nil && len(cfg.Stages) == 0 {
+		hyperstackClient, err := newClient(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		if err := resolveVersion(r.Context(), hyperstackClient, cfg); err != nil {
+			return fail(err)
+		}
+	}
+	if err := config.Save(cfg, configPath); err != nil {
+		return fail(fmt.Errorf("failed to write config: %w", err))
+	}
+	j.ImageName = cfg.ImageName
+	j.ImageVersion = cfg.ImageVersion
+	j.ArtifactsDir = artifacts.PathFor(builder.ArtifactsRoot(cfg), cfg.ImageName, cfg.ImageVersion)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	j.cancel = cancel
+	s.mu.Lock()
+	s.jobs[j.ID] = j
+	s.mu.Unlock()
+	slog.Info("Queued build", "job_id", j.ID, "image_name", j.ImageName, "image_version", j.ImageVersion)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.run(ctx, j, configPath)
+	}()
+	return j, nil
+}
+
+// checkPostedConfig rejects a posted config that would make the server run commands, read its files or
+// environment, or write outside the build's artifacts: secret sources, local paths, API settings, extends
+// and the env template function. The server's own environment and flags provide those instead.
+func checkPostedConfig(data []byte) error {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return errors.New("invalid config: expected a mapping of config fields")
+	}
+	if _, ok := root["sops"]; ok {
+		return errors.New("encrypted configs can't be submitted to the build server")
+	}
+	var problems []string
+	checkPostedFields(&problems, "", root)
+	if targets, ok := root["targets"].(map[string]any); ok {
+		for name, target := range targets {
+			if target, ok := target.(map[string]any); ok {
+				checkPostedFields(&problems, "targets."+name+".", target)
+			}
+		}
+	}
+	walkStrings("", doc, func(path, value string) {
+		if i := strings.Index(value, "{{"); i >= 0 && envFunc.MatchString(value[i:]) {
+			problems = append(problems, path+" uses the env template function")
+		}
+	})
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("config sets fields the build server doesn't accept: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// envFunc finds a call of the env template function, which would read the server's environment
+var envFunc = regexp.MustCompile(`\benv\b`)
+
+// serverOnlyFields are set by the server, not by posted configs, keyed by section ("" for the top level)
+var serverOnlyFields = map[string][]string{
+	"":          {"extends", "api", "private_key_path", "public_key_path", "api_key_file", "api_key_command", "api_key_vault", "private_key_command", "private_key_vault"},
+	"join_test": {"kubeconfig", "token_env"},
+	"artifacts": {"dir"},
+	"terraform": {"path"},
+	"capi":      {"path"},
+	"dotenv":    {"path"},
+}
+
+// checkPostedFields adds a problem for each field of a posted config, or of one of its targets, that only the
+// server may set
+func checkPostedFields(problems *[]string, prefix string, doc map[string]any) {
+	for section, fields := range serverOnlyFields {
+		fieldsOf := doc
+		if section != "" {
+			fieldsOf, _ = doc[section].(map[string]any)
+		}
+		for _, field := range fields {
+			if _, ok := fieldsOf[field]; ok {
+				*problems = append(*problems, prefix+strings.TrimPrefix(section+"."+field, "."))
+			}
+		}
+	}
+	// cosign may be given a KMS URI, but not a key file
+	if signing, ok := doc["signing"].(map[string]any); ok {
+		if key, _ := signing["key"].(string); key != "" && !strings.Contains(key, "://") {
+			*problems = append(*problems, prefix+"signing.key")
+		}
+	}
+	if notifications, ok := doc["notifications"].(map[string]any); ok {
+		emails, _ := notifications["email"].([]any)
+		for i, email := range emails {
+			if email, ok := email.(map[string]any); ok && email["password_env"] != nil {
+				*problems = append(*problems, fmt.Sprintf("%snotifications.email[%d].password_env", prefix, i))
+			}
+		}
+	}
+
+	// Scripts and files are named within the server's scripts and files directories
+	local := func(path string, v any) {
+		if name, ok := v.(string); ok && !filepath.IsLocal(name) {
+			*problems = append(*problems, prefix+path+" must be a name in its directory")
+		}
+	}
+	list := func(key string) []any {
+		items, _ := doc[key].([]any)
+		return items
+	}
+	for i, p := range list("provisioners") {
+		if p, ok := p.(map[string]any); ok {
+			local(fmt.Sprintf("provisioners[%d].script", i), p["script"])
+		}
+	}
+	for i, f := range list("files") {
+		if f, ok := f.(map[string]any); ok {
+			local(fmt.Sprintf("files[%d].source", i), f["source"])
+		}
+	}
+	for i, stage := range list("stages") {
+		if stage, ok := stage.(map[string]any); ok {
+			scripts, _ := stage["scripts"].([]any)
+			for k, script := range scripts {
+				local(fmt.Sprintf("stages[%d].scripts[%d]", i, k), script)
+			}
+		}
+	}
+}
+
+// checkRendered fails if a loaded config still holds a template, which the build would render again.
+// Notification templates are rendered with the build's event rather than the config functions.
+func checkRendered(cfg *types.Config) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var doc any
+	json.Unmarshal(data, &doc)
+	var problems []string
+	walkStrings("", doc, func(path, value string) {
+		if strings.Contains(value, "{{") && !strings.HasSuffix(path, ".template") {
+			problems = append(problems, path)
+		}
+	})
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("config values render to templates: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// walkStrings calls fn with each string in a decoded document and its path
+func walkStrings(path string, v any, fn func(path, value string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, v)
+	case map[string]any:
+		for k, item := range v {
+			walkStrings(strings.TrimPrefix(path+"."+k, "."), item, fn)
+		}
+	case []any:
+		for i, item := range v {
+			walkStrings(fmt.Sprintf("%s[%d]", path, i), item, fn)
+		}
+	}
+}
+
+// run waits for a free slot and runs the build, recording how it ended
+func (s *buildServer) run(ctx context.Context, j *job, configPath string) {
+	defer close(j.done)
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		s.finish(j, jobCanceled, 0, "canceled before it started")
+		return
+	}
+
+	logFile, err := os.Create(filepath.Join(j.dir, "build.log"))
+	if err != nil {
+		s.finish(j, jobFailed, exitFailure, fmt.Sprintf("failed to create build log: %v", err))
+		return
+	}
+	defer logFile.Close()
+
+	args := []string{"build", configPath}
+	if len(j.Scripts) > 0 {
+		args = append(args, "--scripts", strings.Join(j.Scripts, ","))
+	}
+	cmd := exec.CommandContext(ctx, s.exe, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Env = childEnv(cap(s.sem))
+
+	s.mu.Lock()
+	j.Status = jobRunning
+	startedAt := time.Now().UTC()
+	j.StartedAt = &startedAt
+	s.mu.Unlock()
+	slog.Info("Starting build", "job_id", j.ID, "image_name", j.ImageName)
+
+	err = cmd.Run()
+	switch {
+	case err == nil:
+		s.finish(j, jobSucceeded, 0, "")
+	case ctx.Err() != nil:
+		s.finish(j, jobCanceled, childExitCode(err), "canceled")
+	default:
+		code := childExitCode(err)
+		s.finish(j, jobFailed, code, fmt.Sprintf("build failed with exit code %d, see its logs", code))
+	}
+}
+
+// finish records the outcome of a job, and the image a successful single-image build produced
+func (s *buildServer) finish(j *job, status string, code int, msg string) {
+	imageID := 0
+	if status == jobSucceeded {
+		if m, err := manifest.Read(filepath.Join(j.ArtifactsDir, "manifest.json")); err == nil {
+			imageID = m.ImageID
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.Status = status
+	j.ExitCode = code
+	j.Error = msg
+	j.ImageID = imageID
+	finishedAt := time.Now().UTC()
+	j.FinishedAt = &finishedAt
+	slog.Info("Build finished", "job_id", j.ID, "image_name", j.ImageName, "status", status, "exit_code", code)
+}
+
+// cancel interrupts a running build, which tears down its VM, or drops a queued one
+func (s *buildServer) cancel(j *job) {
+	slog.Info("Canceling build", "job_id", j.ID)
+	j.cancel()
+}
+
+// snapshot returns a copy of a job that is safe to encode while it runs
+func (s *buildServer) snapshot(j *job) job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *j
+}
+
+// streamLog writes the build log, and with follow=true keeps writing what is appended until the build ends
+func (s *buildServer) streamLog(w http.ResponseWriter, r *http.Request, j *job) {
+	follow := r.URL.Query().Get("follow") == "true"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+
+	path := filepath.Join(j.dir, "build.log")
+	f, err := os.Open(path)
+	for err != nil {
+		// A queued build has no log yet
+		if !follow || !waitForLog(r.Context(), j) {
+			return
+		}
+		f, err = os.Open(path)
+	}
+	defer f.Close()
+
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !follow || !waitForLog(r.Context(), j) {
+			// Pick up whatever was written between the last read and the build ending
+			io.Copy(w, f)
+			return
+		}
+	}
+}
+
+// waitForLog waits a moment for more log output, returning false once the build or the request is over
+func waitForLog(ctx context.Context, j *job) bool {
+	select {
+	case <-j.done:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-time.After(500 * time.Millisecond):
+		return true
+	}
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/buildstate"
+)
+
+// latestStepLog returns the most recently written step log of a build, or ""
+func latestStepLog(artifactsDir string) string {
+	logs, _ := filepath.Glob(filepath.Join(artifactsDir, "logs", "*.log"))
+	latest, latestMod := "", time.Time{}
+	for _, path := range logs {
+		info, err := os.Stat(path)
+		if err == nil && info.ModTime().After(latestMod) {
+			latest, latestMod = path, info.ModTime()
+		}
+	}
+	return latest
+}
+
+// tailLines returns the last n lines of a file
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the build states as JSON")
+	lines := fs.Int("lines", 20, "number of lines of recent step output to show for a single build")
+	fs.Parse(args)
+
+	states, err := buildstate.List(buildstate.DefaultDir())
+	if err != nil {
+		return err
+	}
+
+	if buildID := fs.Arg(0); buildID != "" {
+		for i := range states {
+			if states[i].BuildID == buildID {
+				return showStatus(&states[i], *lines, *asJSON)
+			}
+		}
+		return fmt.Errorf("build %s is not in progress", buildID)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(states) == 0 {
+		fmt.Println("No builds in progress")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUILD ID\tIMAGE\tPHASE\tELAPSED\tVM ID\tVM IP\tHOST\tSTATE")
+	for _, s := range states {
+		vmID := "-"
+		if s.VMID != 0 {
+			vmID = fmt.Sprint(s.VMID)
+		}
+		fmt.Fprintf(w, "%s\t%s_%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.BuildID, s.ImageName, s.ImageVersion, orDash(s.Phase),
+			time.Since(s.StartedAt).Round(time.Second), vmID, orDash(s.VMIP), s.Hostname, liveness(&s))
+	}
+	return w.Flush()
+}
+
+// liveness describes whether the process running a build is still alive
+func liveness(s *buildstate.State) string {
+	if s.Alive() {
+		return "running"
+	}
+	return "interrupted"
+}
+
+// showStatus prints one build's state and the tail of its most recent step log
+func showStatus(s *buildstate.State, lines int, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Build:     %s (%s)\n", s.BuildID, liveness(s))
+	fmt.Printf("Image:     %s_%s\n", s.ImageName, s.ImageVersion)
+	fmt.Printf("Host:      %s (pid %d)\n", s.Hostname, s.PID)
+	fmt.Printf("Elapsed:   %s\n", time.Since(s.StartedAt).Round(time.Second))
+	if s.Phase != "" {
+		fmt.Printf("Phase:     %s (%s)\n", s.Phase, time.Since(s.PhaseStartedAt).Round(time.Second))
+	}
+	if s.VMID != 0 {
+		fmt.Printf("VM:        %d %s\n", s.VMID, s.VMIP)
+	}
+	if s.SnapshotID != 0 {
+		fmt.Printf("Snapshot:  %d\n", s.SnapshotID)
+	}
+	if s.ImageID != 0 {
+		fmt.Printf("Image ID:  %d\n", s.ImageID)
+	}
+	fmt.Printf("Artifacts: %s\n", s.ArtifactsDir)
+
+	stepLog := latestStepLog(s.ArtifactsDir)
+	if stepLog == "" {
+		return nil
+	}
+	tail, err := tailLines(stepLog, lines)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", stepLog, err)
+	}
+	fmt.Printf("\nRecent output (%s):\n", filepath.Base(stepLog))
+	for _, line := range tail {
+		fmt.Println("  " + strings.TrimRight(line, "\r"))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/config"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// targetFlag returns the value of --target in args, which selects the build of a config that loadConfig
+// returns, so it is read before the command parses its other flags
+func targetFlag(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "target" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// withoutFlag removes a flag and, if it takes one, its value from args
+func withoutFlag(args []string, name string, takesValue bool) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		flagName, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || flagName != name {
+			kept = append(kept, args[i])
+			continue
+		}
+		if takesValue && !hasValue {
+			i++
+		}
+	}
+	return kept
+}
+
+// targetsError rejects using a config with targets without picking one
+func targetsError(cfg *types.Config) error {
+	return fmt.Errorf("config defines targets %s, pick one with --target <name>", strings.Join(config.TargetNames(cfg), ", "))
+}
+
+// validateTargets validates every target of the config at path
+func validateTargets(cfg *types.Config, path string) (string, error) {
+	for _, name := range config.TargetNames(cfg) {
+		targetCfg, err := config.LoadTarget(path, name)
+		if err != nil {
+			return "", fmt.Errorf("target %s: %w", name, err)
+		}
+		if _, err := validateConfig(targetCfg); err != nil {
+			return "", fmt.Errorf("target %s: %w", name, err)
+		}
+	}
+	return fmt.Sprintf(" (%d targets)", len(cfg.Targets)), nil
+}
+
+// buildTargets builds every target of the config at path, each in a builder process of its own, at most
+// max_parallel at a time (one by default)
+func buildTargets(ctx context.Context, cfg *types.Config, path string, flagArgs []string) error {
+	if _, err := validateTargets(cfg, path); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the builder executable: %w", err)
+	}
+
+	names := config.TargetNames(cfg)
+	concurrency := 1
+	if cfg.MaxParallel > 0 {
+		concurrency = cfg.MaxParallel
+	}
+	slog.Info("Building targets", "targets", len(names), "concurrency", concurrency)
+
+	codes := make([]int, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			slog.Info("Starting target build", "target", name)
+			args := append([]string{"build", path}, flagArgs...)
+			args = append(args, "--target", name)
+			if errs[i] = runChild(ctx, exe, args, "["+name+"] ", concurrency); errs[i] != nil {
+				codes[i] = childExitCode(errs[i])
+				slog.Error("Target build failed", "target", name, "error", errs[i])
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var failedCodes []int
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSTATUS")
+	for i, name := range names {
+		status := "succeeded"
+		if errs[i] != nil {
+			status = "failed"
+			failedCodes = append(failedCodes, codes[i])
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, status)
+	}
+	w.Flush()
+	if len(failedCodes) > 0 {
+		return withExitCode(commonExitCode(failedCodes), fmt.Errorf("%d of %d targets failed", len(failedCodes), len(names)))
+	}
+	return nil
+}
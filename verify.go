@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/manifest"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/signing"
+)
+
+func runVerify(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: verify <artifacts-dir|manifest.json> [--key cosign.pub | --certificate-identity <id> --certificate-oidc-issuer <url>] [--image-id <id>]")
+	}
+
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	key := fs.String("key", "", "cosign public key path or KMS URI")
+	identity := fs.String("certificate-identity", "", "expected signer identity for keyless signatures")
+	issuer := fs.String("certificate-oidc-issuer", "", "expected OIDC issuer for keyless signatures")
+	imageID := fs.Int("image-id", 0, "fail unless the manifest attests this image ID")
+	fs.Parse(args[1:])
+
+	artifactsPath := args[0]
+	manifestPath := args[0]
+	if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+		manifestPath = filepath.Join(args[0], "manifest.json")
+	} else {
+		artifactsPath = filepath.Dir(args[0])
+	}
+
+	opts := signing.VerifyOptions{
+		Key:                 *key,
+		CertificateIdentity: *identity,
+		CertificateIssuer:   *issuer,
+	}
+	for _, path := range signing.Files(artifactsPath, manifestPath) {
+		if err := signing.Verify(path, opts); err != nil {
+			return err
+		}
+		slog.Info("Verified file", "path", path)
+	}
+
+	m, err := manifest.Read(manifestPath)
+	if err != nil {
+		return err
+	}
+	if *imageID != 0 && m.ImageID != *imageID {
+		return fmt.Errorf("manifest attests image %d, not %d", m.ImageID, *imageID)
+	}
+
+	slog.Info("Image corresponds to attested build", "image_name", m.ImageName, "image_id", m.ImageID, "attested_build_id", m.BuildID)
+	return nil
+}
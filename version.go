@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/internal/versioning"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/builder"
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/types"
+)
+
+// resolveVersion replaces an "auto" image version with the next version after the highest published image
+func resolveVersion(ctx context.Context, hyperstackClient builder.API, cfg *types.Config) error {
+	if cfg.ImageVersion != versioning.Auto {
+		return nil
+	}
+
+	images, err := hyperstackClient.ListImages(ctx)
+	if err != nil {
+		return withExitCode(exitAPI, fmt.Errorf("failed to list images to resolve version: %w", err))
+	}
+	names := make([]string, 0, len(images))
+	for _, image := range images {
+		names = append(names, image.Name)
+	}
+
+	next, err := versioning.Next(cfg.VersionScheme, versioning.Existing(names, cfg.ImageName), time.Now())
+	if err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("failed to resolve image version: %w", err))
+	}
+	slog.Info("Resolved next version", "image_name", cfg.ImageName, "version", next)
+	cfg.ImageVersion = next
+	return nil
+}
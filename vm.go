@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/thundernetes/packer/kube-image/providers/hyperstack/pkg/client"
+)
+
+// vmActions are the power actions of the vm command
+var vmActions = map[string]func(*client.HyperstackClient, context.Context, int) error{
+	"start":       (*client.HyperstackClient).StartVM,
+	"stop":        (*client.HyperstackClient).StopVM,
+	"hard-reboot": (*client.HyperstackClient).HardRebootVM,
+	"shelve":      (*client.HyperstackClient).ShelveVM,
+	"unshelve":    (*client.HyperstackClient).UnshelveVM,
+}
+
+func runVM(args []string) error {
+	usage := fmt.Errorf("usage: vm <start|stop|hard-reboot|shelve|unshelve> <id>...")
+	if len(args) == 0 {
+		return withExitCode(exitConfig, usage)
+	}
+	action, ok := vmActions[args[0]]
+	if !ok {
+		return withExitCode(exitConfig, fmt.Errorf("unknown vm command: %s", args[0]))
+	}
+	ids, err := parseIDs(flag.NewFlagSet("vm "+args[0], flag.ExitOnError), args[1:])
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if len(ids) == 0 {
+		return withExitCode(exitConfig, usage)
+	}
+
+	ctx := context.Background()
+	hyperstackClient, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := action(hyperstackClient, ctx, id); err != nil {
+			return apiFailure(err)
+		}
+		slog.Info("Requested VM "+args[0], "vm_id", id)
+	}
+	return nil
+}